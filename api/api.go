@@ -0,0 +1,65 @@
+// Package api defines the JSON bodies of the server's /api/ endpoints.
+//
+// Tasks, activities and plans are encoded as the storage types are by encoding/json.
+// Errors are returned as an Error.
+package api
+
+import (
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Task is a task with its tags.
+type Task struct {
+	storage.Task
+	Tags []string
+}
+
+// Activity is an activity with its task.
+type Activity struct {
+	storage.Activity
+	Task storage.Task
+}
+
+// QuickRequest is the body of POST /api/quick.
+// The response is a quickcapture.Result.
+type QuickRequest struct {
+	Text string
+	// Preview only parses Text, without saving anything.
+	Preview bool
+}
+
+// Range is the response of GET /api/range: the activities and plans in a range, and the tasks they refer to.
+type Range struct {
+	Tasks      []storage.Task
+	Activities []storage.Activity
+	Plans      []storage.Plan
+}
+
+// StartRequest is the body of POST /api/activities/start.
+type StartRequest struct {
+	TaskID int64
+	// PlanID, if nonzero, is the plan (of the task) the started activity fulfills.
+	PlanID   int64
+	Location string
+	Note     string
+	// For is how long the activity is logged for, unless stopped earlier.
+	For time.Duration
+}
+
+// StopRequest is the body of POST /api/activities/stop.
+type StopRequest struct {
+	// Done marks the stopped activities' tasks as done.
+	Done bool
+}
+
+// StartResponse is the response of POST /api/activities/start and (without Started) POST /api/activities/stop.
+type StartResponse struct {
+	Stopped []Activity
+	Started *Activity `json:",omitempty"`
+}
@@ -0,0 +1,99 @@
+// Package auth identifies the users logging in to the server, through GitHub, an OpenID Connect provider or local accounts.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// User is a logged-in user.
+type User struct {
+	// Provider is the name of the provider the user logged in with.
+	// It is empty for GitHub, as are the users of sessions made before there were other providers.
+	Provider string
+	Login    string
+	// DisplayName is shown in place of Name if it is not empty.
+	// It may be changed by the user at the provider, so unlike Login, it must not be used to identify the user.
+	DisplayName string
+	AvatarURL   string
+	HTMLURL     string
+}
+
+// Name identifies the user across providers: it is the login for GitHub, and the provider's name and the login for others (e.g. "keycloak:alice"), so that a user of one provider cannot pass as the user of another with the same login.
+func (u User) Name() string {
+	if u.Provider == "" {
+		return u.Login
+	}
+	return u.Provider + ":" + u.Login
+}
+
+// Provider logs users in with the OAuth 2.0 authorization code flow.
+type Provider interface {
+	// Name identifies the provider in URLs and user names, e.g. "keycloak".
+	Name() string
+	// Title is shown on the login page, e.g. "Log in with Keycloak".
+	Title() string
+	Config() *oauth2.Config
+	// User returns the user the token was issued to.
+	User(token *oauth2.Token, ctx context.Context) (User, error)
+}
+
+// GitHub logs users in with their GitHub accounts.
+type GitHub struct {
+	config *oauth2.Config
+	apiURL string
+}
+
+var _ Provider = (*GitHub)(nil)
+
+// NewGitHub returns a provider for the OAuth app of config, whose Endpoint should be github.Endpoint.
+func NewGitHub(config *oauth2.Config) *GitHub {
+	return &GitHub{config: config, apiURL: "https://api.github.com"}
+}
+
+func (g *GitHub) Name() string           { return "github" }
+func (g *GitHub) Title() string          { return "Log in with GitHub" }
+func (g *GitHub) Config() *oauth2.Config { return g.config }
+
+type githubUser struct {
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+	HTMLURL   string `json:"html_url"`
+}
+
+func (g *GitHub) User(token *oauth2.Token, ctx context.Context) (User, error) {
+	var data githubUser
+	err := getJSON(g.config.Client(ctx, token), g.apiURL+"/user", &data)
+	if err != nil {
+		return User{}, err
+	}
+	if data.Login == "" {
+		return User{}, fmt.Errorf("no login")
+	}
+	return User{Login: data.Login, AvatarURL: data.AvatarURL, HTMLURL: data.HTMLURL}, nil
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s: status code %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// mockIssuer is an OpenID Connect provider that issues a code for sub to anyone who asks.
+type mockIssuer struct {
+	*httptest.Server
+	sub, userinfoSub string
+	challenge        string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	m := &mockIssuer{sub: "1234", userinfoSub: "1234"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			UserinfoEndpoint:      m.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		m.challenge = q.Get("code_challenge")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=code&state="+url.QueryEscape(q.Get("state")), 302)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, 400)
+			return
+		}
+		claims, _ := json.Marshal(map[string]interface{}{"iss": m.URL, "sub": m.sub, "aud": "jks", "exp": time.Now().Add(time.Hour).Unix()})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(claims) + ".",
+		})
+	})
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		fmt.Fprintf(w, `{"sub":%q,"preferred_username":"alice"}`, m.userinfoSub)
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// logIn goes through the authorization code flow, as the server does.
+func logIn(p Provider) (User, error) {
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(p.Config().AuthCodeURL("state", oauth2.S256ChallengeOption(verifier)))
+	if err != nil {
+		return User{}, err
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return User{}, err
+	}
+	if callback.Query().Get("state") != "state" {
+		return User{}, fmt.Errorf("state %q", callback.Query().Get("state"))
+	}
+	token, err := p.Config().Exchange(ctx, callback.Query().Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		return User{}, err
+	}
+	return p.User(token, ctx)
+}
+
+func TestOIDC(t *testing.T) {
+	m := newMockIssuer(t)
+	p, err := DiscoverOIDC("dex", m.URL+"/", oauth2.Config{ClientID: "jks", RedirectURL: "http://jks.example/login/callback"}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := logIn(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name() != "dex:1234" || u.DisplayName != "alice" {
+		t.Fatalf("user %#v", u)
+	}
+
+	m.userinfoSub = "5678"
+	_, err = logIn(p)
+	if err == nil || !strings.Contains(err.Error(), "subject") {
+		t.Fatalf("subject mismatch: %v", err)
+	}
+
+	p.config.ClientID = "other"
+	_, err = logIn(p)
+	if err == nil || !strings.Contains(err.Error(), "audience") {
+		t.Fatalf("audience mismatch: %v", err)
+	}
+
+	_, err = DiscoverOIDC("dex", m.URL+"/dex", oauth2.Config{}, context.Background())
+	if err == nil {
+		t.Fatal("discovered a missing issuer")
+	}
+
+	for _, name := range []string{"", "local", "github", "dex:1"} {
+		_, err = DiscoverOIDC(name, m.URL+"/", oauth2.Config{}, context.Background())
+		if err == nil || !strings.Contains(err.Error(), "provider name") {
+			t.Fatalf("name %q: %v", name, err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := ReadLocal(strings.NewReader("# accounts\nalice:" + hash + "\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := l.Check("alice", "hunter2"); !ok || u.Name() != "local:alice" {
+		t.Fatalf("%#v %t", u, ok)
+	}
+	if _, ok := l.Check("alice", "hunter3"); ok {
+		t.Fatal("wrong password")
+	}
+	if _, ok := l.Check("bob", "hunter2"); ok {
+		t.Fatal("no such account")
+	}
+	_, err = ReadLocal(strings.NewReader("alice:hunter2\n"))
+	if err == nil {
+		t.Fatal("plaintext password")
+	}
+	for _, params := range []string{"m=65536,t=0,p=4", "m=65536,t=3,p=0", "m=4294967295,t=3,p=4"} {
+		_, err = ReadLocal(strings.NewReader("alice:" + strings.Replace(hash, "m=65536,t=3,p=4", params, 1) + "\n"))
+		if err == nil {
+			t.Fatalf("parameters %s", params)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Local has local accounts, which log in with a password.
+type Local struct {
+	hashes map[string]string
+}
+
+// ReadLocal reads accounts from lines of a login and its password's hash (see HashPassword), separated by a colon, like an htpasswd file.
+// Blank lines and lines starting with # are ignored.
+func ReadLocal(r io.Reader) (*Local, error) {
+	l := &Local{hashes: map[string]string{}}
+	s := bufio.NewScanner(r)
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		login, hash, ok := strings.Cut(line, ":")
+		if !ok || login == "" {
+			return nil, fmt.Errorf("line %d: must be login:hash", i)
+		}
+		_, err := parseHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i, err)
+		}
+		l.hashes[login] = hash
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Check returns the user if the password is the login's.
+func (l *Local) Check(login, password string) (User, bool) {
+	hash, ok := l.hashes[login]
+	if !ok {
+		// take as long as for a wrong password, so that logins cannot be found by timing
+		CheckPassword(dummyHash(), password)
+		return User{}, false
+	}
+	if !CheckPassword(hash, password) {
+		return User{}, false
+	}
+	return User{Provider: "local", Login: login}, true
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+const argon2Format = "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s"
+
+// maxArgon2Memory is the most memory, in KiB, a hash may need to be checked; each check allocates it.
+const maxArgon2Memory = 1 << 20
+
+// HashPassword returns the argon2id hash of password, in the PHC string format (e.g. "$argon2id$v=19$m=65536,t=3,p=4$salt$key").
+func HashPassword(password string) (string, error) {
+	p := argon2Params{memory: 64 * 1024, time: 3, threads: 4, salt: make([]byte, 16)}
+	_, err := rand.Read(p.salt)
+	if err != nil {
+		return "", err
+	}
+	p.key = argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, 32)
+	return fmt.Sprintf(argon2Format, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(p.salt), base64.RawStdEncoding.EncodeToString(p.key)), nil
+}
+
+// dummyHash is checked against for logins without accounts.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("")
+	return hash
+})
+
+// CheckPassword returns whether hash (from HashPassword) is the hash of password.
+func CheckPassword(hash, password string) bool {
+	p, err := parseHash(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+func parseHash(hash string) (argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return argon2Params{}, fmt.Errorf("unsupported argon2 version %s", parts[2])
+	}
+	var p argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil {
+		return argon2Params{}, fmt.Errorf("argon2 parameters: %w", err)
+	}
+	// argon2.IDKey panics if time or threads is 0
+	if p.time < 1 || p.threads < 1 {
+		return argon2Params{}, fmt.Errorf("argon2 parameters: t and p must be at least 1")
+	}
+	if p.memory > maxArgon2Memory {
+		return argon2Params{}, fmt.Errorf("argon2 parameters: m must be at most %d", maxArgon2Memory)
+	}
+	p.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, fmt.Errorf("salt: %w", err)
+	}
+	p.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Params{}, fmt.Errorf("key: %w", err)
+	}
+	if len(p.key) == 0 {
+		return argon2Params{}, fmt.Errorf("empty key")
+	}
+	return p, nil
+}
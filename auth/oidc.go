@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDC logs users in with an OpenID Connect provider, such as Authelia, Keycloak or Dex.
+type OIDC struct {
+	name     string
+	title    string
+	issuer   string
+	config   *oauth2.Config
+	userInfo string
+}
+
+var _ Provider = (*OIDC)(nil)
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// DiscoverOIDC returns a provider named name for the issuer, reading its endpoints from its discovery document (issuer + "/.well-known/openid-configuration").
+// config must have the client's ID, secret and redirect URL; its Endpoint is set, and its Scopes default to openid, profile and email.
+//
+// As name prefixes the names of the issuer's users (see User.Name), it must not be empty, have a colon, or be local or github; otherwise, the issuer's users could pass as local or GitHub users.
+func DiscoverOIDC(name, issuer string, config oauth2.Config, ctx context.Context) (*OIDC, error) {
+	if name == "" || strings.Contains(name, ":") || name == "local" || name == "github" {
+		return nil, fmt.Errorf("invalid provider name %q", name)
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("discovery: status code %d", resp.StatusCode)
+	}
+	var d discovery
+	err = json.NewDecoder(resp.Body).Decode(&d)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if d.Issuer != issuer {
+		return nil, fmt.Errorf("discovery: issuer is %q, not %q", d.Issuer, issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("discovery: missing endpoints")
+	}
+	config.Endpoint = oauth2.Endpoint{AuthURL: d.AuthorizationEndpoint, TokenURL: d.TokenEndpoint}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &OIDC{
+		name:     name,
+		title:    "Log in with " + name,
+		issuer:   issuer,
+		config:   &config,
+		userInfo: d.UserinfoEndpoint,
+	}, nil
+}
+
+func (o *OIDC) Name() string           { return o.name }
+func (o *OIDC) Title() string          { return o.title }
+func (o *OIDC) Config() *oauth2.Config { return o.config }
+
+// SetTitle sets the title shown on the login page.
+func (o *OIDC) SetTitle(title string) { o.title = title }
+
+type idClaims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	Expiry   int64    `json:"exp"`
+}
+
+// audience is the aud claim, which is either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+type userInfo struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+	Profile           string `json:"profile"`
+}
+
+// User returns the user of the token's ID token, with sub as the login, and the UserInfo endpoint's preferred_username as the display name.
+// preferred_username is not the login, as users can often change it, and so take the name (and the data) of another user.
+//
+// The ID token's signature is not checked, as it was received directly from the token endpoint over TLS (OpenID Connect Core 1.0, section 3.1.3.7); its issuer, audience and expiry are.
+func (o *OIDC) User(token *oauth2.Token, ctx context.Context) (User, error) {
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return User{}, fmt.Errorf("no ID token")
+	}
+	claims, err := parseIDToken(raw)
+	if err != nil {
+		return User{}, err
+	}
+	if claims.Issuer != o.issuer {
+		return User{}, fmt.Errorf("ID token: issuer is %q, not %q", claims.Issuer, o.issuer)
+	}
+	if !slices.Contains(claims.Audience, o.config.ClientID) {
+		return User{}, fmt.Errorf("ID token: audience %v does not have the client ID", claims.Audience)
+	}
+	if time.Unix(claims.Expiry, 0).Before(time.Now()) {
+		return User{}, fmt.Errorf("ID token: expired")
+	}
+	var info userInfo
+	err = getJSON(o.config.Client(ctx, token), o.userInfo, &info)
+	if err != nil {
+		return User{}, fmt.Errorf("userinfo: %w", err)
+	}
+	if info.Subject != claims.Subject {
+		return User{}, fmt.Errorf("userinfo: subject %q is not the ID token's %q", info.Subject, claims.Subject)
+	}
+	return User{Provider: o.name, Login: claims.Subject, DisplayName: info.PreferredUsername, AvatarURL: info.Picture, HTMLURL: info.Profile}, nil
+}
+
+func parseIDToken(raw string) (idClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return idClaims{}, fmt.Errorf("ID token: not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return idClaims{}, fmt.Errorf("ID token: %w", err)
+	}
+	var claims idClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return idClaims{}, fmt.Errorf("ID token: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// Passkeys logs users in with WebAuthn passkeys stored as storage.Passkey.
+// A passkey logs in as the user who registered it, whichever provider they logged in with then.
+type Passkeys struct {
+	w  *webauthn.WebAuthn
+	st storage.Storage
+}
+
+// NewPasskeys returns passkeys for the server at origin (e.g. "https://jks.example"), whose host is the relying party ID.
+func NewPasskeys(origin string, st storage.Storage) (*Passkeys, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: "jks",
+		RPOrigins:     []string{origin},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Passkeys{w: w, st: st}, nil
+}
+
+// passkeyUser is a user with their passkeys, as go-webauthn needs it.
+type passkeyUser struct {
+	u           User
+	handle      []byte
+	passkeys    []storage.Passkey
+	credentials []webauthn.Credential
+}
+
+var _ webauthn.User = (*passkeyUser)(nil)
+
+func (p *passkeyUser) WebAuthnID() []byte                         { return p.handle }
+func (p *passkeyUser) WebAuthnName() string                       { return p.u.Name() }
+func (p *passkeyUser) WebAuthnDisplayName() string                { return p.u.Name() }
+func (p *passkeyUser) WebAuthnIcon() string                       { return "" }
+func (p *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return p.credentials }
+
+// user returns u with their passkeys, and a new user handle if they have none.
+func (k *Passkeys) user(u User, ctx context.Context) (*passkeyUser, error) {
+	ps, err := k.st.Passkeys(u.Provider, u.Login, ctx)
+	if err != nil {
+		return nil, err
+	}
+	pu := &passkeyUser{u: u, passkeys: ps, credentials: make([]webauthn.Credential, len(ps))}
+	for i, p := range ps {
+		err = json.Unmarshal(p.Credential, &pu.credentials[i])
+		if err != nil {
+			return nil, fmt.Errorf("passkey %d: %w", p.ID, err)
+		}
+		pu.handle = p.UserHandle
+	}
+	if pu.handle == nil {
+		pu.handle = make([]byte, 32)
+		_, err = rand.Read(pu.handle)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pu, nil
+}
+
+// BeginRegistration returns the options for navigator.credentials.create, and the session to pass to FinishRegistration.
+func (k *Passkeys) BeginRegistration(u User, ctx context.Context) (creation *protocol.CredentialCreation, session []byte, err error) {
+	pu, err := k.user(u, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude := make([]protocol.CredentialDescriptor, len(pu.credentials))
+	for i, c := range pu.credentials {
+		exclude[i] = c.Descriptor()
+	}
+	creation, data, err := k.w.BeginRegistration(pu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclude),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err = json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return creation, session, nil
+}
+
+// FinishRegistration adds a passkey named name for u from the response to navigator.credentials.create in r's body.
+func (k *Passkeys) FinishRegistration(u User, name string, session []byte, r *http.Request, ctx context.Context) (id int64, err error) {
+	var data webauthn.SessionData
+	err = json.Unmarshal(session, &data)
+	if err != nil {
+		return 0, err
+	}
+	pu, err := k.user(u, ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(pu.handle, data.UserID) && len(pu.passkeys) != 0 {
+		return 0, errors.New("the user's passkeys changed during registration")
+	}
+	pu.handle = data.UserID
+	c, err := k.w.FinishRegistration(pu, data, r)
+	if err != nil {
+		return 0, describe(err)
+	}
+	credential, err := json.Marshal(c)
+	if err != nil {
+		return 0, err
+	}
+	return k.st.PasskeyAdd(storage.Passkey{
+		Name:         name,
+		Provider:     u.Provider,
+		Login:        u.Login,
+		UserHandle:   pu.handle,
+		CredentialID: c.ID,
+		Credential:   credential,
+		Created:      time.Now(),
+	}, ctx)
+}
+
+// BeginLogin returns the options for navigator.credentials.get, and the session to pass to FinishLogin.
+// Any passkey can be used, so the user does not have to be known.
+func (k *Passkeys) BeginLogin() (assertion *protocol.CredentialAssertion, session []byte, err error) {
+	assertion, data, err := k.w.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err = json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assertion, session, nil
+}
+
+// FinishLogin returns the user of the passkey that made the assertion in r's body (the response to navigator.credentials.get).
+func (k *Passkeys) FinishLogin(session []byte, r *http.Request, ctx context.Context) (User, error) {
+	var data webauthn.SessionData
+	err := json.Unmarshal(session, &data)
+	if err != nil {
+		return User{}, err
+	}
+	var pu *passkeyUser
+	c, err := k.w.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		p, ok, err := k.st.PasskeyByCredentialID(rawID, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || !bytes.Equal(p.UserHandle, userHandle) {
+			return nil, errors.New("no such passkey")
+		}
+		pu, err = k.user(User{Provider: p.Provider, Login: p.Login}, ctx)
+		return pu, err
+	}, data, r)
+	if err != nil {
+		return User{}, describe(err)
+	}
+	if c.Authenticator.CloneWarning {
+		return User{}, errors.New("the passkey's signature counter went back, so it may have been cloned")
+	}
+	credential, err := json.Marshal(c)
+	if err != nil {
+		return User{}, err
+	}
+	for _, p := range pu.passkeys {
+		if bytes.Equal(p.CredentialID, c.ID) {
+			err = k.st.PasskeyUsed(p.ID, credential, time.Now(), ctx)
+			if err != nil {
+				return User{}, err
+			}
+		}
+	}
+	return pu.u, nil
+}
+
+// describe adds the details of go-webauthn's errors, which are not in their messages.
+func describe(err error) error {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return fmt.Errorf("%w: %s", err, perr.DevInfo)
+	}
+	return err
+}
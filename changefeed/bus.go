@@ -0,0 +1,114 @@
+// Package changefeed publishes changes made through a storage.Storage to in-process subscribers.
+package changefeed
+
+import (
+	"sync"
+	"time"
+)
+
+type Op string
+
+const (
+	OpAdd    Op = "add"
+	OpEdit   Op = "edit"
+	OpDelete Op = "delete"
+)
+
+// Event is one add, edit or delete of a task, activity or plan.
+type Event struct {
+	// Seq increases by one for each event published on a Bus.
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+	Op   Op        `json:"op"`
+	// Entity is storage.EntityTask, storage.EntityActivity or storage.EntityPlan.
+	Entity string `json:"entity"`
+	ID     int64  `json:"id"`
+	// Value is the storage.Task, storage.Activity or storage.Plan after the change, or nil for deletions.
+	Value any `json:"value,omitempty"`
+	// Before is the value before the change, for edits and deletions.
+	Before any `json:"before,omitempty"`
+	// Owner is the owner of the entity (see storage.WithOwner); subscribers should only show events to it.
+	Owner string `json:"-"`
+}
+
+// subscriberBuffer is the number of events a subscriber may fall behind by before it is dropped.
+const subscriberBuffer = 64
+
+// Bus delivers published events to subscribers, and keeps the most recent ones so that subscribers can catch up after reconnecting.
+type Bus struct {
+	lock    sync.Mutex
+	seq     int64
+	history []Event
+	keep    int
+	subs    map[chan Event]struct{}
+}
+
+// NewBus returns a Bus that keeps the last keep events.
+func NewBus(keep int) *Bus {
+	return &Bus{keep: keep, subs: map[chan Event]struct{}{}}
+}
+
+// Seq returns the Seq of the last published event, or 0 if there is none.
+func (b *Bus) Seq() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.seq
+}
+
+// Publish assigns Seq and Time to each event and delivers them.
+// Subscribers that have fallen too far behind are dropped by closing their channel.
+func (b *Bus) Publish(events ...Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	for _, e := range events {
+		b.seq++
+		e.Seq = b.seq
+		e.Time = now
+		b.history = append(b.history, e)
+		for ch := range b.subs {
+			select {
+			case ch <- e:
+			default:
+				delete(b.subs, ch)
+				close(ch)
+			}
+		}
+	}
+	if len(b.history) > b.keep {
+		b.history = append([]Event(nil), b.history[len(b.history)-b.keep:]...)
+	}
+}
+
+// Subscribe returns the kept events after the one with Seq after, and a channel of events published from now on.
+// A negative after skips the backlog.
+// complete is false if some events after after are no longer kept; the subscriber should then reload everything it derived from earlier events.
+// cancel must be called once the subscriber is done; the channel is closed by then.
+func (b *Bus) Subscribe(after int64) (backlog []Event, complete bool, ch <-chan Event, cancel func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	complete = true
+	if after >= 0 && after < b.seq {
+		oldest := b.seq + 1
+		if len(b.history) > 0 {
+			oldest = b.history[0].Seq
+		}
+		complete = after+1 >= oldest
+		for _, e := range b.history {
+			if e.Seq > after {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	c := make(chan Event, subscriberBuffer)
+	b.subs[c] = struct{}{}
+	cancel = func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+	return backlog, complete, c, cancel
+}
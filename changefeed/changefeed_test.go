@@ -0,0 +1,79 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestSubscribeBacklog(t *testing.T) {
+	b := NewBus(2)
+	for i := int64(1); i <= 3; i++ {
+		b.Publish(Event{Op: OpAdd, Entity: storage.EntityTask, ID: i})
+	}
+	backlog, complete, _, cancel := b.Subscribe(1)
+	cancel()
+	if !complete || len(backlog) != 2 || backlog[0].Seq != 2 {
+		t.Fatalf("after 1: complete=%t backlog=%v", complete, backlog)
+	}
+	_, complete, _, cancel = b.Subscribe(0)
+	cancel()
+	if complete {
+		t.Fatal("after 0: event 1 is no longer kept, so the backlog should be incomplete")
+	}
+	backlog, complete, ch, cancel := b.Subscribe(-1)
+	defer cancel()
+	if !complete || len(backlog) != 0 {
+		t.Fatalf("after -1: complete=%t backlog=%v", complete, backlog)
+	}
+	b.Publish(Event{Op: OpDelete, Entity: storage.EntityTask, ID: 1})
+	if e := <-ch; e.Seq != 4 || e.Op != OpDelete {
+		t.Fatalf("got %#v", e)
+	}
+}
+
+func TestWrapTx(t *testing.T) {
+	ctx := context.Background()
+	b := NewBus(10)
+	st := Wrap(dbtest.Open(t), b)
+
+	_, _, ch, cancel := b.Subscribe(-1)
+	defer cancel()
+	fail := errors.New("fail")
+	err := st.WithTx(ctx, func(st storage.Storage) error {
+		_, err := st.TaskAdd(storage.Task{QuickTitle: "rolled back"}, ctx)
+		if err != nil {
+			return err
+		}
+		return fail
+	})
+	if err != fail {
+		t.Fatal(err)
+	}
+	if b.Seq() != 0 {
+		t.Fatalf("rolled back transaction published %d events", b.Seq())
+	}
+
+	err = st.WithTx(ctx, func(st storage.Storage) error {
+		id, err := st.TaskAdd(storage.Task{QuickTitle: "committed"}, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = st.ActivityAdd(storage.Activity{TaskID: id}, ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := <-ch
+	if e.Entity != storage.EntityTask || e.Value.(storage.Task).QuickTitle != "committed" {
+		t.Fatalf("got %#v", e)
+	}
+	e = <-ch
+	if e.Entity != storage.EntityActivity || e.Op != OpAdd {
+		t.Fatalf("got %#v", e)
+	}
+}
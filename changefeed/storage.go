@@ -0,0 +1,206 @@
+package changefeed
+
+import (
+	"context"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// feedStorage publishes the changes made through a storage.Storage.
+type feedStorage struct {
+	storage.Storage
+	bus *Bus
+	// pending collects the events of a WithTx, which are published once it commits.
+	// It is nil outside of WithTx.
+	pending *[]Event
+}
+
+// Wrap returns a storage.Storage that publishes each add, edit and delete made through it to bus.
+// Changes made in WithTx are published after the transaction commits, and not at all if it is rolled back.
+// Changes made to st by other means (e.g. other processes using the same database) are not published.
+func Wrap(st storage.Storage, bus *Bus) storage.Storage {
+	return &feedStorage{Storage: st, bus: bus}
+}
+
+// publish publishes e as a change of the owner of ctx.
+func (f *feedStorage) publish(e Event, ctx context.Context) {
+	e.Owner = storage.Owner(ctx)
+	if f.pending != nil {
+		*f.pending = append(*f.pending, e)
+		return
+	}
+	f.bus.Publish(e)
+}
+
+func (f *feedStorage) WithTx(ctx context.Context, fn func(st storage.Storage) error) error {
+	if f.pending != nil {
+		return f.Storage.WithTx(ctx, func(st storage.Storage) error {
+			return fn(&feedStorage{Storage: st, bus: f.bus, pending: f.pending})
+		})
+	}
+	var pending []Event
+	err := f.Storage.WithTx(ctx, func(st storage.Storage) error {
+		return fn(&feedStorage{Storage: st, bus: f.bus, pending: &pending})
+	})
+	if err != nil {
+		return err
+	}
+	f.bus.Publish(pending...)
+	return nil
+}
+
+func (f *feedStorage) ActivityAdd(a storage.Activity, ctx context.Context) (int64, error) {
+	id, err := f.Storage.ActivityAdd(a, ctx)
+	if err != nil {
+		return 0, err
+	}
+	f.publishActivity(OpAdd, id, ctx, nil)
+	return id, nil
+}
+
+func (f *feedStorage) ActivityRestore(a storage.Activity, ctx context.Context) error {
+	err := f.Storage.ActivityRestore(a, ctx)
+	if err != nil {
+		return err
+	}
+	f.publishActivity(OpAdd, a.ID, ctx, nil)
+	return nil
+}
+
+func (f *feedStorage) ActivityEdit(a storage.Activity, ctx context.Context) error {
+	before, beforeErr := f.Storage.ActivityGet(a.ID, ctx)
+	err := f.Storage.ActivityEdit(a, ctx)
+	if err != nil {
+		return err
+	}
+	f.publishActivity(OpEdit, a.ID, ctx, orNil(before, beforeErr))
+	return nil
+}
+
+// ActivityDelete also publishes edits of the plans that were fulfilled by the activity, as deleting it unlinks them.
+func (f *feedStorage) ActivityDelete(id int64, ctx context.Context) error {
+	var fulfilled []int64
+	a, beforeErr := f.Storage.ActivityGet(id, ctx)
+	if beforeErr == nil {
+		ps, err := f.Storage.TaskGetPlans(a.TaskID, 100, 0, ctx)
+		if err == nil {
+			for _, p := range ps {
+				if p.ActivityID == id {
+					fulfilled = append(fulfilled, p.ID)
+				}
+			}
+		}
+	}
+	err := f.Storage.ActivityDelete(id, ctx)
+	if err != nil {
+		return err
+	}
+	f.publish(Event{Op: OpDelete, Entity: storage.EntityActivity, ID: id, Before: orNil(a, beforeErr)}, ctx)
+	for _, planID := range fulfilled {
+		// the plans' values before are the same except for ActivityID
+		f.publishPlan(OpEdit, planID, ctx, nil)
+	}
+	return nil
+}
+
+func (f *feedStorage) PlanAdd(p storage.Plan, ctx context.Context) (int64, error) {
+	id, err := f.Storage.PlanAdd(p, ctx)
+	if err != nil {
+		return 0, err
+	}
+	f.publishPlan(OpAdd, id, ctx, nil)
+	return id, nil
+}
+
+func (f *feedStorage) PlanEdit(p storage.Plan, ctx context.Context) error {
+	before, beforeErr := f.Storage.PlanGet(p.ID, ctx)
+	err := f.Storage.PlanEdit(p, ctx)
+	if err != nil {
+		return err
+	}
+	f.publishPlan(OpEdit, p.ID, ctx, orNil(before, beforeErr))
+	return nil
+}
+
+func (f *feedStorage) TaskAdd(t storage.Task, ctx context.Context) (int64, error) {
+	id, err := f.Storage.TaskAdd(t, ctx)
+	if err != nil {
+		return 0, err
+	}
+	f.publishTask(OpAdd, id, ctx, nil)
+	return id, nil
+}
+
+func (f *feedStorage) TaskEdit(t storage.Task, ctx context.Context) error {
+	before, beforeErr := f.Storage.TaskGet(t.ID, ctx)
+	err := f.Storage.TaskEdit(t, ctx)
+	if err != nil {
+		return err
+	}
+	f.publishTask(OpEdit, t.ID, ctx, orNil(before, beforeErr))
+	return nil
+}
+
+// TaskDelete also publishes deletes of the task's plans, which are deleted with it.
+func (f *feedStorage) TaskDelete(id int64, ctx context.Context) error {
+	t, beforeErr := f.Storage.TaskGet(id, ctx)
+	ps, err := f.Storage.TaskGetPlans(id, 100, 0, ctx)
+	if err != nil {
+		ps = nil
+	}
+	err = f.Storage.TaskDelete(id, ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range ps {
+		f.publish(Event{Op: OpDelete, Entity: storage.EntityPlan, ID: p.ID, Before: p}, ctx)
+	}
+	f.publish(Event{Op: OpDelete, Entity: storage.EntityTask, ID: id, Before: orNil(t, beforeErr)}, ctx)
+	return nil
+}
+
+// TaskSetTags publishes an edit of the task, as tags are shown with it.
+func (f *feedStorage) TaskSetTags(id int64, tags []string, ctx context.Context) error {
+	before, beforeErr := f.Storage.TaskGet(id, ctx)
+	err := f.Storage.TaskSetTags(id, tags, ctx)
+	if err != nil {
+		return err
+	}
+	f.publishTask(OpEdit, id, ctx, orNil(before, beforeErr))
+	return nil
+}
+
+// orNil returns v, or nil if reading it failed.
+func orNil[T any](v T, err error) any {
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// The publish* methods read back the row, so that events carry the values as stored (e.g. with the new Version).
+// If that fails, the event is published without a value.
+
+func (f *feedStorage) publishActivity(op Op, id int64, ctx context.Context, before any) {
+	e := Event{Op: op, Entity: storage.EntityActivity, ID: id, Before: before}
+	if a, err := f.Storage.ActivityGet(id, ctx); err == nil {
+		e.Value = a
+	}
+	f.publish(e, ctx)
+}
+
+func (f *feedStorage) publishPlan(op Op, id int64, ctx context.Context, before any) {
+	e := Event{Op: op, Entity: storage.EntityPlan, ID: id, Before: before}
+	if p, err := f.Storage.PlanGet(id, ctx); err == nil {
+		e.Value = p
+	}
+	f.publish(e, ctx)
+}
+
+func (f *feedStorage) publishTask(op Op, id int64, ctx context.Context, before any) {
+	e := Event{Op: op, Entity: storage.EntityTask, ID: id, Before: before}
+	if t, err := f.Storage.TaskGet(id, ctx); err == nil {
+		e.Value = t
+	}
+	f.publish(e, ctx)
+}
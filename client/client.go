@@ -0,0 +1,216 @@
+// Package client is a client for the server's JSON API (see package api).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/export"
+	"nyiyui.ca/jks/quickcapture"
+	"nyiyui.ca/jks/storage"
+)
+
+type Client struct {
+	baseURL *url.URL
+	token   string
+	// Timezone is the IANA name of the time zone for times given without one (e.g. in Quick), or empty for the server's default.
+	Timezone string
+	HTTP     *http.Client
+}
+
+// New returns a client for the server at baseURL (e.g. "https://jks.example.com/"), authenticating with an API token.
+func New(baseURL, token string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL must be http or https")
+	}
+	return &Client{
+		baseURL: u,
+		token:   token,
+		HTTP: &http.Client{
+			Timeout: 30 * time.Second,
+			// the server redirects to its login page when not authenticated
+			CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+// Error is an error response from the server.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// send sends in (if not nil) as JSON, and returns the response if it is successful.
+func (c *Client) send(method, path string, query url.Values, in any, ctx context.Context) (*http.Response, error) {
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = query.Encode()
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("marshal: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.Timezone != "" {
+		req.Header.Set("X-Jks-Timezone", c.Timezone)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		resp.Body.Close()
+		return nil, &Error{resp.StatusCode, fmt.Sprintf("redirected to %s (is the token set?)", resp.Header.Get("Location"))}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		var e api.Error
+		if json.Unmarshal(b, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(b))
+			if e.Error == "" {
+				e.Error = resp.Status
+			}
+		}
+		return nil, &Error{resp.StatusCode, e.Error}
+	}
+	return resp, nil
+}
+
+// do sends in (if not nil) as JSON, and decodes the response into out (if not nil).
+func (c *Client) do(method, path string, query url.Values, in, out any, ctx context.Context) error {
+	resp, err := c.send(method, path, query, in, ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// Tasks returns up to limit undone tasks whose title or description contains query, or all of them if query is empty.
+func (c *Client) Tasks(query string, limit int, ctx context.Context) ([]storage.Task, error) {
+	var ts []storage.Task
+	q := url.Values{"limit": {strconv.Itoa(limit)}}
+	if query != "" {
+		q.Set("q", query)
+	}
+	err := c.do("GET", "api/tasks", q, nil, &ts, ctx)
+	return ts, err
+}
+
+func (c *Client) Task(id int64, ctx context.Context) (api.Task, error) {
+	var t api.Task
+	err := c.do("GET", fmt.Sprintf("api/tasks/%d", id), nil, nil, &t, ctx)
+	return t, err
+}
+
+func (c *Client) TaskAdd(t api.Task, ctx context.Context) (api.Task, error) {
+	var res api.Task
+	err := c.do("POST", "api/tasks", nil, t, &res, ctx)
+	return res, err
+}
+
+// Quick adds a task (and its tags and plan) described by text (see package quickcapture).
+// If preview is true, nothing is added, and the parsed result is returned.
+func (c *Client) Quick(text string, preview bool, ctx context.Context) (quickcapture.Result, error) {
+	var res quickcapture.Result
+	err := c.do("POST", "api/quick", nil, api.QuickRequest{Text: text, Preview: preview}, &res, ctx)
+	return res, err
+}
+
+// Activities returns the activities in [from, to).
+func (c *Client) Activities(from, to time.Time, ctx context.Context) ([]api.Activity, error) {
+	var as []api.Activity
+	q := url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}}
+	err := c.do("GET", "api/activities", q, nil, &as, ctx)
+	return as, err
+}
+
+// Export writes an export of the data matching f in a format of package export to w.
+func (c *Client) Export(format string, f export.Filter, w io.Writer, ctx context.Context) error {
+	q := url.Values{"format": {format}, "tag": {f.Tag}}
+	if !f.From.IsZero() {
+		q.Set("from", f.From.Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		q.Set("to", f.To.Format(time.RFC3339))
+	}
+	resp, err := c.send("GET", "api/export", q, nil, ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Range returns the activities and plans in [from, to), and the tasks they refer to.
+func (c *Client) Range(from, to time.Time, ctx context.Context) (api.Range, error) {
+	var res api.Range
+	q := url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}}
+	err := c.do("GET", "api/range", q, nil, &res, ctx)
+	return res, err
+}
+
+func (c *Client) ActivityAdd(a storage.Activity, ctx context.Context) (api.Activity, error) {
+	var res api.Activity
+	err := c.do("POST", "api/activities", nil, a, &res, ctx)
+	return res, err
+}
+
+// Current returns the activities that have started and not yet ended.
+func (c *Client) Current(ctx context.Context) ([]api.Activity, error) {
+	var as []api.Activity
+	err := c.do("GET", "api/activities/current", nil, nil, &as, ctx)
+	return as, err
+}
+
+// Start stops the current activities, and starts one.
+func (c *Client) Start(req api.StartRequest, ctx context.Context) (api.StartResponse, error) {
+	var res api.StartResponse
+	err := c.do("POST", "api/activities/start", nil, req, &res, ctx)
+	return res, err
+}
+
+// Stop ends the current activities now.
+func (c *Client) Stop(req api.StopRequest, ctx context.Context) (api.StartResponse, error) {
+	var res api.StartResponse
+	err := c.do("POST", "api/activities/stop", nil, req, &res, ctx)
+	return res, err
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/export"
+	"nyiyui.ca/jks/rdf"
+	"nyiyui.ca/jks/server"
+	"nyiyui.ca/jks/storage"
+)
+
+// newTest returns a client for a server with an empty database.
+func newTest(t *testing.T) (*Client, storage.Storage) {
+	st := dbtest.Open(t)
+	token, hash, err := storage.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.TokenAdd(storage.Token{Name: "test", Hash: hash, Created: time.Now()}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	s, err := server.New(st, nil, store, "me", rdf.NewSerializer("http://example.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	cl, err := New(ts.URL, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Timezone = "America/New_York"
+	return cl, st
+}
+
+func TestStartStop(t *testing.T) {
+	ctx := context.Background()
+	cl, _ := newTest(t)
+	res, err := cl.Quick("essay due tomorrow #school", false, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Task.ID == 0 || len(res.Tags) != 1 {
+		t.Fatalf("quick: %#v", res)
+	}
+	other, err := cl.TaskAdd(api.Task{Task: storage.Task{QuickTitle: "other"}}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started, err := cl.Start(api.StartRequest{TaskID: res.Task.ID, For: time.Hour}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.Started == nil || started.Started.Task.QuickTitle != "essay" || len(started.Stopped) != 0 {
+		t.Fatalf("start: %#v", started)
+	}
+	started, err = cl.Start(api.StartRequest{TaskID: other.ID, For: time.Hour}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(started.Stopped) != 1 || started.Stopped[0].TaskID != res.Task.ID {
+		t.Fatalf("starting another task should stop the first: %#v", started)
+	}
+	current, err := cl.Current(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 1 || current[0].TaskID != other.ID {
+		t.Fatalf("current: %#v", current)
+	}
+
+	stopped, err := cl.Stop(api.StopRequest{Done: true}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stopped.Stopped) != 1 || !stopped.Stopped[0].Done {
+		t.Fatalf("stop: %#v", stopped)
+	}
+	ts, err := cl.Tasks("", 10, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 1 || ts[0].ID != res.Task.ID {
+		t.Fatalf("undone tasks: %#v", ts)
+	}
+}
+
+func TestBadToken(t *testing.T) {
+	cl, _ := newTest(t)
+	cl.token = "jks_wrong"
+	_, err := cl.Current(context.Background())
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != 401 {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestStartPlan(t *testing.T) {
+	ctx := context.Background()
+	cl, st := newTest(t)
+	task, err := cl.TaskAdd(api.Task{Task: storage.Task{QuickTitle: "essay"}}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cl.TaskAdd(api.Task{Task: storage.Task{QuickTitle: "other"}}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	planID, err := st.PlanAdd(storage.Plan{TaskID: task.ID, TimeAtAfter: now, TimeBefore: now.Add(2 * time.Hour), DurationGe: time.Hour, DurationLt: time.Hour}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Start(api.StartRequest{TaskID: other.ID, PlanID: planID, For: time.Hour}, ctx)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != 422 {
+		t.Fatalf("starting another task's plan: %v", err)
+	}
+	res, err := cl.Start(api.StartRequest{TaskID: task.ID, PlanID: planID, For: time.Hour}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cl.Range(now.Add(-time.Minute), now.Add(3*time.Hour), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Plans) != 1 || r.Plans[0].ActivityID != res.Started.ID || len(r.Activities) != 1 || len(r.Tasks) == 0 {
+		t.Fatalf("range: %#v", r)
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	cl, _ := newTest(t)
+	_, err := cl.TaskAdd(api.Task{Task: storage.Task{QuickTitle: "essay"}, Tags: []string{"school"}}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = cl.Export("tasks-csv", export.Filter{Tag: "school"}, &b, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "id,title,description,due,deadline,tags\n1,essay,,,,school\n" {
+		t.Fatalf("got %q", b.String())
+	}
+	err = cl.Export("xml", export.Filter{}, &b, ctx)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != 422 {
+		t.Fatalf("unknown format: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	"nyiyui.ca/jks/database"
+	"nyiyui.ca/jks/rdf"
+)
+
+func main() {
+	var dbPath string
+	var baseURI string
+	var mime string
+	var dryRun bool
+	flag.StringVar(&dbPath, "db-path", "db.sqlite3", "path to database")
+	flag.StringVar(&baseURI, "base-uri", "http://127.0.0.1/", "base URI for RDF")
+	flag.StringVar(&mime, "format", "", "MIME type of the input (text/turtle or application/ld+json); guessed from the file extension if empty")
+	flag.BoolVar(&dryRun, "dry-run", false, "only print what would change")
+	flag.Usage = func() {
+		fmt.Printf("Usage of %s: [flags] path\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	inputPath := flag.Arg(0)
+	if mime == "" {
+		switch filepath.Ext(inputPath) {
+		case ".jsonld", ".json":
+			mime = "application/ld+json"
+		default:
+			mime = "text/turtle"
+		}
+	}
+
+	serializer := rdf.NewSerializer(baseURI)
+	input, err := os.Open(inputPath)
+	if err != nil {
+		log.Fatalf("open input: %s", err)
+	}
+	defer input.Close()
+	g, err := serializer.Parse(input, mime)
+	if err != nil {
+		log.Fatalf("parse input: %s", err)
+	}
+	ds, err := serializer.FromRDF(g)
+	if err != nil {
+		log.Fatalf("read input: %s", err)
+	}
+	log.Printf("read %d tasks, %d activities and %d plans.", len(ds.Tasks), len(ds.Activities), len(ds.Plans))
+
+	log.Printf("opening database...")
+	db, err := database.Open(dbPath)
+	if err != nil {
+		panic(err)
+	}
+	log.Printf("migrating database...")
+	err = database.Migrate(db.DB)
+	if err != nil && err != migrate.ErrNoChange {
+		panic(err)
+	}
+	log.Printf("database ready.")
+
+	changes, err := rdf.Import(ds, &database.Database{DB: db}, dryRun, context.Background())
+	if err != nil {
+		log.Fatalf("import: %s", err)
+	}
+	for _, change := range changes {
+		if change.Action == rdf.ActionNone {
+			continue
+		}
+		fmt.Println(change)
+	}
+	if dryRun {
+		log.Printf("dry run; nothing was changed.")
+	}
+}
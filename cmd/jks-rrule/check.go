@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/teambition/rrule-go"
+)
+
+// Problem is an error or warning about a calendar or task of an rrules file.
+type Problem struct {
+	// Name is the name of the task, "calendar " and the name of the calendar, or empty for the whole file.
+	Name    string
+	Warning bool
+	Err     error
+}
+
+func (p Problem) String() string {
+	kind := "error"
+	if p.Warning {
+		kind = "warning"
+	}
+	if p.Name == "" {
+		return fmt.Sprintf("%s: %s", kind, p.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Name, kind, p.Err)
+}
+
+// readRRules reads the rrules file at path, and the ICS files of its calendars.
+// Each calendar and task is decoded on its own, so that there is a problem for every invalid one (which is left out of the returned RRules) instead of only the first.
+// Keys that are not fields (e.g. misspelt ones) are ignored with a warning.
+// err is only returned if the file cannot be read or is not TOML at all.
+func readRRules(path string) (cfg RRules, problems []Problem, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return RRules{}, nil, err
+	}
+	var tables struct {
+		GenerateInterval int
+		Calendars        map[string]map[string]interface{}
+		Tasks            map[string]map[string]interface{}
+	}
+	err = toml.Unmarshal(raw, &tables)
+	if err != nil {
+		var de *toml.DecodeError
+		if errors.As(err, &de) {
+			row, col := de.Position()
+			return RRules{}, nil, fmt.Errorf("%s:%d:%d: %w", path, row, col, err)
+		}
+		return RRules{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.GenerateInterval = tables.GenerateInterval
+	cfg.Calendars = map[string]Calendar{}
+	cfg.Tasks = map[string]Task{}
+	for name, table := range tables.Calendars {
+		var c Calendar
+		ps := decodeTable(table, &c, "calendar "+name)
+		problems = append(problems, ps...)
+		if hasError(ps) {
+			continue
+		}
+		c, err = loadCalendar(c, filepath.Dir(path))
+		if err != nil {
+			problems = append(problems, Problem{Name: "calendar " + name, Err: err})
+			continue
+		}
+		cfg.Calendars[name] = c
+	}
+	for name, table := range tables.Tasks {
+		var t Task
+		ps := decodeTable(table, &t, name)
+		problems = append(problems, ps...)
+		if hasError(ps) {
+			continue
+		}
+		cfg.Tasks[name] = t
+	}
+	sortProblems(problems)
+	return cfg, problems, nil
+}
+
+// decodeTable decodes a table of an rrules file into v.
+func decodeTable(table map[string]interface{}, v interface{}, name string) []Problem {
+	b, err := toml.Marshal(table)
+	if err != nil {
+		return []Problem{{Name: name, Err: err}}
+	}
+	err = toml.NewDecoder(bytes.NewReader(b)).DisallowUnknownFields().Decode(v)
+	var sme *toml.StrictMissingError
+	if errors.As(err, &sme) {
+		ps := make([]Problem, len(sme.Errors))
+		for i, de := range sme.Errors {
+			ps[i] = Problem{Name: name, Warning: true, Err: fmt.Errorf("unknown key %s is ignored", strings.Join(de.Key(), "."))}
+		}
+		return ps
+	}
+	if err != nil {
+		return []Problem{{Name: name, Err: err}}
+	}
+	return nil
+}
+
+func hasError(ps []Problem) bool {
+	for _, p := range ps {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+func sortProblems(ps []Problem) {
+	sort.SliceStable(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+}
+
+// checkTask returns the problems of a task that decoded without errors: whether its rule can be made, and warnings about rules that probably do not do what was intended.
+func checkTask(name string, cfg RRules, now time.Time) []Problem {
+	t := cfg.Tasks[name]
+	_, err := t.rule(name, cfg)
+	if err != nil {
+		return []Problem{{Name: name, Err: err}}
+	}
+	var ps []Problem
+	warn := func(format string, a ...interface{}) {
+		ps = append(ps, Problem{Name: name, Warning: true, Err: fmt.Errorf(format, a...)})
+	}
+	set := (*rrule.Set)(t.RRuleSet)
+	dtstart := set.GetDTStart()
+	switch {
+	case dtstart.IsZero():
+		warn("there is no DTSTART, so the occurrences start whenever the rule is read")
+	case dtstart.Location() == time.UTC:
+		warn("DTSTART %s is in UTC, so the occurrences do not follow daylight saving time; use e.g. DTSTART;TZID=America/New_York:%s for a local time", dtstart.Format("20060102T150405Z"), dtstart.Format("20060102T150405"))
+	}
+	if r := set.GetRRule(); r != nil && !r.OrigOptions.Until.IsZero() && r.OrigOptions.Until.Before(now) {
+		warn("UNTIL %s has passed, so the rule has no more occurrences", r.OrigOptions.Until.Format(time.DateOnly))
+	}
+	if t.plan() == nil && (t.PlanLocation != "" || t.PlanTimeBeforeOffset != 0 || t.PlanDurationGe != 0 || t.PlanDurationLt != 0) {
+		warn("PlanTimeBeforeOffset is not after PlanTimeAtAfterOffset, so no plans are added")
+	}
+	return ps
+}
+
+// check prints the problems of the rrules file to w, and a table of the occurrences between from and to in loc.
+// It returns false if there are errors.
+func check(cfg RRules, problems []Problem, from, to time.Time, loc *time.Location, w io.Writer) bool {
+	names := make([]string, 0, len(cfg.Tasks))
+	for name := range cfg.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if cfg.GenerateInterval <= 0 {
+		problems = append(problems, Problem{Warning: true, Err: errors.New("GenerateInterval is not positive, so no occurrences are generated")})
+	}
+	occurrences := map[string][]time.Time{}
+	for _, name := range names {
+		ps := checkTask(name, cfg, from)
+		problems = append(problems, ps...)
+		if hasError(ps) {
+			continue
+		}
+		r, _ := cfg.Tasks[name].rule(name, cfg)
+		occurrences[name] = r.Occurrences(from, to)
+	}
+	sortProblems(problems)
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) != 0 {
+		fmt.Fprintln(w)
+	}
+	printTable(occurrences, from, to, loc, w)
+	return !hasError(problems)
+}
+
+// printTable prints the occurrences of each task between from and to as a calendar, with a column for each day of the week and a row for each occurrence.
+func printTable(occurrences map[string][]time.Time, from, to time.Time, loc *time.Location, w io.Writer) {
+	type entry struct {
+		t    time.Time
+		name string
+	}
+	days := map[string][]entry{}
+	for name, ts := range occurrences {
+		for _, t := range ts {
+			t = t.In(loc)
+			day := t.Format(time.DateOnly)
+			days[day] = append(days[day], entry{t, name})
+		}
+	}
+	for _, es := range days {
+		sort.Slice(es, func(i, j int) bool {
+			if !es[i].t.Equal(es[j].t) {
+				return es[i].t.Before(es[j].t)
+			}
+			return es[i].name < es[j].name
+		})
+	}
+
+	fmt.Fprintf(w, "occurrences from %s to %s (%s):\n", from.In(loc).Format(time.DateTime), to.In(loc).Format(time.DateTime), loc)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	from = from.In(loc)
+	// weeks start on Monday
+	week := time.Date(from.Year(), from.Month(), from.Day()-(int(from.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	for ; week.Before(to); week = week.AddDate(0, 0, 7) {
+		var cells [7][]string
+		rows := 0
+		for i := range cells {
+			day := week.AddDate(0, 0, i)
+			cells[i] = append(cells[i], day.Format("Mon 01-02"))
+			for _, e := range days[day.Format(time.DateOnly)] {
+				cells[i] = append(cells[i], e.t.Format("15:04")+" "+e.name)
+			}
+			rows = max(rows, len(cells[i]))
+		}
+		for row := range rows {
+			for i := range cells {
+				if i != 0 {
+					fmt.Fprint(tw, "\t")
+				}
+				if row < len(cells[i]) {
+					fmt.Fprint(tw, cells[i][row])
+				}
+			}
+			fmt.Fprintln(tw)
+		}
+		// keeps the columns of every week aligned, unlike an empty line
+		fmt.Fprintln(tw, "\t\t\t\t\t\t")
+	}
+	tw.Flush()
+}
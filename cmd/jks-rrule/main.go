@@ -10,33 +10,143 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"time"
 
-	"github.com/pelletier/go-toml/v2"
+	"github.com/golang-migrate/migrate/v4"
 	"github.com/teambition/rrule-go"
 	"nyiyui.ca/jks/database"
+	"nyiyui.ca/jks/recurrence"
 	"nyiyui.ca/jks/storage"
 )
 
+// Cache records where the last run started, so that occurrences between runs are generated too.
+// Generated tasks are keyed by their occurrence in the database, so the cache can be deleted at any time (generation then starts at the current time).
 type Cache struct {
 	GenerateFrom time.Time
 }
 
 type RRules struct {
 	GenerateInterval int
-	Tasks            map[string]Task
+	// Calendars are exception calendars by name, which tasks refer to in ExCalendars.
+	Calendars map[string]Calendar
+	Tasks     map[string]Task
+}
+
+// Calendar is an exception calendar, e.g. a semester's breaks.
+type Calendar struct {
+	// Ranges are ranges of days such as "2025-03-17/2025-03-21 Spring break" or "2025-01-20".
+	Ranges []DateRange
+	// ICS is the path of an iCalendar file whose events are also ranges, relative to the rrules file.
+	ICS string
+}
+
+// DateRange is a storage.DateRange written as parsed by recurrence.ParseRange.
+type DateRange storage.DateRange
+
+func (r *DateRange) UnmarshalText(text []byte) error {
+	rr, err := recurrence.ParseRange(string(text))
+	if err != nil {
+		return fmt.Errorf("parse range: %s", err)
+	}
+	*r = DateRange(rr)
+	return nil
+}
+
+// loadCalendar reads the calendar's ICS file (relative to dir) into its Ranges.
+func loadCalendar(c Calendar, dir string) (Calendar, error) {
+	if c.ICS == "" {
+		return c, nil
+	}
+	path := c.ICS
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Calendar{}, err
+	}
+	defer f.Close()
+	_, ranges, err := recurrence.ReadICS(f)
+	if err != nil {
+		return Calendar{}, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, r := range ranges {
+		c.Ranges = append(c.Ranges, DateRange(r))
+	}
+	c.ICS = ""
+	return c, nil
 }
 
 type Task struct {
-	RRuleSet              *RRuleSet
-	ExDates               []Time
-	Task                  storage.Task
+	RRuleSet *RRuleSet
+	// ExDates are excluded occurrences; they must be at the exact time of an occurrence.
+	ExDates []Time
+	// ExCalendars are the names of calendars whose ranges have no occurrences.
+	ExCalendars []string
+	Task        storage.Task
+	// A plan is added for each occurrence if PlanTimeBeforeOffset is after PlanTimeAtAfterOffset.
+	// Its window is offset from the occurrence's time, e.g. "0s" and "1h15m" for a 75-minute class.
 	PlanLocation          string
-	PlanTimeAtAfterOffset time.Duration
-	PlanTImeBeforeOffset  time.Duration
+	PlanTimeAtAfterOffset Duration
+	PlanTimeBeforeOffset  Duration
+	PlanDurationGe        Duration
+	PlanDurationLt        Duration
 	DryRun                bool
 }
 
+func (t Task) rule(name string, cfg RRules) (recurrence.Rule, error) {
+	if t.RRuleSet == nil {
+		return recurrence.Rule{}, fmt.Errorf("RRuleSet is required")
+	}
+	set := (*rrule.Set)(t.RRuleSet)
+	for _, exDate := range t.ExDates {
+		set.ExDate(time.Time(exDate))
+	}
+	r := recurrence.Rule{Key: name, Set: set, Task: t.Task, Plan: t.plan()}
+	for _, calendarName := range t.ExCalendars {
+		c, ok := cfg.Calendars[calendarName]
+		if !ok {
+			return recurrence.Rule{}, fmt.Errorf("unknown calendar %q", calendarName)
+		}
+		for _, dr := range c.Ranges {
+			r.Exceptions = append(r.Exceptions, storage.DateRange(dr))
+		}
+	}
+	return r, nil
+}
+
+// plan returns the template of the plan for each occurrence, or nil if there is none.
+func (t Task) plan() *storage.PlanTemplate {
+	if t.PlanTimeBeforeOffset <= t.PlanTimeAtAfterOffset {
+		return nil
+	}
+	return &storage.PlanTemplate{
+		Location:          t.PlanLocation,
+		TimeAtAfterOffset: time.Duration(t.PlanTimeAtAfterOffset),
+		TimeBeforeOffset:  time.Duration(t.PlanTimeBeforeOffset),
+		DurationGe:        time.Duration(t.PlanDurationGe),
+		DurationLt:        time.Duration(t.PlanDurationLt),
+	}
+}
+
+// Duration is a time.Duration written as a string (e.g. "1h15m"), or as an integer of nanoseconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	if ns, err := strconv.ParseInt(string(text), 10, 64); err == nil {
+		*d = Duration(ns)
+		return nil
+	}
+	dd, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("parse duration: %s", err)
+	}
+	*d = Duration(dd)
+	return nil
+}
+
 type Time time.Time
 
 func (t *Time) UnmarshalText(text []byte) error {
@@ -83,11 +193,39 @@ func main() {
 	var dbPath string
 	var rrulesPath string
 	var cachePath string
+	var reconcile, apply, checkOnly bool
+	var tz string
 	flag.StringVar(&dbPath, "db-path", "db.sqlite3", "path to database")
 	flag.StringVar(&rrulesPath, "rrules-path", "jks-rrules.toml", "path to rrules")
 	flag.StringVar(&cachePath, "cache-path", filepath.Join(getCacheDir(), "jks-rrule-cache.json"), "path to cache")
+	flag.BoolVar(&reconcile, "reconcile", false, "print how future occurrences would be added, edited and removed to match the rules, instead of generating them")
+	flag.BoolVar(&apply, "apply", false, "with -reconcile, make the printed changes")
+	flag.BoolVar(&checkOnly, "check", false, "check the rrules for errors and print their occurrences, without opening the database")
+	flag.StringVar(&tz, "tz", "Local", "with -check, time zone to print occurrences in")
 	flag.Parse()
 
+	cfg, problems, err := readRRules(rrulesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if checkOnly {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatalf("-tz: %s", err)
+		}
+		now := time.Now()
+		if !check(cfg, problems, now, now.Add(time.Duration(cfg.GenerateInterval)*24*time.Hour), loc, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	for _, p := range problems {
+		log.Print(p)
+	}
+	if hasError(problems) {
+		log.Fatal("the rrules have errors; run with -check for details")
+	}
+
 	cacheRaw, err := os.OpenFile(cachePath, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		panic(err)
@@ -101,36 +239,55 @@ func main() {
 		panic(err)
 	}
 
-	rrulesRaw, err := os.ReadFile(rrulesPath)
-	if err != nil {
-		panic(err)
-	}
-	var cfg RRules
-	err = toml.Unmarshal(rrulesRaw, &cfg)
-	if err != nil {
-		panic(err)
-	}
-
 	log.Printf("opening database...")
 	db, err := database.Open(dbPath)
 	if err != nil {
 		panic(err)
 	}
 	log.Printf("migrating database...")
-	database.Migrate(db.DB)
-	if err != nil {
+	err = database.Migrate(db.DB)
+	if err != nil && err != migrate.ErrNoChange {
 		panic(err)
 	}
 	log.Printf("database ready.")
 
-	generateTo := time.Now().Add(time.Duration(cfg.GenerateInterval) * 24 * time.Hour)
+	now := time.Now()
+	generateTo := now.Add(time.Duration(cfg.GenerateInterval) * 24 * time.Hour)
+	if reconcile {
+		names := make([]string, 0, len(cfg.Tasks))
+		for name := range cfg.Tasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			changes, err := reconcileTask(name, &database.Database{DB: db}, cfg, now, generateTo, apply)
+			if err != nil {
+				log.Fatalf("%s: %s", name, err)
+			}
+			for _, change := range changes {
+				if change.Action != recurrence.ActionNone {
+					fmt.Printf("%s: %s\n", name, change)
+				}
+			}
+		}
+		if !apply {
+			fmt.Println("nothing was changed; run again with -apply to make these changes.")
+		}
+		return
+	}
+
+	generateFrom := cache.GenerateFrom
+	if generateFrom.After(now) {
+		// caches written by older versions hold the end of the last run
+		generateFrom = now
+	}
 	for name := range cfg.Tasks {
-		err := createForTask(name, &database.Database{db}, cfg, cache, cache.GenerateFrom, generateTo)
+		err := createForTask(name, &database.Database{DB: db}, cfg, generateFrom, generateTo)
 		if err != nil {
 			panic(err)
 		}
 	}
-	cache.GenerateFrom = generateTo
+	cache.GenerateFrom = now
 	log.Printf("writing to cache...")
 	err = cacheRaw.Truncate(0)
 	if err != nil {
@@ -147,28 +304,39 @@ func main() {
 	log.Printf("wrote to cache.")
 }
 
-func createForTask(name string, st storage.Storage, cfg RRules, cache Cache, generateFrom, generateTo time.Time) error {
+// createForTask adds a task for each occurrence of the rule between generateFrom and generateTo.
+// Occurrences generated before are not added again; their tasks are edited to match the rule instead.
+func createForTask(name string, st storage.Storage, cfg RRules, generateFrom, generateTo time.Time) error {
 	log.Printf("createForTask %s - %s → %s", name,
 		generateFrom, generateTo)
 	taskCfg := cfg.Tasks[name]
-	set := (*rrule.Set)(taskCfg.RRuleSet)
-	for _, exDate := range taskCfg.ExDates {
-		set.ExDate(time.Time(exDate))
+	rule, err := taskCfg.rule(name, cfg)
+	if err != nil {
+		return err
 	}
-	times := set.Between(generateFrom, generateTo, true)
-	for i, t := range times {
-		task := taskCfg.Task
-		task.Due = &t
-		task.Deadline = &t
-		if taskCfg.DryRun {
-			log.Printf("[%s.%d] dry run for task at %s", name, i, t.Local())
+	changes, err := recurrence.Generate(rule, st, generateFrom, generateTo, taskCfg.DryRun, context.Background())
+	if err != nil {
+		return err
+	}
+	for i, change := range changes {
+		if change.Action == recurrence.ActionNone {
 			continue
 		}
-		log.Printf("[%s.%d] generated task at %s.", name, i, t)
-		_, err := st.TaskAdd(task, context.Background())
-		if err != nil {
-			return fmt.Errorf("add for %s: %w", t, err)
+		if taskCfg.DryRun {
+			log.Printf("[%s.%d] dry run: %s", name, i, change)
+			continue
 		}
+		log.Printf("[%s.%d] %s", name, i, change)
 	}
 	return nil
 }
+
+// reconcileTask returns the changes that make the rule's occurrences between from and to match it, and makes them if apply is true (and the rule is not a dry run).
+func reconcileTask(name string, st storage.Storage, cfg RRules, from, to time.Time, apply bool) ([]recurrence.Change, error) {
+	taskCfg := cfg.Tasks[name]
+	rule, err := taskCfg.rule(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return recurrence.Reconcile(rule, st, from, to, !apply || taskCfg.DryRun, context.Background())
+}
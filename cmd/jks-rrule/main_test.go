@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestCreateForTaskIdempotent(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+
+	var cfg RRules
+	err := toml.Unmarshal([]byte(`
+[Tasks.standup]
+RRuleSet = "DTSTART:20250106T090000Z\nRRULE:FREQ=DAILY;COUNT=3"
+Task.QuickTitle = "standup"
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	count := func() int {
+		w, err := st.TaskSearch("", time.Time{}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		ts, err := w.Get(100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(ts)
+	}
+	for range 2 {
+		err = createForTask("standup", st, cfg, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := count(); n != 3 {
+			t.Fatalf("%d tasks", n)
+		}
+	}
+
+	task := cfg.Tasks["standup"]
+	task.Task.QuickTitle = "daily standup"
+	cfg.Tasks["standup"] = task
+	err = createForTask("standup", st, cfg, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("%d tasks after editing the rule", n)
+	}
+	o, ok, err := st.OccurrenceGet("standup", time.Date(2025, 1, 7, 9, 0, 0, 0, time.UTC), ctx)
+	if err != nil || !ok {
+		t.Fatalf("occurrence: %v %v", ok, err)
+	}
+	got, err := st.TaskGet(o.TaskID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (storage.Task{ID: o.TaskID, QuickTitle: "daily standup", Due: got.Due, Deadline: got.Deadline}); len(storage.ChangedFields(got, want)) != 0 || !got.Due.Equal(o.Time) {
+		t.Fatalf("task %#v", got)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+
+	// PlanTImeBeforeOffset is how older configurations spell it
+	var cfg RRules
+	err := toml.Unmarshal([]byte(`
+[Tasks.lecture]
+RRuleSet = "DTSTART:20250106T143000Z\nRRULE:FREQ=WEEKLY;COUNT=2"
+Task.QuickTitle = "lecture"
+PlanLocation = "Klaus 1443"
+PlanTimeAtAfterOffset = "-5m"
+PlanTImeBeforeOffset = "1h15m"
+PlanDurationGe = "1h15m"
+PlanDurationLt = 4800000000000
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	for range 2 {
+		err = createForTask("lecture", st, cfg, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := st.PlanRange(from, to, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ps, err := w.Get(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("%d plans", len(ps))
+	}
+	p := ps[0]
+	if p.Location != "Klaus 1443" || !p.TimeAtAfter.Equal(time.Date(2025, 1, 6, 14, 25, 0, 0, time.UTC)) || !p.TimeBefore.Equal(time.Date(2025, 1, 6, 15, 45, 0, 0, time.UTC)) || p.DurationGe != 75*time.Minute || p.DurationLt != 80*time.Minute {
+		t.Fatalf("plan %#v", p)
+	}
+}
+
+func TestExCalendars(t *testing.T) {
+	dir := t.TempDir()
+	st := dbtest.Open(t)
+
+	err := os.WriteFile(filepath.Join(dir, "breaks.ics"), []byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Spring break\r\nDTSTART;VALUE=DATE:20250317\r\nDTEND;VALUE=DATE:20250322\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "jks-rrules.toml")
+	err = os.WriteFile(path, []byte(`
+[Calendars.breaks]
+Ranges = ["2025-03-10 Reading day"]
+ICS = "breaks.ics"
+
+[Tasks.lecture]
+RRuleSet = "DTSTART:20250303T143000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=8"
+ExCalendars = ["breaks"]
+Task.QuickTitle = "lecture"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, problems, err := readRRules(path)
+	if err != nil || len(problems) != 0 {
+		t.Fatal(problems, err)
+	}
+	r, err := cfg.Tasks["lecture"].rule("lecture", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 03-10, 03-17 and 03-19 are skipped
+	ts := r.Occurrences(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	if len(ts) != 5 {
+		t.Fatalf("occurrences %v", ts)
+	}
+	err = createForTask("lecture", st, cfg, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err := st.OccurrenceGet("lecture", time.Date(2025, 3, 17, 14, 30, 0, 0, time.UTC), context.Background())
+	if err != nil || ok {
+		t.Fatalf("occurrence in spring break: %v %v", ok, err)
+	}
+
+	task := cfg.Tasks["lecture"]
+	task.ExCalendars = []string{"winter"}
+	cfg.Tasks["lecture"] = task
+	_, err = task.rule("lecture", cfg)
+	if err == nil {
+		t.Fatal("unknown calendar")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jks-rrules.toml")
+	err := os.WriteFile(path, []byte(`
+GenerateInterval = 14
+
+[Calendars.breaks]
+Ranges = ["2025-03-10/2025-03-09"]
+
+[Tasks.broken]
+RRuleSet = "DTSTART:20250303T143000Z\nRRULE:FREQ=SOMETIMES"
+Task.QuickTitle = "broken"
+
+[Tasks.ended]
+RRuleSet = "DTSTART;TZID=America/New_York:20250106T093000\nRRULE:FREQ=DAILY;UNTIL=20250110T000000Z"
+Task.QuickTitle = "ended"
+
+[Tasks.lecture]
+RRuleSet = "DTSTART:20250303T143000Z\nRRULE:FREQ=WEEKLY;BYDAY=MO,WE"
+ExCalendars = ["breaks"]
+Task.QuickTitle = "lecture"
+
+[Tasks.standup]
+RRuleSet = "DTSTART;TZID=America/New_York:20250303T090000\nRRULE:FREQ=DAILY"
+Task.QuickTitle = "standup"
+Task.QuikTitle = "typo"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, problems, err := readRRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, 3, 4, 0, 0, 0, 0, loc)
+	var out strings.Builder
+	if check(cfg, problems, from, from.AddDate(0, 0, 14), loc, &out) {
+		t.Fatal("check passed")
+	}
+	t.Log(out.String())
+	for _, want := range []string{
+		"broken: error: ",
+		"calendar breaks: error: ",
+		"ended: warning: UNTIL 2025-01-10 has passed",
+		`lecture: error: unknown calendar "breaks"`,
+		"standup: warning: unknown key Task.QuikTitle is ignored",
+		"Mon 03-17",
+		"09:00 standup",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no %q", want)
+		}
+	}
+	if strings.Contains(out.String(), "standup: error") || strings.Contains(out.String(), "lecture: warning") {
+		t.Error("unexpected problems")
+	}
+}
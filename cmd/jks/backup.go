@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"nyiyui.ca/jks/database"
+)
+
+func init() {
+	commands["backup"] = command{"write a snapshot of the database while it is in use", runBackup}
+	commands["restore"] = command{"replace the database with a snapshot (stop the server first)", runRestore}
+}
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	var dbPath string
+	var dir string
+	var retention database.Retention
+	fs.StringVar(&dbPath, "db-path", "db.sqlite3", "path to database")
+	fs.StringVar(&dir, "dir", "backups", "directory to write snapshots to")
+	fs.IntVar(&retention.Last, "keep-last", 10, "number of most recent snapshots to keep")
+	fs.IntVar(&retention.Daily, "keep-daily", 30, "number of days to keep the newest snapshot of")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// opening a missing database creates an empty one, whose snapshots would rotate the real ones away
+	_, err = os.Stat(dbPath)
+	if err != nil {
+		return err
+	}
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	path, err := database.Snapshot(context.Background(), db, dir)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	log.Printf("wrote snapshot %s.", path)
+	deleted, err := database.RotateSnapshots(dir, retention)
+	if err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	for _, path := range deleted {
+		log.Printf("deleted snapshot %s.", path)
+	}
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	var dbPath string
+	fs.StringVar(&dbPath, "db-path", "db.sqlite3", "path to database")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of restore: [flags] snapshot\n")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	replaced, err := database.Restore(fs.Arg(0), dbPath)
+	if err != nil {
+		return err
+	}
+	if replaced != "" {
+		log.Printf("previous database moved to %s.", replaced)
+	}
+	log.Printf("restored %s to %s.", fs.Arg(0), dbPath)
+	return nil
+}
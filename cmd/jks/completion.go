@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"nyiyui.ca/jks/export"
+	"nyiyui.ca/jks/importer"
+)
+
+func init() {
+	commands["completion"] = command{"print a shell completion script (bash, zsh or fish), e.g. source <(jks completion bash)", runCompletion}
+	commands["__complete"] = command{"", runComplete}
+}
+
+const bashCompletion = `_jks() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	local IFS=$'\n'
+	COMPREPLY=($(compgen -W "$(jks __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null)" -- "$cur"))
+}
+complete -F _jks jks
+`
+
+const zshCompletion = `#compdef jks
+_jks() {
+	local -a candidates
+	candidates=("${(@f)$(jks __complete "${(@)words[2,CURRENT-1]}" 2>/dev/null)}")
+	compadd -a candidates
+}
+compdef _jks jks
+`
+
+const fishCompletion = `complete -c jks -f -a '(jks __complete (commandline -opc)[2..-1] 2>/dev/null)'
+`
+
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: completion bash|zsh|fish")
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return fmt.Errorf("unknown shell %q", args[0])
+	}
+	return nil
+}
+
+// taskCommands are the commands that take a task as arguments.
+var taskCommands = map[string]bool{"start": true, "log": true}
+
+// runComplete prints the candidates for the word after args (the words typed so far, without "jks"), one per line.
+func runComplete(args []string) error {
+	if len(args) == 0 {
+		var names []string
+		for name, cmd := range commands {
+			if cmd.usage != "" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		fmt.Println(strings.Join(names, "\n"))
+		return nil
+	}
+	switch {
+	case args[0] == "completion" && len(args) == 1:
+		fmt.Println("bash\nzsh\nfish")
+	case args[0] == "export" && args[len(args)-1] == "-format":
+		fmt.Println(strings.Join(export.FormatNames(), "\n"))
+	case args[0] == "import" && args[len(args)-1] == "-format":
+		var names []string
+		for name := range importer.Readers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println(strings.Join(names, "\n"))
+	case taskCommands[args[0]]:
+		cl, _, err := newClient()
+		if err != nil {
+			return err
+		}
+		ts, err := cl.Tasks("", maxTasks, context.Background())
+		if err != nil {
+			return err
+		}
+		for _, t := range ts {
+			// one word per task, so that the title is completed as a whole
+			fmt.Println(t.ID)
+			fmt.Println(t.QuickTitle)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"nyiyui.ca/jks/client"
+)
+
+func init() {
+	commands["login"] = command{"save the server URL and API token (from the server's Tokens page) to the config file", runLogin}
+}
+
+// config is read from $XDG_CONFIG_HOME/jks/config.toml.
+// JKS_SERVER and JKS_TOKEN override server and token.
+type config struct {
+	Server string `toml:"server"`
+	Token  string `toml:"token"`
+	// Timezone is the IANA name of the time zone for parsing and showing times; empty for the local time zone.
+	Timezone string `toml:"timezone,omitempty"`
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jks", "config.toml"), nil
+}
+
+func loadConfig() (config, error) {
+	var c config
+	path, err := configPath()
+	if err != nil {
+		return config{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return config{}, err
+	}
+	err = toml.Unmarshal(data, &c)
+	if err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if v := os.Getenv("JKS_SERVER"); v != "" {
+		c.Server = v
+	}
+	if v := os.Getenv("JKS_TOKEN"); v != "" {
+		c.Token = v
+	}
+	return c, nil
+}
+
+// location returns the time zone for parsing and showing times.
+func (c config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// newClient returns a client configured by the config file.
+func newClient() (*client.Client, *time.Location, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+	if c.Server == "" {
+		return nil, nil, fmt.Errorf("no server configured; run jks login")
+	}
+	loc, err := c.location()
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: timezone: %w", err)
+	}
+	cl, err := client.New(c.Server, c.Token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if loc != time.Local {
+		cl.Timezone = loc.String()
+	} else if tz := localTimezone(); tz != "" {
+		cl.Timezone = tz
+	}
+	return cl, loc, nil
+}
+
+// localTimezone returns the IANA name of the local time zone, or "" if unknown.
+func localTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" {
+		return tz
+	}
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	// e.g. /usr/share/zoneinfo/America/New_York
+	for dir := filepath.Dir(target); dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == "zoneinfo" {
+			rel, err := filepath.Rel(dir, target)
+			if err != nil {
+				return ""
+			}
+			return rel
+		}
+	}
+	return ""
+}
+
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	var c config
+	fs.StringVar(&c.Server, "server", "", "server URL, e.g. https://jks.example.com/")
+	fs.StringVar(&c.Token, "token", "", "API token")
+	fs.StringVar(&c.Timezone, "timezone", "", "IANA time zone (default local)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if c.Server == "" || c.Token == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	cl, err := client.New(c.Server, c.Token)
+	if err != nil {
+		return err
+	}
+	_, err = cl.Current(context.Background())
+	if err != nil {
+		return fmt.Errorf("checking token: %w", err)
+	}
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := toml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// the token is a secret
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s.\n", path)
+	return nil
+}
+
+// printJSON prints v as indented JSON, for the -json flag of each command.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
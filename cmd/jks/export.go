@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"nyiyui.ca/jks/export"
+)
+
+func init() {
+	commands["export"] = command{"export tasks, activities and plans as CSV, JSON Lines, Org-mode or timeclock", runExport}
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var format, from, to, output string
+	var f export.Filter
+	fs.StringVar(&format, "format", "", "one of "+strings.Join(export.FormatNames(), ", "))
+	fs.StringVar(&from, "from", "", "export activities and plans from this date (2006-01-02) or RFC 3339 time")
+	fs.StringVar(&to, "to", "", "export activities and plans until this date (inclusive) or RFC 3339 time (exclusive)")
+	fs.StringVar(&f.Tag, "tag", "", "export only tasks with this tag")
+	fs.StringVar(&output, "o", "", "file to write to (default stdout)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if _, ok := export.Formats[format]; !ok {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	f.From, err = export.ParseBound(from, loc, false)
+	if err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	f.To, err = export.ParseBound(to, loc, true)
+	if err != nil {
+		return fmt.Errorf("-to: %w", err)
+	}
+	w := os.Stdout
+	if output != "" {
+		w, err = os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	err = cl.Export(format, f, w, context.Background())
+	if err != nil {
+		return err
+	}
+	if output != "" {
+		return w.Close()
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"nyiyui.ca/jks/client"
+	"nyiyui.ca/jks/storage"
+)
+
+// fuzzyScore scores how well pattern matches s: each character of pattern must appear in s in order (ignoring case and spaces).
+// Matches at the start of words and consecutive matches score higher, and containing pattern as-is scores highest.
+func fuzzyScore(pattern, s string) (score int, ok bool) {
+	pattern = strings.ToLower(strings.ReplaceAll(pattern, " ", ""))
+	lower := []rune(strings.ToLower(s))
+	if pattern == "" {
+		return 0, true
+	}
+	if strings.Contains(string(lower), pattern) {
+		score += 100
+	}
+	i := 0
+	prev := -2
+	for _, p := range pattern {
+		for i < len(lower) && lower[i] != p {
+			i++
+		}
+		if i == len(lower) {
+			return 0, false
+		}
+		score++
+		if i == prev+1 {
+			score += 5
+		}
+		if i == 0 || !unicode.IsLetter(lower[i-1]) && !unicode.IsDigit(lower[i-1]) {
+			score += 10
+		}
+		prev = i
+		i++
+	}
+	return score, true
+}
+
+type fuzzyMatch struct {
+	task  storage.Task
+	score int
+}
+
+func fuzzyMatches(pattern string, ts []storage.Task) []fuzzyMatch {
+	var ms []fuzzyMatch
+	for _, t := range ts {
+		if score, ok := fuzzyScore(pattern, t.QuickTitle); ok {
+			ms = append(ms, fuzzyMatch{t, score})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].score != ms[j].score {
+			return ms[i].score > ms[j].score
+		}
+		// prefer shorter titles among equal matches
+		return len(ms[i].task.QuickTitle) < len(ms[j].task.QuickTitle)
+	})
+	return ms
+}
+
+// maxTasks is the number of undone tasks fetched for fuzzy selection.
+const maxTasks = 1000
+
+// selectTask returns the task args refer to: a task ID, or words fuzzily matching the title of an undone task.
+// If several tasks match equally well, the user is asked to choose (or an error is returned if stdin is not a terminal).
+func selectTask(cl *client.Client, args []string, ctx context.Context) (storage.Task, error) {
+	if len(args) == 0 {
+		return storage.Task{}, fmt.Errorf("no task given")
+	}
+	if len(args) == 1 {
+		if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+			t, err := cl.Task(id, ctx)
+			return t.Task, err
+		}
+	}
+	pattern := strings.Join(args, " ")
+	ts, err := cl.Tasks("", maxTasks, ctx)
+	if err != nil {
+		return storage.Task{}, err
+	}
+	ms := fuzzyMatches(pattern, ts)
+	if len(ms) == 0 {
+		return storage.Task{}, fmt.Errorf("no undone task matches %q (add one with jks add)", pattern)
+	}
+	// an exact title match, or a clear winner
+	if strings.EqualFold(ms[0].task.QuickTitle, pattern) || len(ms) == 1 || ms[0].score > ms[1].score {
+		return ms[0].task, nil
+	}
+	if len(ms) > 10 {
+		ms = ms[:10]
+	}
+	if !isTerminal(os.Stdin) {
+		var titles []string
+		for _, m := range ms {
+			titles = append(titles, fmt.Sprintf("%d (%s)", m.task.ID, m.task.QuickTitle))
+		}
+		return storage.Task{}, fmt.Errorf("%q is ambiguous: %s", pattern, strings.Join(titles, ", "))
+	}
+	for i, m := range ms {
+		fmt.Fprintf(os.Stderr, "%d) %s\n", i+1, m.task.QuickTitle)
+	}
+	fmt.Fprintf(os.Stderr, "task [1]: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return storage.Task{}, fmt.Errorf("reading choice: %w", err)
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return ms[0].task, nil
+	}
+	i, err := strconv.Atoi(line)
+	if err != nil || i < 1 || i > len(ms) {
+		return storage.Task{}, fmt.Errorf("invalid choice %q", line)
+	}
+	return ms[i-1].task, nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func TestFuzzyMatches(t *testing.T) {
+	ts := []storage.Task{
+		{ID: 1, QuickTitle: "CS2110 hw3"},
+		{ID: 2, QuickTitle: "CS2110 hw4"},
+		{ID: 3, QuickTitle: "groceries"},
+		{ID: 4, QuickTitle: "hw3 review session"},
+	}
+	ms := fuzzyMatches("cs hw3", ts)
+	if len(ms) != 1 || ms[0].task.ID != 1 {
+		t.Fatalf("cs hw3: %v", ms)
+	}
+	ms = fuzzyMatches("hw3", ts)
+	if ms[0].task.ID != 1 || ms[0].score != ms[1].score {
+		// "CS2110 hw3" is shorter than "hw3 review session", and both contain "hw3" at a word start
+		t.Fatalf("hw3: %v", ms)
+	}
+	if ms := fuzzyMatches("xyz", ts); len(ms) != 0 {
+		t.Fatalf("xyz: %v", ms)
+	}
+}
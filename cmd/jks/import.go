@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+
+	"nyiyui.ca/jks/database"
+	"nyiyui.ca/jks/importer"
+)
+
+func init() {
+	commands["import"] = command{"import time tracked in Toggl (CSV export), Timewarrior (data files) or Org-mode (CLOCK lines)", runImport}
+}
+
+// importFiles are the files read from a directory given to jks import, by format.
+var importFiles = map[string]string{
+	"toggl":       "*.csv",
+	"timewarrior": "[0-9][0-9][0-9][0-9]-[0-9][0-9].data",
+	"org":         "*.org",
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var dbPath, format, mappingPath, timezone string
+	var dryRun bool
+	fs.StringVar(&dbPath, "db-path", "db.sqlite3", "path to database")
+	fs.StringVar(&format, "format", "", "format of the input: toggl, timewarrior or org")
+	fs.StringVar(&mappingPath, "mapping", "", "TOML file assigning titles to task IDs, e.g. [Tasks] \"meetings\" = 12")
+	fs.StringVar(&timezone, "timezone", "", "IANA time zone of times written without one (default local)")
+	fs.BoolVar(&dryRun, "dry-run", false, "only print what would change")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of import: [flags] path...\nDirectories are searched for files of the format (e.g. Timewarrior's data directory).\n")
+		fs.PrintDefaults()
+	}
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	read, ok := importer.Readers[format]
+	if !ok || len(paths) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	loc := time.Local
+	if timezone != "" {
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("-timezone: %w", err)
+		}
+	}
+	var m importer.Mapping
+	if mappingPath != "" {
+		m, err = importer.LoadMapping(mappingPath)
+		if err != nil {
+			return fmt.Errorf("mapping: %w", err)
+		}
+	}
+
+	var entries []importer.Entry
+	for _, path := range paths {
+		files := []string{path}
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			files, err = filepath.Glob(filepath.Join(path, importFiles[format]))
+			if err != nil {
+				return err
+			}
+			sort.Strings(files)
+		}
+		for _, file := range files {
+			es, err := readImportFile(file, read, loc)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, es...)
+		}
+	}
+	log.Printf("read %d entries.", len(entries))
+
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	err = database.Migrate(db.DB)
+	if err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	changes, err := importer.Import(format, entries, m, &database.Database{DB: db}, dryRun, context.Background())
+	if err != nil {
+		return err
+	}
+	counts := map[importer.Action]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+		if change.Action == importer.ActionNone {
+			continue
+		}
+		fmt.Println(change)
+	}
+	var summary []string
+	for _, c := range []struct {
+		action importer.Action
+		name   string
+	}{{importer.ActionAdd, "added"}, {importer.ActionEdit, "edited"}, {importer.ActionMatch, "matched"}, {importer.ActionNone, "unchanged"}} {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[c.action], c.name))
+	}
+	log.Printf("%s.", strings.Join(summary, ", "))
+	if dryRun {
+		log.Printf("dry run; nothing was changed.")
+	}
+	return nil
+}
+
+func readImportFile(path string, read importer.Reader, loc *time.Location) ([]importer.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := read(f, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/storage"
+)
+
+func init() {
+	commands["add"] = command{`add a task described in one line, e.g. "hw3 due fri 23:59 @library ~2h #cs"`, runAdd}
+	commands["today"] = command{"list today's activities", runToday}
+	commands["undone"] = command{"list undone tasks", runUndone}
+	commands["search"] = command{"search undone tasks by fuzzy title", runSearch}
+}
+
+func formatOptional(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return "-"
+	}
+	return t.In(loc).Format("Mon 01-02 15:04")
+}
+
+func printTasks(ts []storage.Task, loc *time.Location) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tTITLE\tDUE\tDEADLINE\n")
+	for _, t := range ts {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.QuickTitle, formatOptional(t.Due, loc), formatOptional(t.Deadline, loc))
+	}
+	return w.Flush()
+}
+
+func runAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	var preview, asJSON bool
+	fs.BoolVar(&preview, "preview", false, "only show what would be added")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of add: [flags] description...\n")
+		fs.PrintDefaults()
+	}
+	words, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	res, err := cl.Quick(strings.Join(words, " "), preview, context.Background())
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(res)
+	}
+	if preview {
+		fmt.Printf("would add %s\n", res.Task.QuickTitle)
+	} else {
+		fmt.Printf("added %d %s\n", res.Task.ID, res.Task.QuickTitle)
+	}
+	if res.Task.Due != nil {
+		fmt.Printf("  due %s\n", formatOptional(res.Task.Due, loc))
+	}
+	if res.Task.Deadline != nil {
+		fmt.Printf("  deadline %s\n", formatOptional(res.Task.Deadline, loc))
+	}
+	if len(res.Tags) > 0 {
+		fmt.Printf("  tags %s\n", strings.Join(res.Tags, ", "))
+	}
+	if p := res.Plan; p != nil {
+		fmt.Printf("  plan %s to %s", formatOptional(&p.TimeAtAfter, loc), formatOptional(&p.TimeBefore, loc))
+		if p.Location != "" {
+			fmt.Printf(" at %s", p.Location)
+		}
+		if p.DurationGe != 0 {
+			fmt.Printf(" for %s to %s", p.DurationGe, p.DurationLt)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func runToday(args []string) error {
+	fs := flag.NewFlagSet("today", flag.ContinueOnError)
+	var asJSON bool
+	var delta int
+	fs.IntVar(&delta, "days", 0, "days relative to today (e.g. -1 for yesterday)")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day()+delta, 0, 0, 0, 0, loc)
+	as, err := cl.Activities(from, from.AddDate(0, 0, 1), context.Background())
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if as == nil {
+			as = []api.Activity{}
+		}
+		return printJSON(as)
+	}
+	sort.Slice(as, func(i, j int) bool { return as[i].TimeStart.Before(as[j].TimeStart) })
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	var total time.Duration
+	for _, a := range as {
+		var marks []string
+		if !a.TimeStart.After(now) && a.TimeEnd.After(now) {
+			marks = append(marks, "running")
+		}
+		if a.Done {
+			marks = append(marks, "done")
+		}
+		if a.Location != "" {
+			marks = append(marks, "@"+a.Location)
+		}
+		fmt.Fprintf(w, "%s–%s\t%s\t%s\t%s\n", a.TimeStart.In(loc).Format("15:04"), a.TimeEnd.In(loc).Format("15:04"), a.Task.QuickTitle, strings.Join(marks, " "), a.Note)
+		total += a.TimeEnd.Sub(a.TimeStart)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("total %s\n", total)
+	return nil
+}
+
+func runUndone(args []string) error {
+	fs := flag.NewFlagSet("undone", flag.ContinueOnError)
+	var asJSON bool
+	var limit int
+	fs.IntVar(&limit, "n", 100, "maximum number of tasks")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	ts, err := cl.Tasks("", limit, context.Background())
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(ts)
+	}
+	return printTasks(ts, loc)
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	var asJSON bool
+	var limit int
+	fs.IntVar(&limit, "n", 20, "maximum number of tasks")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of search: [flags] query...\n")
+		fs.PrintDefaults()
+	}
+	words, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	all, err := cl.Tasks("", maxTasks, context.Background())
+	if err != nil {
+		return err
+	}
+	ts := []storage.Task{}
+	for _, m := range fuzzyMatches(strings.Join(words, " "), all) {
+		if len(ts) == limit {
+			break
+		}
+		ts = append(ts, m.task)
+	}
+	if asJSON {
+		return printJSON(ts)
+	}
+	return printTasks(ts, loc)
+}
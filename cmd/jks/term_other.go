@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var resizeSignals []os.Signal
+
+var errNoTerminal = errors.New("the terminal UI is not supported on this platform")
+
+func makeRaw(f *os.File) (restore func() error, err error) {
+	return nil, errNoTerminal
+}
+
+func terminalSize(f *os.File) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
@@ -0,0 +1,50 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// resizeSignals are sent when the terminal is resized.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw makes the terminal pass each key through without echoing it, and returns a function that restores the previous mode.
+// Signals (e.g. from Ctrl-C) are still generated.
+func makeRaw(f *os.File) (restore func() error, err error) {
+	var old syscall.Termios
+	err = ioctl(f, ioctlGetTermios, unsafe.Pointer(&old))
+	if err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	err = ioctl(f, ioctlSetTermios, unsafe.Pointer(&raw))
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return ioctl(f, ioctlSetTermios, unsafe.Pointer(&old)) }, nil
+}
+
+// terminalSize returns the size of the terminal in cells.
+func terminalSize(f *os.File) (width, height int, err error) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	err = ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&ws))
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/storage"
+)
+
+func init() {
+	commands["start"] = command{"stop the current activity, and start one for a task (by ID or fuzzy title)", runStart}
+	commands["stop"] = command{"stop the current activity", runStop}
+	commands["log"] = command{"log a finished activity for a task (by ID or fuzzy title)", runLog}
+}
+
+func printStartResponse(res api.StartResponse, loc *time.Location) {
+	for _, a := range res.Stopped {
+		fmt.Printf("stopped %s (%s–%s)\n", a.Task.QuickTitle, a.TimeStart.In(loc).Format("15:04"), a.TimeEnd.In(loc).Format("15:04"))
+	}
+	if res.Started != nil {
+		a := res.Started
+		fmt.Printf("started %s (until %s unless stopped)\n", a.Task.QuickTitle, a.TimeEnd.In(loc).Format("15:04"))
+	}
+}
+
+func runStart(args []string) error {
+	fs := flag.NewFlagSet("start", flag.ContinueOnError)
+	var req api.StartRequest
+	var asJSON bool
+	fs.DurationVar(&req.For, "for", time.Hour, "log the activity for this long, unless stopped earlier")
+	fs.StringVar(&req.Location, "at", "", "location")
+	fs.StringVar(&req.Note, "note", "", "note")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of start: [flags] task\n")
+		fs.PrintDefaults()
+	}
+	taskArgs, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	t, err := selectTask(cl, taskArgs, ctx)
+	if err != nil {
+		return err
+	}
+	req.TaskID = t.ID
+	res, err := cl.Start(req, ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(res)
+	}
+	printStartResponse(res, loc)
+	return nil
+}
+
+func runStop(args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	var req api.StopRequest
+	var asJSON bool
+	fs.BoolVar(&req.Done, "done", false, "mark the task as done")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	res, err := cl.Stop(req, context.Background())
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(res)
+	}
+	if len(res.Stopped) == 0 {
+		fmt.Println("nothing to stop")
+	}
+	printStartResponse(res, loc)
+	return nil
+}
+
+// parseClock parses a time of day such as 9:30 as today in loc.
+func parseClock(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation("15:04", s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time must be in form 15:04")
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc), nil
+}
+
+func runLog(args []string) error {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	var a storage.Activity
+	var asJSON bool
+	var duration time.Duration
+	var from, to string
+	fs.DurationVar(&duration, "for", 0, "how long the activity was, ending at -to (or now)")
+	fs.StringVar(&from, "from", "", "when the activity started today (15:04)")
+	fs.StringVar(&to, "to", "", "when the activity ended today (15:04; default now)")
+	fs.StringVar(&a.Location, "at", "", "location")
+	fs.StringVar(&a.Note, "note", "", "note")
+	fs.BoolVar(&a.Done, "done", false, "mark the task as done")
+	fs.BoolVar(&asJSON, "json", false, "output JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of log: [flags] task\nOne of -for and -from is required.\n")
+		fs.PrintDefaults()
+	}
+	taskArgs, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if (duration == 0) == (from == "") {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	ctx := context.Background()
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	a.TimeEnd = time.Now().Truncate(time.Minute)
+	if to != "" {
+		a.TimeEnd, err = parseClock(to, loc)
+		if err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+	if from != "" {
+		a.TimeStart, err = parseClock(from, loc)
+		if err != nil {
+			return fmt.Errorf("-from: %w", err)
+		}
+	} else {
+		a.TimeStart = a.TimeEnd.Add(-duration)
+	}
+	t, err := selectTask(cl, taskArgs, ctx)
+	if err != nil {
+		return err
+	}
+	a.TaskID = t.ID
+	res, err := cl.ActivityAdd(a, ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(res)
+	}
+	var done string
+	if res.Done {
+		done = " (done)"
+	}
+	fmt.Printf("logged %s %s–%s%s\n", res.Task.QuickTitle, res.TimeStart.In(loc).Format("15:04"), res.TimeEnd.In(loc).Format("15:04"), done)
+	return nil
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/client"
+	"nyiyui.ca/jks/layout"
+	"nyiyui.ca/jks/storage"
+)
+
+func init() {
+	commands["tui"] = command{"show a day's activities and plans as a timeline, and start or stop activities from it", runTUI}
+}
+
+const tuiHelp = "-/+ day  D today  j/k select  ^D/^U scroll  s start  x stop  X stop done  r reload  q quit"
+
+// tuiEvent is an activity or a plan on the timeline.
+type tuiEvent struct {
+	activity *storage.Activity
+	plan     *storage.Plan
+	// top and bottom are the timeline rows [top, bottom) the event covers.
+	top, bottom int
+}
+
+// Layout lays events out by row rather than by time, so that events sharing a row are put in different columns.
+func (e tuiEvent) Layout() (top int, height int) {
+	return e.top, e.bottom - e.top
+}
+
+func (e tuiEvent) taskID() int64 {
+	if e.activity != nil {
+		return e.activity.TaskID
+	}
+	return e.plan.TaskID
+}
+
+func (e tuiEvent) times() (start, end time.Time) {
+	if e.activity != nil {
+		return e.activity.TimeStart, e.activity.TimeEnd
+	}
+	return e.plan.TimeAtAfter, e.plan.TimeBefore
+}
+
+// sameAs reports whether e and e2 are the same activity or plan (perhaps reloaded).
+func (e tuiEvent) sameAs(e2 tuiEvent) bool {
+	if e.activity != nil {
+		return e2.activity != nil && e.activity.ID == e2.activity.ID
+	}
+	return e2.plan != nil && e.plan.ID == e2.plan.ID
+}
+
+// day is a day's timeline, laid out like the day view of the server.
+type day struct {
+	date time.Time
+	loc  *time.Location
+	// slot is the time each row of the timeline covers.
+	slot     time.Duration
+	nRows    int
+	tasks    map[int64]storage.Task
+	events   []tuiEvent
+	nColumns int
+	columns  []int
+	// grid is the event (index into events) at each row and column, or -1.
+	grid [][]int
+}
+
+func newDay(r api.Range, date time.Time, slot time.Duration, loc *time.Location) *day {
+	d := &day{
+		date:  date,
+		loc:   loc,
+		slot:  slot,
+		tasks: map[int64]storage.Task{},
+	}
+	// days are not 24h long at DST changes
+	length := date.AddDate(0, 0, 1).Sub(date)
+	d.nRows = int((length + slot - 1) / slot)
+	for _, t := range r.Tasks {
+		d.tasks[t.ID] = t
+	}
+	for i := range r.Activities {
+		d.events = append(d.events, d.event(tuiEvent{activity: &r.Activities[i]}))
+	}
+	for i := range r.Plans {
+		// like the day view, fulfilled plans are shown as their activities
+		if r.Plans[i].ActivityID == 0 {
+			d.events = append(d.events, d.event(tuiEvent{plan: &r.Plans[i]}))
+		}
+	}
+	d.nColumns, d.columns = layout.Layout(d.events, 1)
+	d.grid = make([][]int, d.nRows)
+	for row := range d.grid {
+		d.grid[row] = make([]int, d.nColumns)
+		for column := range d.grid[row] {
+			d.grid[row][column] = -1
+		}
+	}
+	for i, e := range d.events {
+		for row := e.top; row < e.bottom; row++ {
+			d.grid[row][d.columns[i]] = i
+		}
+	}
+	return d
+}
+
+// row returns the row t is in, clamped to the day.
+func (d *day) row(t time.Time) int {
+	return min(max(int(t.Sub(d.date)/d.slot), 0), d.nRows-1)
+}
+
+// rowCeil returns the first row starting at or after t, clamped to the day.
+func (d *day) rowCeil(t time.Time) int {
+	dt := t.Sub(d.date)
+	row := int(dt / d.slot)
+	if dt%d.slot > 0 {
+		row++
+	}
+	return min(max(row, 0), d.nRows)
+}
+
+func (d *day) event(e tuiEvent) tuiEvent {
+	start, end := e.times()
+	e.top = d.row(start)
+	e.bottom = max(d.rowCeil(end), e.top+1)
+	return e
+}
+
+func (d *day) formatHM(t time.Time) string {
+	return t.In(d.loc).Format("15:04")
+}
+
+// label is shown on the first row of the event.
+func (d *day) label(e tuiEvent) string {
+	start, end := e.times()
+	title := d.tasks[e.taskID()].QuickTitle
+	if e.activity != nil {
+		if e.activity.Done {
+			title += " ✓"
+		}
+		return fmt.Sprintf("%s–%s %s", d.formatHM(start), d.formatHM(end), title)
+	}
+	return fmt.Sprintf("%s–%s plan: %s", d.formatHM(start), d.formatHM(end), title)
+}
+
+// describe is shown in the status line when the event is selected.
+func (d *day) describe(e tuiEvent) string {
+	var b strings.Builder
+	start, end := e.times()
+	if a := e.activity; a != nil {
+		fmt.Fprintf(&b, "activity %d: %s–%s %s", a.ID, d.formatHM(start), d.formatHM(end), d.tasks[a.TaskID].QuickTitle)
+		if a.Location != "" {
+			fmt.Fprintf(&b, " @%s", a.Location)
+		}
+		if a.Done {
+			b.WriteString(" (done)")
+		}
+		if a.Note != "" {
+			fmt.Fprintf(&b, " – %s", a.Note)
+		}
+		return b.String()
+	}
+	p := e.plan
+	fmt.Fprintf(&b, "plan %d: %s–%s %s", p.ID, d.formatHM(start), d.formatHM(end), d.tasks[p.TaskID].QuickTitle)
+	if p.Location != "" {
+		fmt.Fprintf(&b, " @%s", p.Location)
+	}
+	if p.DurationGe == p.DurationLt {
+		fmt.Fprintf(&b, " for %s", p.DurationGe)
+	} else {
+		fmt.Fprintf(&b, " for %s to %s", p.DurationGe, p.DurationLt)
+	}
+	return b.String()
+}
+
+// fit pads or cuts s to width cells.
+func fit(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return string([]rune(s)[:width])
+}
+
+const (
+	styleReset    = "\x1b[0m"
+	styleActivity = "\x1b[30;48;5;252m"
+	styleRunning  = "\x1b[30;48;5;151m"
+	stylePlan     = "\x1b[30;48;5;189m"
+	styleSelected = "\x1b[1;7m"
+	styleNow      = "\x1b[1;31m"
+)
+
+// render returns height rows of the timeline from row scroll on, each width cells wide.
+// selected is the selected event (index into d.events), or -1.
+func (d *day) render(scroll, width, height, selected int, now time.Time) []string {
+	const gutter = 7 // "15:04 │"
+	columnWidth := 0
+	if d.nColumns > 0 {
+		columnWidth = max((width-gutter)/d.nColumns, 1)
+	}
+	nowRow := -1
+	if !now.Before(d.date) && now.Before(d.date.AddDate(0, 0, 1)) {
+		nowRow = d.row(now)
+	}
+	lines := make([]string, 0, height)
+	for row := scroll; row < scroll+height && row < d.nRows; row++ {
+		var b strings.Builder
+		b.WriteString(d.formatHM(d.date.Add(time.Duration(row) * d.slot)))
+		if row == nowRow {
+			b.WriteString(" " + styleNow + "▶" + styleReset)
+		} else {
+			b.WriteString(" │")
+		}
+		for column := 0; column < d.nColumns; column++ {
+			i := d.grid[row][column]
+			if i == -1 {
+				b.WriteString(strings.Repeat(" ", columnWidth))
+				continue
+			}
+			e := d.events[i]
+			text := ""
+			if row == max(e.top, scroll) {
+				text = d.label(e)
+			}
+			switch {
+			case i == selected:
+				b.WriteString(styleSelected)
+			case e.plan != nil:
+				b.WriteString(stylePlan)
+			case !e.activity.TimeStart.After(now) && e.activity.TimeEnd.After(now):
+				b.WriteString(styleRunning)
+			default:
+				b.WriteString(styleActivity)
+			}
+			// the last cell is left as a gap between columns
+			b.WriteString(fit(text, columnWidth-1) + styleReset + " ")
+		}
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+// tui is the state of the terminal UI.
+type tui struct {
+	cl   *client.Client
+	loc  *time.Location
+	slot time.Duration
+	// defaultFor is how long activities are started for, unless the plan says otherwise.
+	defaultFor time.Duration
+
+	day      *day
+	selected int
+	scroll   int
+	status   string
+}
+
+// load fetches the day starting at date, keeping the selection if possible.
+func (t *tui) load(date time.Time) {
+	var prev *tuiEvent
+	if t.day != nil && t.day.date.Equal(date) && t.selected != -1 {
+		prev = &t.day.events[t.selected]
+	}
+	r, err := t.cl.Range(date, date.AddDate(0, 0, 1), context.Background())
+	if err != nil {
+		t.status = fmt.Sprintf("error: %s", err)
+		r = api.Range{}
+	}
+	t.day = newDay(r, date, t.slot, t.loc)
+	t.selected = -1
+	if prev == nil {
+		t.home(time.Now())
+		return
+	}
+	for i, e := range t.day.events {
+		if e.sameAs(*prev) {
+			t.selected = i
+		}
+	}
+}
+
+// home selects the running (or next) event today, or the first event on other days, and scrolls to it.
+func (t *tui) home(now time.Time) {
+	d := t.day
+	if len(d.events) > 0 {
+		t.selected = 0
+	}
+	for i, e := range d.events {
+		if _, end := e.times(); end.After(now) {
+			t.selected = i
+			break
+		}
+	}
+	switch {
+	case t.selected != -1:
+		t.scroll = d.events[t.selected].top - 2
+	case !now.Before(d.date) && now.Before(d.date.AddDate(0, 0, 1)):
+		t.scroll = d.row(now) - 2
+	default:
+		t.scroll = d.row(d.date.Add(8 * time.Hour))
+	}
+}
+
+func (t *tui) today() time.Time {
+	now := time.Now().In(t.loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, t.loc)
+}
+
+// clampScroll keeps the selected event (if any) and the timeline in view, given the number of rows shown.
+func (t *tui) clampScroll(rows int) {
+	if t.selected != -1 {
+		e := t.day.events[t.selected]
+		if e.top < t.scroll {
+			t.scroll = e.top
+		}
+		if e.top >= t.scroll+rows {
+			t.scroll = e.top - rows + 1
+		}
+	}
+	t.scroll = max(min(t.scroll, t.day.nRows-rows), 0)
+}
+
+// size returns the size of the terminal, or a guess if it is unknown.
+func (t *tui) size() (width, height int) {
+	width, height, err := terminalSize(os.Stdout)
+	if err != nil || width == 0 || height == 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+func (t *tui) draw() {
+	width, height := t.size()
+	// a header, and a status line for the selected event and messages
+	rows := max(height-3, 1)
+	t.clampScroll(rows)
+	d := t.day
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	b.WriteString(fit(d.date.Format("Mon 2006-01-02")+"  "+tuiHelp, width))
+	b.WriteString("\x1b[K\r\n")
+	lines := d.render(t.scroll, width, rows, t.selected, time.Now())
+	for len(lines) < rows {
+		lines = append(lines, "")
+	}
+	for _, line := range lines {
+		b.WriteString(line + "\x1b[K\r\n")
+	}
+	selected := ""
+	if t.selected != -1 {
+		selected = d.describe(d.events[t.selected])
+	}
+	b.WriteString(fit(selected, width) + "\x1b[K\r\n")
+	b.WriteString(fit(t.status, width) + "\x1b[K\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+// start starts an activity for the selected plan (fulfilling it) or activity (resuming its task).
+func (t *tui) start() {
+	if t.selected == -1 {
+		t.status = "nothing selected"
+		return
+	}
+	e := t.day.events[t.selected]
+	req := api.StartRequest{TaskID: e.taskID(), For: t.defaultFor}
+	if p := e.plan; p != nil {
+		req.PlanID = p.ID
+		req.Location = p.Location
+		if p.DurationGe > 0 {
+			req.For = p.DurationGe
+		}
+	} else {
+		req.Location = e.activity.Location
+	}
+	res, err := t.cl.Start(req, context.Background())
+	if err != nil {
+		t.status = fmt.Sprintf("error: %s", err)
+		return
+	}
+	t.status = fmt.Sprintf("started %s until %s", res.Started.Task.QuickTitle, t.day.formatHM(res.Started.TimeEnd))
+	t.selectAfterLoad(res.Started.ID)
+}
+
+func (t *tui) stop(done bool) {
+	res, err := t.cl.Stop(api.StopRequest{Done: done}, context.Background())
+	if err != nil {
+		t.status = fmt.Sprintf("error: %s", err)
+		return
+	}
+	if len(res.Stopped) == 0 {
+		t.status = "nothing to stop"
+		return
+	}
+	var titles []string
+	for _, a := range res.Stopped {
+		titles = append(titles, a.Task.QuickTitle)
+	}
+	t.status = fmt.Sprintf("stopped %s", strings.Join(titles, ", "))
+	t.selectAfterLoad(res.Stopped[0].ID)
+}
+
+// selectAfterLoad reloads the day and selects the activity if it is shown.
+func (t *tui) selectAfterLoad(activityID int64) {
+	t.load(t.day.date)
+	for i, e := range t.day.events {
+		if e.activity != nil && e.activity.ID == activityID {
+			t.selected = i
+		}
+	}
+}
+
+// selectVisible selects the first event shown after scrolling.
+func (t *tui) selectVisible() {
+	for i, e := range t.day.events {
+		if e.bottom > t.scroll {
+			t.selected = i
+			return
+		}
+	}
+}
+
+// key handles a key, and returns false to quit.
+func (t *tui) key(k string) bool {
+	_, height := t.size()
+	page := max((height-3)/2, 1)
+	// the same keys as kb_nav.js for changing days
+	switch k {
+	case "q":
+		return false
+	case "-", "h", "left":
+		t.load(t.day.date.AddDate(0, 0, -1))
+	case "+", "l", "right":
+		t.load(t.day.date.AddDate(0, 0, 1))
+	case "D":
+		t.load(t.today())
+	case "r":
+		t.status = ""
+		t.load(t.day.date)
+	case "j", "down", "k", "up":
+		if t.selected == -1 {
+			t.selectVisible()
+		} else if (k == "j" || k == "down") && t.selected+1 < len(t.day.events) {
+			t.selected++
+		} else if (k == "k" || k == "up") && t.selected > 0 {
+			t.selected--
+		}
+	case "\x04", "pgdown":
+		t.scroll += page
+		t.selected = -1
+	case "\x15", "pgup":
+		t.scroll -= page
+		t.selected = -1
+	case "s":
+		t.start()
+	case "x":
+		t.stop(false)
+	case "X":
+		t.stop(true)
+	}
+	return true
+}
+
+// parseKeys splits input read from the terminal into keys, naming the escape sequences of arrow and page keys.
+func parseKeys(b []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+	}
+	var keys []string
+	s := string(b)
+outer:
+	for len(s) > 0 {
+		for seq, name := range sequences {
+			if strings.HasPrefix(s, seq) {
+				keys = append(keys, name)
+				s = s[len(seq):]
+				continue outer
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		keys = append(keys, string(r))
+		s = s[size:]
+	}
+	return keys
+}
+
+func runTUI(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	var slot, defaultFor time.Duration
+	var date string
+	fs.DurationVar(&slot, "slot", 15*time.Minute, "time each row covers")
+	fs.DurationVar(&defaultFor, "for", time.Hour, "how long started activities are logged for, unless stopped earlier or the plan says otherwise")
+	fs.StringVar(&date, "date", "", "day to show (2006-01-02; default today)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if slot < time.Minute {
+		return fmt.Errorf("-slot must be at least 1m")
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("stdin and stdout must be a terminal")
+	}
+	cl, loc, err := newClient()
+	if err != nil {
+		return err
+	}
+	t := &tui{cl: cl, loc: loc, slot: slot, defaultFor: defaultFor}
+	start := t.today()
+	if date != "" {
+		start, err = time.ParseInLocation("2006-01-02", date, loc)
+		if err != nil {
+			return fmt.Errorf("-date: %w", err)
+		}
+	}
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// use the alternate screen, and hide the cursor
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	input := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 64)
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			input <- buf[:n]
+		}
+	}()
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, resizeSignals...)
+	defer signal.Stop(resize)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	// reload regularly, so that running activities and changes from elsewhere are shown
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	t.load(start)
+	for {
+		t.draw()
+		select {
+		case b, ok := <-input:
+			if !ok {
+				return nil
+			}
+			for _, k := range parseKeys(b) {
+				if !t.key(k) {
+					return nil
+				}
+			}
+		case <-resize:
+		case <-ticker.C:
+			t.load(t.day.date)
+		case <-quit:
+			return nil
+		}
+	}
+}
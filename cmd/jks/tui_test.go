@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestDay(t *testing.T) {
+	date := time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return date.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	r := api.Range{
+		Tasks: []storage.Task{{ID: 1, QuickTitle: "essay"}, {ID: 2, QuickTitle: "groceries"}},
+		Activities: []storage.Activity{
+			{ID: 1, TaskID: 1, TimeStart: at(9, 0), TimeEnd: at(10, 0)},
+			// shares the 10:00 row with the first activity's end, so goes in another column
+			{ID: 2, TaskID: 2, TimeStart: at(9, 50), TimeEnd: at(10, 20)},
+		},
+		Plans: []storage.Plan{
+			{ID: 1, TaskID: 1, TimeAtAfter: at(11, 0), TimeBefore: at(12, 0)},
+			// fulfilled, so not shown
+			{ID: 2, TaskID: 2, ActivityID: 2, TimeAtAfter: at(9, 0), TimeBefore: at(11, 0)},
+		},
+	}
+	d := newDay(r, date, 15*time.Minute, time.UTC)
+	if d.nRows != 96 || len(d.events) != 3 || d.nColumns != 2 {
+		t.Fatalf("rows %d, events %d, columns %d", d.nRows, len(d.events), d.nColumns)
+	}
+	var rows [][2]int
+	for _, e := range d.events {
+		rows = append(rows, [2]int{e.top, e.bottom})
+	}
+	if want := [][2]int{{36, 40}, {39, 42}, {44, 48}}; !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows: got %v, want %v", rows, want)
+	}
+	if want := []int{0, 1, 0}; !reflect.DeepEqual(d.columns, want) {
+		t.Fatalf("columns: got %v, want %v", d.columns, want)
+	}
+	lines := d.render(36, 80, 4, -1, at(9, 10))
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "09:00 \x1b[1;31m▶") || !strings.Contains(lines[0], "09:00–10:00 essay") || !strings.Contains(lines[3], "09:50–10:20 groceries") {
+		t.Fatalf("render: %q", lines)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[Bq\x1b[6~+"))
+	if want := []string{"j", "down", "q", "pgdown", "+"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	gosqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// backupStepPages is the number of pages copied per step of the online backup.
+// Other connections can write to the database between steps.
+const backupStepPages = 256
+
+// Backup writes a consistent copy of db to destPath using the SQLite online backup API.
+// The copy is written to a temporary file first, so destPath is never left half-written.
+func Backup(ctx context.Context, db *sqlx.DB, destPath string) error {
+	tmpPath := destPath + ".tmp"
+	defer os.Remove(tmpPath)
+	destDB, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("dest conn: %w", err)
+	}
+	defer destConn.Close()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("src conn: %w", err)
+	}
+	defer srcConn.Close()
+	err = destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			b, err := destRaw.(*gosqlite3.SQLiteConn).Backup("main", srcRaw.(*gosqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(backupStepPages)
+				if err != nil {
+					b.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				if err := ctx.Err(); err != nil {
+					b.Finish()
+					return err
+				}
+			}
+			return b.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	err = destConn.Close()
+	if err != nil {
+		return err
+	}
+	err = destDB.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+const snapshotPrefix = "jks-"
+const snapshotSuffix = ".sqlite3"
+
+// snapshotTimeLayout has nanoseconds, so that snapshots made in the same second do not replace each other.
+// Names without them, from before, still parse, as time.Parse accepts fractional seconds the layout does not have.
+const snapshotTimeLayout = "20060102T150405.000000000Z"
+const snapshotParseLayout = "20060102T150405Z"
+
+// Snapshot writes a backup of db into dir, named after the current time.
+func Snapshot(ctx context.Context, db *sqlx.DB, dir string) (path string, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	name := snapshotPrefix + time.Now().UTC().Format(snapshotTimeLayout) + snapshotSuffix
+	path = filepath.Join(dir, name)
+	return path, Backup(ctx, db, path)
+}
+
+// Retention decides which snapshots RotateSnapshots keeps.
+type Retention struct {
+	// Last is the number of most recent snapshots to keep.
+	Last int
+	// Daily is the number of days for which the newest snapshot of the day is kept, counting back from the newest snapshot.
+	Daily int
+}
+
+// RotateSnapshots deletes snapshots in dir that are not kept by retention, and returns the paths of deleted snapshots.
+// Files in dir not named like those written by Snapshot are ignored.
+func RotateSnapshots(dir string, retention Retention) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := map[time.Time]string{}
+	var times []time.Time
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		t, err := time.Parse(snapshotParseLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		snapshots[t] = filepath.Join(dir, name)
+		times = append(times, t)
+	}
+	var deleted []string
+	for _, t := range expiredSnapshots(times, retention) {
+		err = os.Remove(snapshots[t])
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, snapshots[t])
+	}
+	return deleted, nil
+}
+
+// expiredSnapshots returns the snapshot times not kept by retention.
+func expiredSnapshots(times []time.Time, retention Retention) []time.Time {
+	sorted := make([]time.Time, len(times))
+	copy(sorted, times)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].After(sorted[j]) })
+	keep := map[time.Time]bool{}
+	for i := 0; i < retention.Last && i < len(sorted); i++ {
+		keep[sorted[i]] = true
+	}
+	if len(sorted) > 0 && retention.Daily > 0 {
+		oldestDay := truncateDay(sorted[0]).AddDate(0, 0, -(retention.Daily - 1))
+		days := map[time.Time]bool{}
+		for _, t := range sorted {
+			day := truncateDay(t)
+			if day.Before(oldestDay) {
+				break
+			}
+			if !days[day] {
+				days[day] = true
+				keep[t] = true
+			}
+		}
+	}
+	var expired []time.Time
+	for _, t := range sorted {
+		if !keep[t] {
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LatestVersion returns the version of the newest migration embedded in this binary.
+func LatestVersion() (uint, error) {
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		panic(err) // shouldn't fail
+	}
+	defer source.Close()
+	version, err := source.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// SchemaVersion returns the migration version recorded in db.
+func SchemaVersion(db *sqlx.DB) (version uint, dirty bool, err error) {
+	err = db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
+
+// Restore replaces the database at dbPath with the snapshot at snapshotPath.
+// The snapshot must pass an integrity check and must not have a newer (or dirty) migration version than this binary knows about; older snapshots are migrated the next time the database is opened.
+// The replaced database is kept next to dbPath and its path is returned.
+// The server must not be running while restoring.
+func Restore(snapshotPath, dbPath string) (replacedPath string, err error) {
+	snapshot, err := Open("file:" + snapshotPath + "?mode=ro")
+	if err != nil {
+		return "", err
+	}
+	defer snapshot.Close()
+	var integrity string
+	err = snapshot.QueryRow(`PRAGMA integrity_check`).Scan(&integrity)
+	if err != nil {
+		return "", fmt.Errorf("integrity check: %w", err)
+	}
+	if integrity != "ok" {
+		return "", fmt.Errorf("integrity check: %s", integrity)
+	}
+	version, dirty, err := SchemaVersion(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("snapshot version: %w", err)
+	}
+	if dirty {
+		return "", fmt.Errorf("snapshot has dirty migration version %d", version)
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return "", fmt.Errorf("latest version: %w", err)
+	}
+	if version > latest {
+		return "", fmt.Errorf("snapshot has migration version %d, but this binary only knows up to %d", version, latest)
+	}
+
+	// copy to the same directory first so that the final rename is atomic
+	tmpPath := dbPath + ".restore"
+	defer os.Remove(tmpPath)
+	err = Backup(context.Background(), snapshot, tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("copy snapshot: %w", err)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		replacedPath = dbPath + ".replaced-" + time.Now().UTC().Format(snapshotTimeLayout)
+		err = os.Rename(dbPath, replacedPath)
+		if err != nil {
+			return "", fmt.Errorf("move current database: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dbPath + suffix)
+	}
+	err = os.Rename(tmpPath, dbPath)
+	if err != nil {
+		return replacedPath, fmt.Errorf("move snapshot: %w", err)
+	}
+	return replacedPath, nil
+}
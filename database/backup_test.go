@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func TestExpiredSnapshots(t *testing.T) {
+	base := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		base,
+		base.Add(-1 * time.Hour),
+		base.Add(-2 * time.Hour),
+		base.AddDate(0, 0, -1),
+		base.AddDate(0, 0, -1).Add(-time.Hour),
+		base.AddDate(0, 0, -2),
+		base.AddDate(0, 0, -5),
+	}
+	expired := expiredSnapshots(times, Retention{Last: 2, Daily: 3})
+	want := []time.Time{
+		base.Add(-2 * time.Hour),
+		base.AddDate(0, 0, -1).Add(-time.Hour),
+		base.AddDate(0, 0, -5),
+	}
+	if len(expired) != len(want) {
+		t.Fatalf("expected %v, got %v", want, expired)
+	}
+	for i := range want {
+		if !expired[i].Equal(want[i]) {
+			t.Fatalf("expected %v, got %v", want, expired)
+		}
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "db.sqlite3")
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Migrate(db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Database{DB: db}
+	_, err = d.TaskAdd(storageTask("before"), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotPath, err := Snapshot(context.Background(), db, filepath.Join(dir, "snapshots"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotPath2, err := Snapshot(context.Background(), db, filepath.Join(dir, "snapshots"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshotPath2 == snapshotPath {
+		t.Fatalf("second snapshot replaced the first: %s", snapshotPath)
+	}
+	deleted, err := RotateSnapshots(filepath.Join(dir, "snapshots"), Retention{Last: 1})
+	if err != nil || len(deleted) != 1 || deleted[0] != snapshotPath {
+		t.Fatal(deleted, err)
+	}
+	snapshotPath = snapshotPath2
+	_, err = d.TaskAdd(storageTask("after"), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	replaced, err := Restore(snapshotPath, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced == "" {
+		t.Fatal("expected the current database to be kept")
+	}
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	err = db.Get(&count, `SELECT COUNT(*) FROM tasks`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 task after restore, got %d", count)
+	}
+}
+
+func storageTask(title string) storage.Task {
+	return storage.Task{QuickTitle: title}
+}
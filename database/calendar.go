@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"nyiyui.ca/jks/storage"
+)
+
+func (d *Database) calendarRanges(id int64, ctx context.Context) ([]storage.DateRange, error) {
+	var rs []CalendarRange
+	err := d.q().SelectContext(ctx, &rs, `SELECT * FROM calendar_ranges WHERE calendar_id = ? ORDER BY start, end`, id)
+	if err != nil {
+		return nil, fmt.Errorf("select ranges: %w", err)
+	}
+	rs2 := make([]storage.DateRange, len(rs))
+	for i, r := range rs {
+		rs2[i].Summary = r.Summary
+		rs2[i].Start, err = time.Parse(time.DateOnly, r.Start)
+		if err == nil {
+			rs2[i].End, err = time.Parse(time.DateOnly, r.End)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("calendar %d: %w", id, err)
+		}
+	}
+	return rs2, nil
+}
+
+func setCalendarRanges(tx *sqlx.Tx, id int64, ranges []storage.DateRange, ctx context.Context) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM calendar_ranges WHERE calendar_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		_, err = tx.ExecContext(ctx, `INSERT INTO calendar_ranges (calendar_id, start, end, summary) VALUES (?, ?, ?, ?)`, id, r.Start.Format(time.DateOnly), r.End.Format(time.DateOnly), r.Summary)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Database) Calendars(ctx context.Context) ([]storage.Calendar, error) {
+	var cs []Calendar
+	err := d.q().SelectContext(ctx, &cs, `SELECT * FROM calendars WHERE owner = ? ORDER BY id`, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	cs2 := make([]storage.Calendar, len(cs))
+	for i, c := range cs {
+		cs2[i] = storage.Calendar{ID: c.ID, Name: c.Name}
+		cs2[i].Ranges, err = d.calendarRanges(c.ID, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cs2, nil
+}
+
+func (d *Database) CalendarGet(id int64, ctx context.Context) (storage.Calendar, error) {
+	var c Calendar
+	err := d.q().GetContext(ctx, &c, `SELECT * FROM calendars WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	if err != nil {
+		return storage.Calendar{}, fmt.Errorf("select: %w", err)
+	}
+	c2 := storage.Calendar{ID: c.ID, Name: c.Name}
+	c2.Ranges, err = d.calendarRanges(id, ctx)
+	return c2, err
+}
+
+func (d *Database) CalendarAdd(c storage.Calendar, ctx context.Context) (id int64, err error) {
+	err = d.tx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `INSERT INTO calendars (name, owner) VALUES (?, ?)`, c.Name, storage.Owner(ctx))
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return setCalendarRanges(tx, id, c.Ranges, ctx)
+	})
+	return
+}
+
+func (d *Database) CalendarEdit(c storage.Calendar, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "calendars", c.ID, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE calendars SET name = ? WHERE id = ?`, c.Name, c.ID)
+		if err != nil {
+			return err
+		}
+		return setCalendarRanges(tx, c.ID, c.Ranges, ctx)
+	})
+}
+
+func (d *Database) CalendarDelete(id int64, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "calendars", id, ctx)
+		if err != nil {
+			return err
+		}
+		for _, q := range []string{
+			`DELETE FROM recurrence_calendars WHERE calendar_id = ?`,
+			`DELETE FROM calendar_ranges WHERE calendar_id = ?`,
+			`DELETE FROM calendars WHERE id = ?`,
+		} {
+			_, err := tx.ExecContext(ctx, q, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"embed"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -23,6 +24,25 @@ var migrations embed.FS
 
 type Database struct {
 	DB *sqlx.DB
+	// current is the transaction this Database is bound to by WithTx, or nil.
+	current *sqlx.Tx
+}
+
+// queryer is implemented by both *sqlx.DB and *sqlx.Tx.
+type queryer interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// q returns the transaction of WithTx if there is one, or the database otherwise.
+func (d *Database) q() queryer {
+	if d.current != nil {
+		return d.current
+	}
+	return d.DB
 }
 
 func Open(path string) (*sqlx.DB, error) {
@@ -53,28 +73,159 @@ func Migrate(db *sql.DB) error {
 
 var _ storage.Storage = (*Database)(nil)
 
+// tx runs fn in a transaction, which is committed if fn returns nil.
+// Within WithTx, fn runs in the transaction of WithTx instead, which is committed or rolled back with the rest of it.
+func (d *Database) tx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if d.current != nil {
+		return fn(d.current)
+	}
+	tx, err := d.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithTx runs fn with a Storage that makes all its changes in one SQLite transaction.
+// The transaction is committed if fn returns nil, and rolled back otherwise.
+// Nested calls run in the outermost transaction.
+func (d *Database) WithTx(ctx context.Context, fn func(st storage.Storage) error) error {
+	if d.current != nil {
+		return fn(d)
+	}
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		return fn(&Database{DB: d.DB, current: tx})
+	})
+}
+
+// owns returns an error wrapping sql.ErrNoRows unless the row of table with the given ID is owned by the owner of ctx (see storage.WithOwner).
+// It is checked before referring to a row, so that rows cannot refer to rows of other owners.
+func owns(q queryer, table string, id int64, ctx context.Context) error {
+	var n int
+	err := q.GetContext(ctx, &n, `SELECT COUNT(*) FROM `+table+` WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d: %w", table, id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// addRevision records a change of entity from before to after (see storage.NewRevision).
+// Edits that change nothing are not recorded.
+func addRevision[T any](tx *sqlx.Tx, entity string, id int64, before, after *T, ctx context.Context) error {
+	r, err := storage.NewRevision(entity, id, before, after)
+	if err != nil {
+		return fmt.Errorf("revision: %w", err)
+	}
+	if before != nil && after != nil && len(r.Fields) == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO revisions (entity, entity_id, time, author, fields, value_before, value_after, owner) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Entity,
+		r.EntityID,
+		time.Now().Unix(),
+		storage.Author(ctx),
+		strings.Join(r.Fields, ","),
+		string(r.Before),
+		string(r.After),
+		storage.Owner(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("insert revision: %w", err)
+	}
+	return nil
+}
+
 func (d *Database) ActivityAdd(a storage.Activity, ctx context.Context) (id int64, err error) {
+	return d.activityAdd(a, nil, ctx)
+}
+
+func (d *Database) ActivityRestore(a storage.Activity, ctx context.Context) error {
+	_, err := d.activityAdd(a, &a.ID, ctx)
+	return err
+}
+
+// activityAdd adds the activity with the given ID, or the next row ID if id is nil.
+func (d *Database) activityAdd(a storage.Activity, id0 *int64, ctx context.Context) (id int64, err error) {
 	status := StatusInProgress
 	if a.Done {
 		status = StatusDone
 	}
-	res, err := d.DB.Exec(`INSERT INTO activity_log (task_id, location, time_start, time_end, status, note) VALUES (?, ?, ?, ?, ?, ?)`,
-		a.TaskID,
-		a.Location,
-		a.TimeStart.Unix(),
-		a.TimeEnd.Unix(),
-		status,
-		a.Note,
-	)
-	if err != nil {
-		return 0, err
-	}
-	return res.LastInsertId()
+	err = d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "tasks", a.TaskID, ctx)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `INSERT INTO activity_log (id, task_id, location, time_start, time_end, status, note, owner) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id0,
+			a.TaskID,
+			a.Location,
+			a.TimeStart.Unix(),
+			a.TimeEnd.Unix(),
+			status,
+			a.Note,
+			storage.Owner(ctx),
+		)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		a.ID = id
+		a.Version = 1
+		return addRevision(tx, storage.EntityActivity, id, nil, &a, ctx)
+	})
+	return
+}
+
+// ActivityDelete deletes the activity, and unlinks the plans fulfilled by it.
+func (d *Database) ActivityDelete(id int64, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		var orig Activity
+		err := tx.GetContext(ctx, &orig, `SELECT * FROM activity_log WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+		if err != nil {
+			return fmt.Errorf("finding original: %w", err)
+		}
+		var ps []Plan
+		err = tx.SelectContext(ctx, &ps, `SELECT * FROM plans WHERE activity_id = ? AND owner = ?`, id, storage.Owner(ctx))
+		if err != nil {
+			return fmt.Errorf("finding plans: %w", err)
+		}
+		for _, p := range ps {
+			_, err = tx.ExecContext(ctx, `UPDATE plans SET activity_id = NULL, version = version + 1 WHERE id = ?`, p.ID)
+			if err != nil {
+				return err
+			}
+			before := planToStorage(p)
+			after := before
+			after.ActivityID = 0
+			after.Version++
+			err = addRevision(tx, storage.EntityPlan, p.ID, &before, &after, ctx)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM activity_log WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		before := activityToStorage(orig)
+		return addRevision[storage.Activity](tx, storage.EntityActivity, id, &before, nil, ctx)
+	})
 }
 
 func (d *Database) ActivityLatestN(ctx context.Context, n int) ([]storage.Activity, error) {
 	var as []Activity
-	err := d.DB.Select(&as, `SELECT * FROM activity_log ORDER BY time_end DESC LIMIT ? OFFSET 0`, n)
+	err := d.q().SelectContext(ctx, &as, `SELECT * FROM activity_log WHERE owner = ? ORDER BY time_end DESC LIMIT ? OFFSET 0`, storage.Owner(ctx), n)
 	if err != nil {
 		return nil, fmt.Errorf("select: %w", err)
 	}
@@ -86,34 +237,49 @@ func (d *Database) ActivityLatestN(ctx context.Context, n int) ([]storage.Activi
 }
 
 func (d *Database) ActivityEdit(a storage.Activity, ctx context.Context) error {
-	var orig Activity
-	err := d.DB.Get(&orig, `SELECT * FROM activity_log WHERE id = ?`, a.ID)
-	if err != nil {
-		return fmt.Errorf("finding original: %w", err)
-	}
-	var status Status
-	if a.Done {
-		status = StatusDone
-	} else if orig.Status == StatusDone {
-		status = StatusInProgress
-	} else {
-		status = orig.Status
-	}
-	_, err = d.DB.Exec(`UPDATE activity_log SET task_id = ?, location = ?, time_start = ?, time_end = ?, status = ?, note = ? WHERE id = ?`,
-		a.TaskID,
-		a.Location,
-		a.TimeStart.Unix(),
-		a.TimeEnd.Unix(),
-		status,
-		a.Note,
-		a.ID,
-	)
-	return err
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		var orig Activity
+		err := tx.GetContext(ctx, &orig, `SELECT * FROM activity_log WHERE id = ? AND owner = ?`, a.ID, storage.Owner(ctx))
+		if err != nil {
+			return fmt.Errorf("finding original: %w", err)
+		}
+		err = owns(tx, "tasks", a.TaskID, ctx)
+		if err != nil {
+			return err
+		}
+		if a.Version != 0 && a.Version != orig.Version {
+			return storage.ErrConflict
+		}
+		a.Version = orig.Version + 1
+		var status Status
+		if a.Done {
+			status = StatusDone
+		} else if orig.Status == StatusDone {
+			status = StatusInProgress
+		} else {
+			status = orig.Status
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE activity_log SET task_id = ?, location = ?, time_start = ?, time_end = ?, status = ?, note = ?, version = ? WHERE id = ?`,
+			a.TaskID,
+			a.Location,
+			a.TimeStart.Unix(),
+			a.TimeEnd.Unix(),
+			status,
+			a.Note,
+			a.Version,
+			a.ID,
+		)
+		if err != nil {
+			return err
+		}
+		before := activityToStorage(orig)
+		return addRevision(tx, storage.EntityActivity, a.ID, &before, &a, ctx)
+	})
 }
 
 func (d *Database) ActivityGet(id int64, ctx context.Context) (storage.Activity, error) {
 	var v Activity
-	err := d.DB.Get(&v, `SELECT * FROM activity_log WHERE id = ?`, id)
+	err := d.q().GetContext(ctx, &v, `SELECT * FROM activity_log WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
 	if err != nil {
 		return storage.Activity{}, fmt.Errorf("select: %w", err)
 	}
@@ -122,7 +288,7 @@ func (d *Database) ActivityGet(id int64, ctx context.Context) (storage.Activity,
 
 func (d *Database) TaskGet(id int64, ctx context.Context) (storage.Task, error) {
 	var t Task
-	err := d.DB.Get(&t, `SELECT * FROM tasks WHERE id = ?`, id)
+	err := d.q().GetContext(ctx, &t, `SELECT * FROM tasks WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
 	if err != nil {
 		return storage.Task{}, fmt.Errorf("select: %w", err)
 	}
@@ -132,12 +298,25 @@ func (d *Database) TaskGet(id int64, ctx context.Context) (storage.Task, error)
 		QuickTitle:  t.QuickTitle,
 		Deadline:    t.Deadline,
 		Due:         t.Due,
+		Version:     t.Version,
 	}, nil
 }
 
+func (d *Database) TaskByTitle(title string, ctx context.Context) (storage.Task, bool, error) {
+	var t Task
+	err := d.q().GetContext(ctx, &t, `SELECT * FROM tasks WHERE quick_title = ? COLLATE NOCASE AND owner = ? ORDER BY id LIMIT 1`, title, storage.Owner(ctx))
+	if err == sql.ErrNoRows {
+		return storage.Task{}, false, nil
+	}
+	if err != nil {
+		return storage.Task{}, false, fmt.Errorf("select: %w", err)
+	}
+	return taskToStorage(t), true, nil
+}
+
 func (d *Database) TaskGetPlans(id int64, limit, offset int, ctx context.Context) ([]storage.Plan, error) {
 	ps := make([]Plan, limit)
-	err := d.DB.Select(&ps, `SELECT * FROM plans WHERE task_id = ? LIMIT ? OFFSET ?`, id, limit, offset)
+	err := d.q().SelectContext(ctx, &ps, `SELECT * FROM plans WHERE task_id = ? AND owner = ? LIMIT ? OFFSET ?`, id, storage.Owner(ctx), limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("select: %w", err)
 	}
@@ -150,7 +329,7 @@ func (d *Database) TaskGetPlans(id int64, limit, offset int, ctx context.Context
 
 func (d *Database) TaskGetActivities(id int64, ctx context.Context) ([]storage.Activity, error) {
 	ts := make([]Activity, 0)
-	err := d.DB.Select(&ts, `SELECT * FROM activity_log WHERE task_id = ?`, id)
+	err := d.q().SelectContext(ctx, &ts, `SELECT * FROM activity_log WHERE task_id = ? AND owner = ?`, id, storage.Owner(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("select: %w", err)
 	}
@@ -168,6 +347,7 @@ func taskToStorage(t Task) storage.Task {
 		QuickTitle:  t.QuickTitle,
 		Deadline:    t.Deadline,
 		Due:         t.Due,
+		Version:     t.Version,
 	}
 }
 
@@ -184,7 +364,21 @@ func activityToStorage(a Activity) storage.Activity {
 		TimeEnd:   a.TimeEnd,
 		Done:      done,
 		Note:      a.Note,
+		Version:   a.Version,
+	}
+}
+
+func (d *Database) Tasks(ctx context.Context) ([]storage.Task, error) {
+	var ts []Task
+	err := d.q().SelectContext(ctx, &ts, `SELECT * FROM tasks WHERE `+ownerWhere+` ORDER BY id`, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	ts2 := make([]storage.Task, len(ts))
+	for i := range ts {
+		ts2[i] = taskToStorage(ts[i])
 	}
+	return ts2, nil
 }
 
 func (d *Database) TaskSearch(query string, undoneAt time.Time, ctx context.Context) (storage.Window[storage.Task], error) {
@@ -199,6 +393,7 @@ type window3 struct {
 }
 
 const deadlineWhere = `(deadline IS NULL OR UNIXEPOCH(deadline) >= ?)`
+const ownerWhere = `tasks.owner = ?`
 const queryWhere = `(quick_title like ? OR description like ?)`
 const notDoneJoinWhere = `
 JOIN activity_log ON (tasks.id = activity_log.task_id)
@@ -213,24 +408,24 @@ func (w *window3) Get(limit, offset int) ([]storage.Task, error) {
 	ts := make([]Task, limit)
 	var err error
 	if w.query == "" {
-		err = w.d.DB.SelectContext(w.ctx, &ts,
+		err = w.d.q().SelectContext(w.ctx, &ts,
 			`SELECT * FROM (`+
-				`SELECT tasks.* FROM tasks `+notDoneJoinWhere+` AND `+deadlineWhere+
+				`SELECT tasks.* FROM tasks `+notDoneJoinWhere+` AND `+deadlineWhere+` AND `+ownerWhere+
 				` UNION ALL `+
-				`SELECT * FROM tasks `+unionNoLogs+` AND `+deadlineWhere+
+				`SELECT * FROM tasks `+unionNoLogs+` AND `+deadlineWhere+` AND `+ownerWhere+
 				`) ORDER BY deadline ASC, due ASC LIMIT ? OFFSET ?`,
-			w.now.Unix(),
-			w.now.Unix(),
+			w.now.Unix(), storage.Owner(w.ctx),
+			w.now.Unix(), storage.Owner(w.ctx),
 			limit, offset)
 	} else {
-		err = w.d.DB.SelectContext(w.ctx, &ts,
+		err = w.d.q().SelectContext(w.ctx, &ts,
 			`SELECT * FROM (`+
-				`SELECT tasks.* FROM tasks `+notDoneJoinWhere+` AND `+queryWhere+` AND `+deadlineWhere+
+				`SELECT tasks.* FROM tasks `+notDoneJoinWhere+` AND `+queryWhere+` AND `+deadlineWhere+` AND `+ownerWhere+
 				` UNION ALL `+
-				`SELECT * FROM tasks `+unionNoLogs+` AND `+queryWhere+` AND `+deadlineWhere+
+				`SELECT * FROM tasks `+unionNoLogs+` AND `+queryWhere+` AND `+deadlineWhere+` AND `+ownerWhere+
 				`) ORDER BY deadline ASC, due ASC LIMIT ? OFFSET ?`,
-			w.query, w.query, w.now.Unix(),
-			w.query, w.query, w.now.Unix(),
+			w.query, w.query, w.now.Unix(), storage.Owner(w.ctx),
+			w.query, w.query, w.now.Unix(), storage.Owner(w.ctx),
 			limit, offset)
 	}
 	if err != nil {
@@ -248,28 +443,112 @@ func (w *window3) Close() error {
 }
 
 func (d *Database) TaskAdd(v storage.Task, ctx context.Context) (id int64, err error) {
-	res, err := d.DB.Exec(`INSERT INTO tasks (description, quick_title, deadline, due) VALUES (?, ?, ?, ?)`,
-		v.Description,
-		v.QuickTitle,
-		v.Deadline,
-		v.Due,
-	)
-	if err != nil {
-		return
-	}
-	id, err = res.LastInsertId()
+	err = d.tx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `INSERT INTO tasks (description, quick_title, deadline, due, owner) VALUES (?, ?, ?, ?, ?)`,
+			v.Description,
+			v.QuickTitle,
+			v.Deadline,
+			v.Due,
+			storage.Owner(ctx),
+		)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		v.ID = id
+		v.Version = 1
+		return addRevision(tx, storage.EntityTask, id, nil, &v, ctx)
+	})
 	return
 }
 
 func (d *Database) TaskEdit(v storage.Task, ctx context.Context) error {
-	_, err := d.DB.Exec(`UPDATE tasks SET description = ?, quick_title = ?, deadline = ?, due = ? WHERE id = ?`,
-		v.Description,
-		v.QuickTitle,
-		v.Deadline,
-		v.Due,
-		v.ID,
-	)
-	return err
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		var orig Task
+		err := tx.GetContext(ctx, &orig, `SELECT * FROM tasks WHERE id = ? AND owner = ?`, v.ID, storage.Owner(ctx))
+		if err != nil {
+			return fmt.Errorf("finding original: %w", err)
+		}
+		if v.Version != 0 && v.Version != orig.Version {
+			return storage.ErrConflict
+		}
+		v.Version = orig.Version + 1
+		_, err = tx.ExecContext(ctx, `UPDATE tasks SET description = ?, quick_title = ?, deadline = ?, due = ?, version = ? WHERE id = ?`,
+			v.Description,
+			v.QuickTitle,
+			v.Deadline,
+			v.Due,
+			v.Version,
+			v.ID,
+		)
+		if err != nil {
+			return err
+		}
+		before := taskToStorage(orig)
+		return addRevision(tx, storage.EntityTask, v.ID, &before, &v, ctx)
+	})
+}
+
+// TaskDelete also forgets the task's occurrence and mappings, so that generating or importing it again adds it again.
+func (d *Database) TaskDelete(id int64, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		var orig Task
+		err := tx.GetContext(ctx, &orig, `SELECT * FROM tasks WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+		if err != nil {
+			return fmt.Errorf("finding original: %w", err)
+		}
+		var activities int
+		err = tx.GetContext(ctx, &activities, `SELECT COUNT(*) FROM activity_log WHERE task_id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("counting activities: %w", err)
+		}
+		if activities != 0 {
+			return storage.ErrHasActivities
+		}
+		var ps []Plan
+		err = tx.SelectContext(ctx, &ps, `SELECT * FROM plans WHERE task_id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("finding plans: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM occurrences WHERE task_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		for _, p := range ps {
+			_, err = tx.ExecContext(ctx, `DELETE FROM plans WHERE id = ?`, p.ID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM mapping WHERE kind = 'plan' AND local_id = ? AND owner = ?`, p.ID, storage.Owner(ctx))
+			if err != nil {
+				return err
+			}
+			before := planToStorage(p)
+			err = addRevision[storage.Plan](tx, storage.EntityPlan, p.ID, &before, nil, ctx)
+			if err != nil {
+				return err
+			}
+		}
+		for _, q := range []string{
+			`DELETE FROM task_tags WHERE task_id = ?`,
+			`DELETE FROM grants WHERE task_id = ?`,
+			`DELETE FROM tasks WHERE id = ?`,
+		} {
+			_, err = tx.ExecContext(ctx, q, id)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM mapping WHERE kind = 'task' AND local_id = ? AND owner = ?`, id, storage.Owner(ctx))
+		if err != nil {
+			return err
+		}
+		before := taskToStorage(orig)
+		return addRevision[storage.Task](tx, storage.EntityTask, id, &before, nil, ctx)
+	})
 }
 
 func (d *Database) ActivityRange(a, b time.Time, ctx context.Context) (storage.Window[storage.Activity], error) {
@@ -285,7 +564,7 @@ type window2 struct {
 
 func (w *window2) Get(limit, offset int) ([]storage.Activity, error) {
 	ts := make([]Activity, limit)
-	err := w.d.DB.SelectContext(w.ctx, &ts, `SELECT * FROM activity_log WHERE time_start >= ? AND time_end < ? LIMIT ? OFFSET ?`, w.timeStart.Unix(), w.timeEnd.Unix(), limit, offset)
+	err := w.d.q().SelectContext(w.ctx, &ts, `SELECT * FROM activity_log WHERE time_start >= ? AND time_end < ? AND owner = ? LIMIT ? OFFSET ?`, w.timeStart.Unix(), w.timeEnd.Unix(), storage.Owner(w.ctx), limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("select: %w", err)
 	}
@@ -301,16 +580,41 @@ func (w *window2) Close() error {
 }
 
 func (d *Database) PlanAdd(p storage.Plan, ctx context.Context) (id int64, err error) {
-	res, err := d.DB.Exec(`INSERT INTO plans (task_id, activity_id, location, time_at_after, time_before, duration_ge, duration_lt) VALUES (?, ?, ?, ?, ?, ?, ?)`, p.TaskID, p.ActivityID, p.Location, p.TimeAtAfter.Unix(), p.TimeBefore.Unix(), p.DurationGe, p.DurationLt)
+	err = d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := ownsPlanRefs(tx, p, ctx)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `INSERT INTO plans (task_id, activity_id, location, time_at_after, time_before, duration_ge, duration_lt, owner) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, p.TaskID, p.ActivityID, p.Location, p.TimeAtAfter.Unix(), p.TimeBefore.Unix(), p.DurationGe, p.DurationLt, storage.Owner(ctx))
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		p.ID = id
+		p.Version = 1
+		return addRevision(tx, storage.EntityPlan, id, nil, &p, ctx)
+	})
+	return
+}
+
+// ownsPlanRefs checks that the task and activity (if any) of p are owned by the owner of ctx.
+func ownsPlanRefs(tx *sqlx.Tx, p storage.Plan, ctx context.Context) error {
+	err := owns(tx, "tasks", p.TaskID, ctx)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if p.ActivityID != 0 {
+		return owns(tx, "activity_log", p.ActivityID, ctx)
 	}
-	return res.LastInsertId()
+	return nil
 }
 
 func (d *Database) PlanGet(id int64, ctx context.Context) (storage.Plan, error) {
 	var v Plan
-	err := d.DB.Get(&v, `SELECT * FROM plans WHERE id = ?`, id)
+	err := d.q().GetContext(ctx, &v, `SELECT * FROM plans WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
 	if err != nil {
 		return storage.Plan{}, fmt.Errorf("select: %w", err)
 	}
@@ -329,6 +633,7 @@ func (d *Database) PlanGet(id int64, ctx context.Context) (storage.Plan, error)
 		TimeBefore:  v.TimeBefore,
 		DurationGe:  v.DurationGe,
 		DurationLt:  v.DurationLt,
+		Version:     v.Version,
 	}, nil
 }
 
@@ -344,7 +649,7 @@ type window4 struct {
 
 func (w *window4) Get(limit, offset int) ([]storage.Plan, error) {
 	ts := make([]Plan, limit)
-	err := w.d.DB.SelectContext(w.ctx, &ts, `SELECT * FROM plans WHERE time_at_after >= ? AND time_before < ? LIMIT ? OFFSET ?`, w.a.Unix(), w.b.Unix(), limit, offset)
+	err := w.d.q().SelectContext(w.ctx, &ts, `SELECT * FROM plans WHERE time_at_after >= ? AND time_before < ? AND owner = ? LIMIT ? OFFSET ?`, w.a.Unix(), w.b.Unix(), storage.Owner(w.ctx), limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("select: %w", err)
 	}
@@ -375,17 +680,37 @@ func planToStorage(p Plan) storage.Plan {
 		TimeBefore:  p.TimeBefore,
 		DurationGe:  p.DurationGe,
 		DurationLt:  p.DurationLt,
+		Version:     p.Version,
 	}
 }
 
 func (d *Database) PlanEdit(p storage.Plan, ctx context.Context) error {
-	_, err := d.DB.ExecContext(ctx, `UPDATE plans SET task_id = ?, activity_id = ?, location = ?, time_at_after = ?, time_before = ?, duration_ge = ?, duration_lt = ? WHERE id = ?`, p.TaskID, p.ActivityID, p.Location, p.TimeAtAfter.Unix(), p.TimeBefore.Unix(), p.DurationGe, p.DurationLt, p.ID)
-	return err
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		var orig Plan
+		err := tx.GetContext(ctx, &orig, `SELECT * FROM plans WHERE id = ? AND owner = ?`, p.ID, storage.Owner(ctx))
+		if err != nil {
+			return fmt.Errorf("finding original: %w", err)
+		}
+		err = ownsPlanRefs(tx, p, ctx)
+		if err != nil {
+			return err
+		}
+		if p.Version != 0 && p.Version != orig.Version {
+			return storage.ErrConflict
+		}
+		p.Version = orig.Version + 1
+		_, err = tx.ExecContext(ctx, `UPDATE plans SET task_id = ?, activity_id = ?, location = ?, time_at_after = ?, time_before = ?, duration_ge = ?, duration_lt = ?, version = ? WHERE id = ?`, p.TaskID, p.ActivityID, p.Location, p.TimeAtAfter.Unix(), p.TimeBefore.Unix(), p.DurationGe, p.DurationLt, p.Version, p.ID)
+		if err != nil {
+			return err
+		}
+		before := planToStorage(orig)
+		return addRevision(tx, storage.EntityPlan, p.ID, &before, &p, ctx)
+	})
 }
 
 func (d *Database) Range(a, b time.Time, ctx context.Context) ([]storage.Task, []storage.Activity, []storage.Plan, error) {
 	as := make([]Activity, 0)
-	err := d.DB.SelectContext(ctx, &as, `SELECT * FROM activity_log WHERE time_start >= ? AND time_end < ?`, a.Unix(), b.Unix())
+	err := d.q().SelectContext(ctx, &as, `SELECT * FROM activity_log WHERE time_start >= ? AND time_end < ? AND owner = ?`, a.Unix(), b.Unix(), storage.Owner(ctx))
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("select: %w", err)
 	}
@@ -395,7 +720,7 @@ func (d *Database) Range(a, b time.Time, ctx context.Context) ([]storage.Task, [
 	}
 
 	ps := make([]Plan, 0)
-	err = d.DB.SelectContext(ctx, &ps, `SELECT * FROM plans WHERE time_at_after >= ? AND time_before < ?`, a.Unix(), b.Unix())
+	err = d.q().SelectContext(ctx, &ps, `SELECT * FROM plans WHERE time_at_after >= ? AND time_before < ? AND owner = ?`, a.Unix(), b.Unix(), storage.Owner(ctx))
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("select: %w", err)
 	}
@@ -405,15 +730,15 @@ func (d *Database) Range(a, b time.Time, ctx context.Context) ([]storage.Task, [
 	}
 
 	ts := make([]Task, 0)
-	err = d.DB.SelectContext(ctx, &ts, `
+	err = d.q().SelectContext(ctx, &ts, `
 SELECT tasks.* FROM tasks
 JOIN plans ON (tasks.id = plans.task_id)
-WHERE plans.time_at_after >= ? AND plans.time_before < ?
+WHERE plans.time_at_after >= ? AND plans.time_before < ? AND tasks.owner = ?
 UNION ALL
 SELECT tasks.* FROM tasks
 JOIN activity_log ON (tasks.id = activity_log.task_id)
-WHERE activity_log.time_start >= ? AND activity_log.time_end < ?
-`, a.Unix(), b.Unix(), a.Unix(), b.Unix())
+WHERE activity_log.time_start >= ? AND activity_log.time_end < ? AND tasks.owner = ?
+`, a.Unix(), b.Unix(), storage.Owner(ctx), a.Unix(), b.Unix(), storage.Owner(ctx))
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("select: %w", err)
 	}
@@ -431,28 +756,24 @@ type linkRow struct {
 }
 
 func (d *Database) ReplaceLinks(source *url.URL, links []linkdata.Link, ctx context.Context) error {
-	tx, err := d.DB.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(`DELETE FROM links WHERE source = ?`, source.String())
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	for _, link := range links {
-		_, err = tx.Exec(`INSERT INTO links (source, label, destination) VALUES (?, ?, ?)`, source.String(), link.Label, link.Destination.String())
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`DELETE FROM links WHERE source = ? AND owner = ?`, source.String(), storage.Owner(ctx))
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
-	}
-	return tx.Commit()
+		for _, link := range links {
+			_, err = tx.Exec(`INSERT INTO links (owner, source, label, destination) VALUES (?, ?, ?, ?)`, storage.Owner(ctx), source.String(), link.Label, link.Destination.String())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (d *Database) GetLinks(source *url.URL, ctx context.Context) ([]linkdata.Link, error) {
 	var rows []linkRow
-	err := d.DB.SelectContext(ctx, &rows, `SELECT * FROM links WHERE source = ?`, source.String())
+	err := d.q().SelectContext(ctx, &rows, `SELECT source, label, destination FROM links WHERE source = ? AND owner = ?`, source.String(), storage.Owner(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -472,7 +793,7 @@ func (d *Database) GetLinks(source *url.URL, ctx context.Context) ([]linkdata.Li
 
 func (d *Database) GetBacklinks(destination *url.URL, ctx context.Context) ([]linkdata.Backlink, error) {
 	var rows []linkRow
-	err := d.DB.SelectContext(ctx, &rows, `SELECT * FROM links WHERE destination = ?`, destination.String())
+	err := d.q().SelectContext(ctx, &rows, `SELECT source, label, destination FROM links WHERE destination = ? AND owner = ?`, destination.String(), storage.Owner(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -489,3 +810,62 @@ func (d *Database) GetBacklinks(destination *url.URL, ctx context.Context) ([]li
 	}
 	return backlinks, nil
 }
+
+func (d *Database) MappingGet(kind, foreign string, ctx context.Context) (id int64, ok bool, err error) {
+	err = d.q().GetContext(ctx, &id, `SELECT local_id FROM mapping WHERE owner = ? AND kind = ? AND foreign_uri = ?`, storage.Owner(ctx), kind, foreign)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("select: %w", err)
+	}
+	return id, true, nil
+}
+
+func (d *Database) MappingSet(kind, foreign string, id int64, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `INSERT INTO mapping (owner, kind, foreign_uri, local_id) VALUES (?, ?, ?, ?) ON CONFLICT (owner, kind, foreign_uri) DO UPDATE SET local_id = excluded.local_id`, storage.Owner(ctx), kind, foreign, id)
+	return err
+}
+
+func revisionToStorage(r Revision) storage.Revision {
+	var fields []string
+	if r.Fields != "" {
+		fields = strings.Split(r.Fields, ",")
+	}
+	var before []byte
+	if r.ValueBefore != "" {
+		before = []byte(r.ValueBefore)
+	}
+	return storage.Revision{
+		ID:       r.ID,
+		Entity:   r.Entity,
+		EntityID: r.EntityID,
+		Time:     r.Time,
+		Author:   r.Author,
+		Fields:   fields,
+		Before:   before,
+		After:    []byte(r.ValueAfter),
+	}
+}
+
+func (d *Database) Revisions(entity string, id int64, ctx context.Context) ([]storage.Revision, error) {
+	var rs []Revision
+	err := d.q().SelectContext(ctx, &rs, `SELECT * FROM revisions WHERE entity = ? AND entity_id = ? AND owner = ? ORDER BY id DESC`, entity, id, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	rs2 := make([]storage.Revision, len(rs))
+	for i := range rs {
+		rs2[i] = revisionToStorage(rs[i])
+	}
+	return rs2, nil
+}
+
+func (d *Database) RevisionGet(id int64, ctx context.Context) (storage.Revision, error) {
+	var r Revision
+	err := d.q().GetContext(ctx, &r, `SELECT * FROM revisions WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	if err != nil {
+		return storage.Revision{}, fmt.Errorf("select: %w", err)
+	}
+	return revisionToStorage(r), nil
+}
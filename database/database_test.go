@@ -0,0 +1,310 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/linkdata"
+	"nyiyui.ca/jks/storage"
+)
+
+func openTest(t *testing.T) *Database {
+	db, err := Open(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = Migrate(db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Database{DB: db}
+}
+
+func TestActivityDeleteRestore(t *testing.T) {
+	ctx := context.Background()
+	d := openTest(t)
+	taskID, err := d.TaskAdd(storageTask("task"), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	a := storage.Activity{TaskID: taskID, Location: "home", TimeStart: start, TimeEnd: start.Add(time.Hour)}
+	a.ID, err = d.ActivityAdd(a, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planID, err := d.PlanAdd(storage.Plan{TaskID: taskID, ActivityID: a.ID, TimeAtAfter: start, TimeBefore: start.Add(2 * time.Hour)}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.ActivityDelete(a.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ActivityGet(a.ID, ctx); err == nil {
+		t.Fatal("activity still exists after delete")
+	}
+	p, err := d.PlanGet(planID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ActivityID != 0 {
+		t.Fatalf("plan still refers to deleted activity %d", p.ActivityID)
+	}
+	rs, err := d.Revisions(storage.EntityActivity, a.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || len(rs[0].After) != 0 || len(rs[0].Before) == 0 {
+		t.Fatalf("expected an addition and a deletion revision, got %#v", rs)
+	}
+
+	err = d.ActivityRestore(a, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.ActivityGet(a.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := storage.ChangedFields(a, got); len(fields) != 0 {
+		t.Fatalf("restored activity differs in %v", fields)
+	}
+	other := a
+	other.ID = 100
+	id, err := d.ActivityAdd(other, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == other.ID {
+		t.Fatal("ActivityAdd used the given ID")
+	}
+}
+
+func TestTaskEditConflict(t *testing.T) {
+	ctx := context.Background()
+	d := openTest(t)
+	id, err := d.TaskAdd(storageTask("task"), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := d.TaskGet(id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := read
+	first.QuickTitle = "first"
+	err = d.TaskEdit(first, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := read
+	second.QuickTitle = "second"
+	err = d.TaskEdit(second, ctx)
+	if err != storage.ErrConflict {
+		t.Fatalf("stale edit: got %v, want ErrConflict", err)
+	}
+	second.Version = 0
+	err = d.TaskEdit(second, ctx)
+	if err != nil {
+		t.Fatalf("unconditional edit: %s", err)
+	}
+	got, err := d.TaskGet(id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.QuickTitle != "second" || got.Version != 3 {
+		t.Fatalf("got %q at version %d", got.QuickTitle, got.Version)
+	}
+}
+
+func TestWithTxRollback(t *testing.T) {
+	ctx := context.Background()
+	d := openTest(t)
+	fail := errors.New("fail")
+	err := d.WithTx(ctx, func(st storage.Storage) error {
+		id, err := st.TaskAdd(storageTask("task"), ctx)
+		if err != nil {
+			return err
+		}
+		_, err = st.ActivityAdd(storage.Activity{TaskID: id}, ctx)
+		if err != nil {
+			return err
+		}
+		return fail
+	})
+	if err != fail {
+		t.Fatalf("got %v, want the error returned by fn", err)
+	}
+	var count int
+	err = d.DB.Get(&count, `SELECT (SELECT COUNT(*) FROM tasks) + (SELECT COUNT(*) FROM activity_log) + (SELECT COUNT(*) FROM revisions)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d rows left behind by rolled back transaction", count)
+	}
+}
+
+func TestPasskeys(t *testing.T) {
+	d := openTest(t)
+	ctx := context.Background()
+	id, err := d.PasskeyAdd(storage.Passkey{
+		Name:         "laptop",
+		Provider:     "dex",
+		Login:        "alice",
+		UserHandle:   []byte("handle"),
+		CredentialID: []byte("credential"),
+		Credential:   []byte("{}"),
+		Created:      time.Now(),
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.PasskeyAdd(storage.Passkey{Name: "again", CredentialID: []byte("credential"), Created: time.Now()}, ctx)
+	if err == nil {
+		t.Fatal("added a credential twice")
+	}
+	ps, err := d.Passkeys("", "alice", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 0 {
+		t.Fatalf("GitHub user has passkeys %#v", ps)
+	}
+	err = d.PasskeyUsed(id, []byte(`{"used":true}`), time.Now(), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok, err := d.PasskeyByCredentialID([]byte("credential"), ctx)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if p.ID != id || p.Login != "alice" || p.LastUsed == nil || string(p.Credential) != `{"used":true}` {
+		t.Fatalf("passkey %#v", p)
+	}
+	err = d.PasskeyDelete(id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = d.PasskeyByCredentialID([]byte("credential"), ctx)
+	if err != nil || ok {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	d := openTest(t)
+	ctx := context.Background()
+	bob := storage.WithOwner(ctx, "bob")
+	id, err := d.TaskAdd(storage.Task{QuickTitle: "mine"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.TaskGet(id, bob)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("bob got another owner's task: %v", err)
+	}
+	_, err = d.ActivityAdd(storage.Activity{TaskID: id, Location: "here", TimeStart: time.Now(), TimeEnd: time.Now()}, bob)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("bob logged activity on another owner's task: %v", err)
+	}
+	_, err = d.TaskGet(id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, _ := url.Parse("/task/1")
+	dest, _ := url.Parse("https://example.com")
+	err = d.ReplaceLinks(source, []linkdata.Link{{Destination: dest}}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := d.GetLinks(source, bob)
+	if err != nil || len(links) != 0 {
+		t.Fatalf("bob got another owner's links: %v %v", links, err)
+	}
+	backlinks, err := d.GetBacklinks(dest, bob)
+	if err != nil || len(backlinks) != 0 {
+		t.Fatalf("bob got another owner's backlinks: %v %v", backlinks, err)
+	}
+	links, err = d.GetLinks(source, ctx)
+	if err != nil || len(links) != 1 {
+		t.Fatal(links, err)
+	}
+
+	err = d.UserAdd(storage.User{Name: "bob", Created: time.Now()}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, ok, err := d.UserGet("bob", ctx)
+	if err != nil || !ok || u.Approved {
+		t.Fatal(u, ok, err)
+	}
+	u.Approved = true
+	u.Timezone = "Asia/Tokyo"
+	u.Notify = []string{"ntfy+https://ntfy.sh/a", "ntfy+https://ntfy.sh/b"}
+	err = d.UserEdit(u, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := d.Users(ctx)
+	if err != nil || len(us) != 1 || !us[0].Approved || us[0].Timezone != "Asia/Tokyo" || len(us[0].Notify) != 2 {
+		t.Fatal(us, err)
+	}
+	err = d.UserDelete("bob", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = d.UserGet("bob", ctx)
+	if err != nil || ok {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestGrants(t *testing.T) {
+	d := openTest(t)
+	ctx := context.Background()
+	id, err := d.TaskAdd(storage.Task{QuickTitle: "shared"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.TaskSetTags(id, []string{"family"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.GrantAdd(storage.Grant{Grantee: "bob", TaskID: id, Access: storage.AccessLog, Created: time.Now()}, storage.WithOwner(ctx, "bob"))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("bob shared another owner's task: %v", err)
+	}
+	_, err = d.GrantAdd(storage.Grant{Grantee: "bob", TaskID: id, Access: storage.AccessLog, Created: time.Now()}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.GrantAdd(storage.Grant{Grantee: "bob", Tag: "family", Access: storage.AccessRead, Created: time.Now()}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err := d.GrantsTo("bob", storage.WithOwner(ctx, "bob"))
+	if err != nil || len(gs) != 2 || gs[0].TaskID != id || gs[1].Tag != "family" || gs[0].Owner != "" {
+		t.Fatal(gs, err)
+	}
+	ts, err := d.TagTasks("family", ctx)
+	if err != nil || len(ts) != 1 || ts[0].ID != id {
+		t.Fatal(ts, err)
+	}
+	err = d.TaskDelete(id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err = d.Grants(ctx)
+	if err != nil || len(gs) != 1 || gs[0].Tag != "family" {
+		t.Fatal(gs, err)
+	}
+}
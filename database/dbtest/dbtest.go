@@ -0,0 +1,24 @@
+// Package dbtest opens databases for tests.
+package dbtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"nyiyui.ca/jks/database"
+)
+
+// Open returns a migrated database in a temporary directory, which is closed when the test ends.
+func Open(t testing.TB) *database.Database {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = database.Migrate(db.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &database.Database{DB: db}
+}
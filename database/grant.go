@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"nyiyui.ca/jks/storage"
+)
+
+func grantToStorage(g Grant) storage.Grant {
+	g2 := storage.Grant{
+		ID:      g.ID,
+		Owner:   g.Owner,
+		Grantee: g.Grantee,
+		Access:  storage.Access(g.Access),
+		Created: g.Created,
+	}
+	if g.TaskID != nil {
+		g2.TaskID = *g.TaskID
+	}
+	if g.Tag != nil {
+		g2.Tag = *g.Tag
+	}
+	return g2
+}
+
+func grantsToStorage(gs []Grant) []storage.Grant {
+	gs2 := make([]storage.Grant, len(gs))
+	for i := range gs {
+		gs2[i] = grantToStorage(gs[i])
+	}
+	return gs2
+}
+
+func (d *Database) Grants(ctx context.Context) ([]storage.Grant, error) {
+	var gs []Grant
+	err := d.q().SelectContext(ctx, &gs, `SELECT * FROM grants WHERE owner = ? ORDER BY id`, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	return grantsToStorage(gs), nil
+}
+
+func (d *Database) GrantsTo(grantee string, ctx context.Context) ([]storage.Grant, error) {
+	var gs []Grant
+	err := d.q().SelectContext(ctx, &gs, `SELECT * FROM grants WHERE grantee = ? ORDER BY id`, grantee)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	return grantsToStorage(gs), nil
+}
+
+func (d *Database) GrantAdd(g storage.Grant, ctx context.Context) (id int64, err error) {
+	var taskID *int64
+	var tag *string
+	if g.TaskID != 0 {
+		taskID = &g.TaskID
+	} else {
+		tag = &g.Tag
+	}
+	err = d.tx(ctx, func(tx *sqlx.Tx) error {
+		if taskID != nil {
+			err := owns(tx, "tasks", *taskID, ctx)
+			if err != nil {
+				return err
+			}
+		}
+		res, err := tx.ExecContext(ctx, `INSERT INTO grants (owner, grantee, task_id, tag, access, created) VALUES (?, ?, ?, ?, ?, ?)`, storage.Owner(ctx), g.Grantee, taskID, tag, string(g.Access), g.Created.Unix())
+		if err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+func (d *Database) GrantDelete(id int64, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `DELETE FROM grants WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	return err
+}
@@ -0,0 +1,24 @@
+CREATE TABLE webhooks(
+  id INTEGER PRIMARY KEY,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  events TEXT NOT NULL, -- comma-separated, empty for all events
+  active BOOLEAN NOT NULL
+);
+
+CREATE TABLE deliveries(
+  id INTEGER PRIMARY KEY,
+  webhook_id INTEGER NOT NULL,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL, -- JSON
+  created DATETIME NOT NULL, -- in Unix time
+  attempts INTEGER NOT NULL,
+  last_attempt DATETIME, -- in Unix time
+  status_code INTEGER NOT NULL,
+  error TEXT NOT NULL,
+  next_attempt DATETIME, -- in Unix time, NULL if done
+  delivered BOOLEAN NOT NULL,
+  FOREIGN KEY(webhook_id) REFERENCES webhooks(id)
+);
+CREATE INDEX deliveries_webhook ON deliveries(webhook_id);
+CREATE INDEX deliveries_next_attempt ON deliveries(next_attempt);
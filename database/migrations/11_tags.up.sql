@@ -0,0 +1,7 @@
+CREATE TABLE task_tags(
+  task_id INTEGER NOT NULL,
+  tag TEXT NOT NULL,
+  PRIMARY KEY(task_id, tag),
+  FOREIGN KEY(task_id) REFERENCES tasks(id)
+);
+CREATE INDEX task_tags_tag ON task_tags(tag);
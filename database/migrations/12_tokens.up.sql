@@ -0,0 +1,7 @@
+CREATE TABLE api_tokens(
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  hash TEXT NOT NULL UNIQUE, -- hex SHA-256 of the token
+  created DATETIME NOT NULL, -- in Unix time
+  last_used DATETIME -- in Unix time
+);
@@ -0,0 +1,7 @@
+CREATE TABLE occurrences(
+  rule TEXT NOT NULL,
+  time DATETIME NOT NULL, -- in Unix time
+  task_id INTEGER NOT NULL UNIQUE,
+  PRIMARY KEY(rule, time),
+  FOREIGN KEY(task_id) REFERENCES tasks(id)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE recurrences(
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  rset TEXT NOT NULL, -- DTSTART, RRULE, RDATE and EXDATE lines
+  exdays TEXT NOT NULL, -- comma-separated dates (2006-01-02)
+  quick_title TEXT NOT NULL,
+  description TEXT NOT NULL,
+  active BOOLEAN NOT NULL
+);
@@ -0,0 +1,7 @@
+ALTER TABLE recurrences DROP COLUMN plan_duration_lt;
+ALTER TABLE recurrences DROP COLUMN plan_duration_ge;
+ALTER TABLE recurrences DROP COLUMN plan_time_before_offset;
+ALTER TABLE recurrences DROP COLUMN plan_time_at_after_offset;
+ALTER TABLE recurrences DROP COLUMN plan_location;
+ALTER TABLE recurrences DROP COLUMN plan;
+ALTER TABLE occurrences DROP COLUMN plan_id;
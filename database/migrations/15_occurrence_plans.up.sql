@@ -0,0 +1,8 @@
+ALTER TABLE occurrences ADD COLUMN plan_id INTEGER REFERENCES plans(id); -- NULL if no plan was added
+ALTER TABLE recurrences ADD COLUMN plan BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE recurrences ADD COLUMN plan_location TEXT NOT NULL DEFAULT '';
+-- offsets and durations are in nanoseconds (as in plans)
+ALTER TABLE recurrences ADD COLUMN plan_time_at_after_offset INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recurrences ADD COLUMN plan_time_before_offset INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recurrences ADD COLUMN plan_duration_ge INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recurrences ADD COLUMN plan_duration_lt INTEGER NOT NULL DEFAULT 0;
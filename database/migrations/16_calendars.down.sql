@@ -0,0 +1,3 @@
+DROP TABLE recurrence_calendars;
+DROP TABLE calendar_ranges;
+DROP TABLE calendars;
@@ -0,0 +1,19 @@
+CREATE TABLE calendars(
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL
+);
+CREATE TABLE calendar_ranges(
+  calendar_id INTEGER NOT NULL,
+  start TEXT NOT NULL, -- 2006-01-02
+  end TEXT NOT NULL, -- 2006-01-02, inclusive
+  summary TEXT NOT NULL,
+  FOREIGN KEY(calendar_id) REFERENCES calendars(id)
+);
+CREATE INDEX calendar_ranges_calendar ON calendar_ranges(calendar_id);
+CREATE TABLE recurrence_calendars(
+  recurrence_id INTEGER NOT NULL,
+  calendar_id INTEGER NOT NULL,
+  PRIMARY KEY(recurrence_id, calendar_id),
+  FOREIGN KEY(recurrence_id) REFERENCES recurrences(id),
+  FOREIGN KEY(calendar_id) REFERENCES calendars(id)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE passkeys(
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  provider TEXT NOT NULL, -- of the user who registered the passkey
+  login TEXT NOT NULL,
+  user_handle BLOB NOT NULL,
+  credential_id BLOB NOT NULL UNIQUE,
+  credential BLOB NOT NULL, -- JSON
+  created DATETIME NOT NULL, -- in Unix time
+  last_used DATETIME -- in Unix time
+);
@@ -0,0 +1,37 @@
+DROP TABLE users;
+
+DROP TABLE links;
+
+CREATE TABLE occurrences_unowned(
+  rule TEXT NOT NULL,
+  time DATETIME NOT NULL, -- in Unix time
+  task_id INTEGER NOT NULL UNIQUE,
+  plan_id INTEGER REFERENCES plans(id), -- NULL if no plan was added
+  PRIMARY KEY(rule, time),
+  FOREIGN KEY(task_id) REFERENCES tasks(id)
+);
+INSERT INTO occurrences_unowned (rule, time, task_id, plan_id) SELECT rule, time, task_id, plan_id FROM occurrences WHERE owner = '';
+DROP TABLE occurrences;
+ALTER TABLE occurrences_unowned RENAME TO occurrences;
+
+CREATE TABLE mapping_unowned(
+  kind TEXT NOT NULL,
+  foreign_uri TEXT NOT NULL,
+  local_id INTEGER NOT NULL,
+  PRIMARY KEY(kind, foreign_uri)
+);
+INSERT INTO mapping_unowned (kind, foreign_uri, local_id) SELECT kind, foreign_uri, local_id FROM mapping WHERE owner = '';
+DROP TABLE mapping;
+ALTER TABLE mapping_unowned RENAME TO mapping;
+
+DROP INDEX plans_owner;
+DROP INDEX activity_log_owner;
+DROP INDEX tasks_owner;
+ALTER TABLE api_tokens DROP COLUMN owner;
+ALTER TABLE webhooks DROP COLUMN owner;
+ALTER TABLE calendars DROP COLUMN owner;
+ALTER TABLE recurrences DROP COLUMN owner;
+ALTER TABLE revisions DROP COLUMN owner;
+ALTER TABLE plans DROP COLUMN owner;
+ALTER TABLE activity_log DROP COLUMN owner;
+ALTER TABLE tasks DROP COLUMN owner;
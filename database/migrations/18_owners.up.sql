@@ -0,0 +1,55 @@
+-- rows owned by '' are the main user's, as before there were other users
+ALTER TABLE tasks ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE activity_log ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE plans ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE revisions ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE recurrences ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE calendars ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhooks ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_tokens ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+CREATE INDEX tasks_owner ON tasks(owner);
+CREATE INDEX activity_log_owner ON activity_log(owner);
+CREATE INDEX plans_owner ON plans(owner);
+
+-- rebuilt, as each owner has their own keys
+CREATE TABLE mapping_owned(
+  owner TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  foreign_uri TEXT NOT NULL,
+  local_id INTEGER NOT NULL,
+  PRIMARY KEY(owner, kind, foreign_uri)
+);
+INSERT INTO mapping_owned (owner, kind, foreign_uri, local_id) SELECT '', kind, foreign_uri, local_id FROM mapping;
+DROP TABLE mapping;
+ALTER TABLE mapping_owned RENAME TO mapping;
+
+CREATE TABLE occurrences_owned(
+  owner TEXT NOT NULL,
+  rule TEXT NOT NULL,
+  time DATETIME NOT NULL, -- in Unix time
+  task_id INTEGER NOT NULL UNIQUE,
+  plan_id INTEGER REFERENCES plans(id), -- NULL if no plan was added
+  PRIMARY KEY(owner, rule, time),
+  FOREIGN KEY(task_id) REFERENCES tasks(id)
+);
+INSERT INTO occurrences_owned (owner, rule, time, task_id, plan_id) SELECT '', rule, time, task_id, plan_id FROM occurrences;
+DROP TABLE occurrences;
+ALTER TABLE occurrences_owned RENAME TO occurrences;
+
+-- links were queried, but never created
+CREATE TABLE links(
+  owner TEXT NOT NULL,
+  source TEXT NOT NULL, -- URL of the task or activity, e.g. /task/1
+  label TEXT NOT NULL,
+  destination TEXT NOT NULL
+);
+CREATE INDEX links_source ON links(owner, source);
+CREATE INDEX links_destination ON links(owner, destination);
+
+CREATE TABLE users(
+  name TEXT PRIMARY KEY, -- as in revisions.author, e.g. alice or dex:alice
+  approved BOOLEAN NOT NULL, -- false for registrations awaiting an admin
+  admin BOOLEAN NOT NULL,
+  timezone TEXT NOT NULL, -- IANA name, empty for UTC
+  created DATETIME NOT NULL -- in Unix time
+);
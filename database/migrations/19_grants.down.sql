@@ -0,0 +1,2 @@
+DROP INDEX grants_grantee;
+DROP TABLE grants;
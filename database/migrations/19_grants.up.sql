@@ -0,0 +1,11 @@
+CREATE TABLE grants(
+  id INTEGER PRIMARY KEY,
+  owner TEXT NOT NULL, -- of the shared tasks
+  grantee TEXT NOT NULL, -- users.name
+  task_id INTEGER REFERENCES tasks(id), -- NULL if tag is set
+  tag TEXT, -- NULL if task_id is set
+  access TEXT NOT NULL, -- read or log
+  created DATETIME NOT NULL, -- in Unix time
+  CHECK ((task_id IS NULL) != (tag IS NULL))
+);
+CREATE INDEX grants_grantee ON grants(grantee);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN notify TEXT NOT NULL DEFAULT ''; -- where reminders are sent, one per line
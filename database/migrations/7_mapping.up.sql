@@ -0,0 +1,6 @@
+CREATE TABLE mapping(
+  kind TEXT NOT NULL,
+  foreign_uri TEXT NOT NULL,
+  local_id INTEGER NOT NULL,
+  PRIMARY KEY(kind, foreign_uri)
+);
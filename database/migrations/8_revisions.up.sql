@@ -0,0 +1,11 @@
+CREATE TABLE revisions(
+  id INTEGER PRIMARY KEY,
+  entity TEXT NOT NULL, -- task, activity or plan
+  entity_id INTEGER NOT NULL,
+  time DATETIME NOT NULL, -- in Unix time
+  author TEXT NOT NULL,
+  fields TEXT NOT NULL, -- comma-separated
+  value_before TEXT NOT NULL, -- JSON, empty for additions
+  value_after TEXT NOT NULL -- JSON
+);
+CREATE INDEX revisions_entity ON revisions(entity, entity_id);
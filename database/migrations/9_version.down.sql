@@ -0,0 +1,3 @@
+ALTER TABLE plans DROP COLUMN version;
+ALTER TABLE activity_log DROP COLUMN version;
+ALTER TABLE tasks DROP COLUMN version;
@@ -0,0 +1,3 @@
+ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE activity_log ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE plans ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func (d *Database) OccurrenceGet(rule string, t time.Time, ctx context.Context) (o storage.Occurrence, ok bool, err error) {
+	var o2 Occurrence
+	err = d.q().GetContext(ctx, &o2, `SELECT * FROM occurrences WHERE owner = ? AND rule = ? AND time = ?`, storage.Owner(ctx), rule, t.Unix())
+	if err == sql.ErrNoRows {
+		return storage.Occurrence{}, false, nil
+	}
+	if err != nil {
+		return storage.Occurrence{}, false, fmt.Errorf("select: %w", err)
+	}
+	return occurrenceToStorage(o2), true, nil
+}
+
+func occurrenceToStorage(o Occurrence) storage.Occurrence {
+	o2 := storage.Occurrence{Rule: o.Rule, Time: o.Time, TaskID: o.TaskID}
+	if o.PlanID != nil {
+		o2.PlanID = *o.PlanID
+	}
+	return o2
+}
+
+func (d *Database) OccurrenceRange(rule string, a, b time.Time, ctx context.Context) ([]storage.Occurrence, error) {
+	var os []Occurrence
+	err := d.q().SelectContext(ctx, &os, `SELECT * FROM occurrences WHERE owner = ? AND rule = ? AND time >= ? AND time <= ? ORDER BY time`, storage.Owner(ctx), rule, a.Unix(), b.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	os2 := make([]storage.Occurrence, len(os))
+	for i := range os {
+		os2[i] = occurrenceToStorage(os[i])
+	}
+	return os2, nil
+}
+
+func (d *Database) OccurrenceSet(o storage.Occurrence, ctx context.Context) error {
+	err := owns(d.q(), "tasks", o.TaskID, ctx)
+	if err != nil {
+		return err
+	}
+	var planID *int64
+	if o.PlanID != 0 {
+		err = owns(d.q(), "plans", o.PlanID, ctx)
+		if err != nil {
+			return err
+		}
+		planID = &o.PlanID
+	}
+	_, err = d.q().ExecContext(ctx, `INSERT INTO occurrences (owner, rule, time, task_id, plan_id) VALUES (?, ?, ?, ?, ?) ON CONFLICT (owner, rule, time) DO UPDATE SET task_id = excluded.task_id, plan_id = excluded.plan_id`, storage.Owner(ctx), o.Rule, o.Time.Unix(), o.TaskID, planID)
+	return err
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func passkeyToStorage(p Passkey) storage.Passkey {
+	return storage.Passkey{
+		ID:           p.ID,
+		Name:         p.Name,
+		Provider:     p.Provider,
+		Login:        p.Login,
+		UserHandle:   p.UserHandle,
+		CredentialID: p.CredentialID,
+		Credential:   p.Credential,
+		Created:      p.Created,
+		LastUsed:     p.LastUsed,
+	}
+}
+
+func (d *Database) Passkeys(provider, login string, ctx context.Context) ([]storage.Passkey, error) {
+	var ps []Passkey
+	var err error
+	if provider == "" && login == "" {
+		err = d.q().SelectContext(ctx, &ps, `SELECT * FROM passkeys ORDER BY id`)
+	} else {
+		err = d.q().SelectContext(ctx, &ps, `SELECT * FROM passkeys WHERE provider = ? AND login = ? ORDER BY id`, provider, login)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	ps2 := make([]storage.Passkey, len(ps))
+	for i := range ps {
+		ps2[i] = passkeyToStorage(ps[i])
+	}
+	return ps2, nil
+}
+
+func (d *Database) PasskeyByCredentialID(credentialID []byte, ctx context.Context) (p storage.Passkey, ok bool, err error) {
+	var p2 Passkey
+	err = d.q().GetContext(ctx, &p2, `SELECT * FROM passkeys WHERE credential_id = ?`, credentialID)
+	if err == sql.ErrNoRows {
+		return storage.Passkey{}, false, nil
+	}
+	if err != nil {
+		return storage.Passkey{}, false, fmt.Errorf("select: %w", err)
+	}
+	return passkeyToStorage(p2), true, nil
+}
+
+func (d *Database) PasskeyAdd(p storage.Passkey, ctx context.Context) (id int64, err error) {
+	res, err := d.q().ExecContext(ctx, `INSERT INTO passkeys (name, provider, login, user_handle, credential_id, credential, created) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Provider, p.Login, p.UserHandle, p.CredentialID, p.Credential, p.Created.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (d *Database) PasskeyUsed(id int64, credential []byte, t time.Time, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `UPDATE passkeys SET credential = ?, last_used = ? WHERE id = ?`, credential, t.Unix(), id)
+	return err
+}
+
+func (d *Database) PasskeyDelete(id int64, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `DELETE FROM passkeys WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"nyiyui.ca/jks/storage"
+)
+
+func recurrenceToStorage(r Recurrence) (storage.Recurrence, error) {
+	var exDays []time.Time
+	if r.ExDays != "" {
+		for _, s := range strings.Split(r.ExDays, ",") {
+			day, err := time.Parse(time.DateOnly, s)
+			if err != nil {
+				return storage.Recurrence{}, fmt.Errorf("recurrence %d: %w", r.ID, err)
+			}
+			exDays = append(exDays, day)
+		}
+	}
+	var plan *storage.PlanTemplate
+	if r.Plan {
+		plan = &storage.PlanTemplate{
+			Location:          r.PlanLocation,
+			TimeAtAfterOffset: r.PlanTimeAtAfterOffset,
+			TimeBeforeOffset:  r.PlanTimeBeforeOffset,
+			DurationGe:        r.PlanDurationGe,
+			DurationLt:        r.PlanDurationLt,
+		}
+	}
+	return storage.Recurrence{
+		ID:     r.ID,
+		Name:   r.Name,
+		Set:    r.RSet,
+		ExDays: exDays,
+		Task: storage.Task{
+			QuickTitle:  r.QuickTitle,
+			Description: r.Description,
+		},
+		Plan:   plan,
+		Active: r.Active,
+	}, nil
+}
+
+func joinDays(days []time.Time) string {
+	ss := make([]string, len(days))
+	for i, day := range days {
+		ss[i] = day.Format(time.DateOnly)
+	}
+	return strings.Join(ss, ",")
+}
+
+func (d *Database) Recurrences(ctx context.Context) ([]storage.Recurrence, error) {
+	var rs []Recurrence
+	err := d.q().SelectContext(ctx, &rs, `SELECT * FROM recurrences WHERE owner = ? ORDER BY id`, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	rs2 := make([]storage.Recurrence, len(rs))
+	for i := range rs {
+		rs2[i], err = recurrenceToStorage(rs[i])
+		if err != nil {
+			return nil, err
+		}
+		rs2[i].CalendarIDs, err = d.recurrenceCalendars(rs[i].ID, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rs2, nil
+}
+
+func (d *Database) recurrenceCalendars(id int64, ctx context.Context) ([]int64, error) {
+	var ids []int64
+	err := d.q().SelectContext(ctx, &ids, `SELECT calendar_id FROM recurrence_calendars WHERE recurrence_id = ? ORDER BY calendar_id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("select calendars: %w", err)
+	}
+	return ids, nil
+}
+
+func setRecurrenceCalendars(tx *sqlx.Tx, id int64, calendarIDs []int64, ctx context.Context) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recurrence_calendars WHERE recurrence_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	for _, calendarID := range calendarIDs {
+		err = owns(tx, "calendars", calendarID, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO recurrence_calendars (recurrence_id, calendar_id) VALUES (?, ?) ON CONFLICT DO NOTHING`, id, calendarID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Database) RecurrenceGet(id int64, ctx context.Context) (storage.Recurrence, error) {
+	var r Recurrence
+	err := d.q().GetContext(ctx, &r, `SELECT * FROM recurrences WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	if err != nil {
+		return storage.Recurrence{}, fmt.Errorf("select: %w", err)
+	}
+	r2, err := recurrenceToStorage(r)
+	if err != nil {
+		return storage.Recurrence{}, err
+	}
+	r2.CalendarIDs, err = d.recurrenceCalendars(id, ctx)
+	return r2, err
+}
+
+// planColumns returns the values of the plan_* columns of recurrences.
+func planColumns(p *storage.PlanTemplate) (plan bool, location string, timeAtAfterOffset, timeBeforeOffset, durationGe, durationLt time.Duration) {
+	if p == nil {
+		return
+	}
+	return true, p.Location, p.TimeAtAfterOffset, p.TimeBeforeOffset, p.DurationGe, p.DurationLt
+}
+
+func (d *Database) RecurrenceAdd(r storage.Recurrence, ctx context.Context) (id int64, err error) {
+	plan, location, timeAtAfterOffset, timeBeforeOffset, durationGe, durationLt := planColumns(r.Plan)
+	err = d.tx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `INSERT INTO recurrences (name, rset, exdays, quick_title, description, active, plan, plan_location, plan_time_at_after_offset, plan_time_before_offset, plan_duration_ge, plan_duration_lt, owner) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Name, r.Set, joinDays(r.ExDays), r.Task.QuickTitle, r.Task.Description, r.Active,
+			plan, location, timeAtAfterOffset, timeBeforeOffset, durationGe, durationLt, storage.Owner(ctx))
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return setRecurrenceCalendars(tx, id, r.CalendarIDs, ctx)
+	})
+	return
+}
+
+func (d *Database) RecurrenceEdit(r storage.Recurrence, ctx context.Context) error {
+	plan, location, timeAtAfterOffset, timeBeforeOffset, durationGe, durationLt := planColumns(r.Plan)
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "recurrences", r.ID, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE recurrences SET name = ?, rset = ?, exdays = ?, quick_title = ?, description = ?, active = ?, plan = ?, plan_location = ?, plan_time_at_after_offset = ?, plan_time_before_offset = ?, plan_duration_ge = ?, plan_duration_lt = ? WHERE id = ?`,
+			r.Name, r.Set, joinDays(r.ExDays), r.Task.QuickTitle, r.Task.Description, r.Active,
+			plan, location, timeAtAfterOffset, timeBeforeOffset, durationGe, durationLt, r.ID)
+		if err != nil {
+			return err
+		}
+		return setRecurrenceCalendars(tx, r.ID, r.CalendarIDs, ctx)
+	})
+}
+
+func (d *Database) RecurrenceDelete(id int64, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "recurrences", id, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM occurrences WHERE owner = ? AND rule = ?`, storage.Owner(ctx), storage.Recurrence{ID: id}.OccurrenceRule())
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM recurrence_calendars WHERE recurrence_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM recurrences WHERE id = ?`, id)
+		return err
+	})
+}
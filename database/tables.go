@@ -13,6 +13,8 @@ type Task struct {
 	// In the future, this may become a reference to another task, such that once that task is started, this task is useless to complete..
 	Deadline *time.Time `db:"deadline"`
 	Due      *time.Time `db:"due"`
+	Version  int64
+	Owner    string
 }
 
 func (t Task) GetID() int64 { return t.ID }
@@ -29,6 +31,8 @@ type Activity struct {
 	TimeEnd   time.Time `db:"time_end"`
 	Status    Status
 	Note      string
+	Version   int64
+	Owner     string
 }
 
 func (a Activity) GetID() int64 { return a.ID }
@@ -62,6 +66,122 @@ type Plan struct {
 	TimeBefore  time.Time     `db:"time_before"`
 	DurationGe  time.Duration `db:"duration_ge"`
 	DurationLt  time.Duration `db:"duration_lt"`
+	Version     int64
+	Owner       string
 }
 
 func (p Plan) GetID() int64 { return p.ID }
+
+type Revision struct {
+	ID          int64
+	Entity      string
+	EntityID    int64 `db:"entity_id"`
+	Time        time.Time
+	Author      string
+	Fields      string
+	ValueBefore string `db:"value_before"`
+	ValueAfter  string `db:"value_after"`
+	Owner       string
+}
+
+type Webhook struct {
+	ID     int64
+	URL    string
+	Secret string
+	Events string
+	Active bool
+	Owner  string
+}
+
+type Delivery struct {
+	ID          int64
+	WebhookID   int64  `db:"webhook_id"`
+	EventType   string `db:"event_type"`
+	Payload     string
+	Created     time.Time
+	Attempts    int
+	LastAttempt *time.Time `db:"last_attempt"`
+	StatusCode  int        `db:"status_code"`
+	Error       string
+	NextAttempt *time.Time `db:"next_attempt"`
+	Delivered   bool
+}
+
+type Token struct {
+	ID       int64
+	Name     string
+	Hash     string
+	Created  time.Time
+	LastUsed *time.Time `db:"last_used"`
+	Owner    string
+}
+
+type Passkey struct {
+	ID           int64
+	Name         string
+	Provider     string
+	Login        string
+	UserHandle   []byte `db:"user_handle"`
+	CredentialID []byte `db:"credential_id"`
+	Credential   []byte
+	Created      time.Time
+	LastUsed     *time.Time `db:"last_used"`
+}
+
+type Occurrence struct {
+	Rule   string
+	Time   time.Time
+	TaskID int64  `db:"task_id"`
+	PlanID *int64 `db:"plan_id"`
+	Owner  string
+}
+
+type Recurrence struct {
+	ID          int64
+	Name        string
+	RSet        string `db:"rset"`
+	ExDays      string `db:"exdays"`
+	QuickTitle  string `db:"quick_title"`
+	Description string
+	Active      bool
+	Owner       string
+
+	Plan                  bool
+	PlanLocation          string        `db:"plan_location"`
+	PlanTimeAtAfterOffset time.Duration `db:"plan_time_at_after_offset"`
+	PlanTimeBeforeOffset  time.Duration `db:"plan_time_before_offset"`
+	PlanDurationGe        time.Duration `db:"plan_duration_ge"`
+	PlanDurationLt        time.Duration `db:"plan_duration_lt"`
+}
+
+type Calendar struct {
+	ID    int64
+	Name  string
+	Owner string
+}
+
+type CalendarRange struct {
+	CalendarID int64 `db:"calendar_id"`
+	Start      string
+	End        string
+	Summary    string
+}
+
+type User struct {
+	Name     string
+	Approved bool
+	Admin    bool
+	Timezone string
+	Notify   string
+	Created  time.Time
+}
+
+type Grant struct {
+	ID      int64
+	Owner   string
+	Grantee string
+	TaskID  *int64 `db:"task_id"`
+	Tag     *string
+	Access  string
+	Created time.Time
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"nyiyui.ca/jks/storage"
+)
+
+func (d *Database) TaskTags(id int64, ctx context.Context) ([]string, error) {
+	tags := []string{}
+	err := d.q().SelectContext(ctx, &tags, `SELECT tag FROM task_tags JOIN tasks ON (tasks.id = task_tags.task_id) WHERE task_id = ? AND tasks.owner = ? ORDER BY tag`, id, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	return tags, nil
+}
+
+func (d *Database) TaskSetTags(id int64, tags []string, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "tasks", id, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM task_tags WHERE task_id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("delete: %w", err)
+		}
+		for _, tag := range tags {
+			_, err = tx.ExecContext(ctx, `INSERT INTO task_tags (task_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING`, id, tag)
+			if err != nil {
+				return fmt.Errorf("insert: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Database) TagTasks(tag string, ctx context.Context) ([]storage.Task, error) {
+	var ts []Task
+	err := d.q().SelectContext(ctx, &ts, `SELECT tasks.* FROM tasks JOIN task_tags ON (tasks.id = task_tags.task_id) WHERE tag = ? AND `+ownerWhere+` ORDER BY tasks.id DESC`, tag, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	ts2 := make([]storage.Task, len(ts))
+	for i := range ts {
+		ts2[i] = taskToStorage(ts[i])
+	}
+	return ts2, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func tokenToStorage(t Token) storage.Token {
+	return storage.Token{
+		ID:       t.ID,
+		Name:     t.Name,
+		Hash:     t.Hash,
+		Created:  t.Created,
+		LastUsed: t.LastUsed,
+		Owner:    t.Owner,
+	}
+}
+
+func (d *Database) Tokens(ctx context.Context) ([]storage.Token, error) {
+	var ts []Token
+	err := d.q().SelectContext(ctx, &ts, `SELECT * FROM api_tokens WHERE owner = ? ORDER BY id`, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	ts2 := make([]storage.Token, len(ts))
+	for i := range ts {
+		ts2[i] = tokenToStorage(ts[i])
+	}
+	return ts2, nil
+}
+
+func (d *Database) TokenByHash(hash string, ctx context.Context) (t storage.Token, ok bool, err error) {
+	var t2 Token
+	err = d.q().GetContext(ctx, &t2, `SELECT * FROM api_tokens WHERE hash = ?`, hash)
+	if err == sql.ErrNoRows {
+		return storage.Token{}, false, nil
+	}
+	if err != nil {
+		return storage.Token{}, false, fmt.Errorf("select: %w", err)
+	}
+	return tokenToStorage(t2), true, nil
+}
+
+func (d *Database) TokenAdd(t storage.Token, ctx context.Context) (id int64, err error) {
+	res, err := d.q().ExecContext(ctx, `INSERT INTO api_tokens (name, hash, created, owner) VALUES (?, ?, ?, ?)`, t.Name, t.Hash, t.Created.Unix(), storage.Owner(ctx))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (d *Database) TokenUsed(id int64, t time.Time, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `UPDATE api_tokens SET last_used = ? WHERE id = ? AND owner = ?`, t.Unix(), id, storage.Owner(ctx))
+	return err
+}
+
+func (d *Database) TokenDelete(id int64, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	return err
+}
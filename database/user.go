@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func userToStorage(u User) storage.User {
+	return storage.User{
+		Name:     u.Name,
+		Approved: u.Approved,
+		Admin:    u.Admin,
+		Timezone: u.Timezone,
+		Notify:   strings.Fields(u.Notify),
+		Created:  u.Created,
+	}
+}
+
+func (d *Database) Users(ctx context.Context) ([]storage.User, error) {
+	var us []User
+	err := d.q().SelectContext(ctx, &us, `SELECT * FROM users ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	us2 := make([]storage.User, len(us))
+	for i := range us {
+		us2[i] = userToStorage(us[i])
+	}
+	return us2, nil
+}
+
+func (d *Database) UserGet(name string, ctx context.Context) (u storage.User, ok bool, err error) {
+	var u2 User
+	err = d.q().GetContext(ctx, &u2, `SELECT * FROM users WHERE name = ?`, name)
+	if err == sql.ErrNoRows {
+		return storage.User{}, false, nil
+	}
+	if err != nil {
+		return storage.User{}, false, fmt.Errorf("select: %w", err)
+	}
+	return userToStorage(u2), true, nil
+}
+
+func (d *Database) UserAdd(u storage.User, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `INSERT INTO users (name, approved, admin, timezone, notify, created) VALUES (?, ?, ?, ?, ?, ?)`, u.Name, u.Approved, u.Admin, u.Timezone, strings.Join(u.Notify, "\n"), u.Created.Unix())
+	return err
+}
+
+func (d *Database) UserEdit(u storage.User, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `UPDATE users SET approved = ?, admin = ?, timezone = ?, notify = ? WHERE name = ?`, u.Approved, u.Admin, u.Timezone, strings.Join(u.Notify, "\n"), u.Name)
+	return err
+}
+
+func (d *Database) UserDelete(name string, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `DELETE FROM users WHERE name = ?`, name)
+	return err
+}
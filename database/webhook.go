@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"nyiyui.ca/jks/storage"
+)
+
+func webhookToStorage(h Webhook) storage.Webhook {
+	var events []string
+	if h.Events != "" {
+		events = strings.Split(h.Events, ",")
+	}
+	return storage.Webhook{
+		ID:     h.ID,
+		URL:    h.URL,
+		Secret: h.Secret,
+		Events: events,
+		Active: h.Active,
+	}
+}
+
+func (d *Database) Webhooks(ctx context.Context) ([]storage.Webhook, error) {
+	var hs []Webhook
+	err := d.q().SelectContext(ctx, &hs, `SELECT * FROM webhooks WHERE owner = ? ORDER BY id`, storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	hs2 := make([]storage.Webhook, len(hs))
+	for i := range hs {
+		hs2[i] = webhookToStorage(hs[i])
+	}
+	return hs2, nil
+}
+
+func (d *Database) WebhookGet(id int64, ctx context.Context) (storage.Webhook, error) {
+	var h Webhook
+	err := d.q().GetContext(ctx, &h, `SELECT * FROM webhooks WHERE id = ? AND owner = ?`, id, storage.Owner(ctx))
+	if err != nil {
+		return storage.Webhook{}, fmt.Errorf("select: %w", err)
+	}
+	return webhookToStorage(h), nil
+}
+
+func (d *Database) WebhookAdd(h storage.Webhook, ctx context.Context) (id int64, err error) {
+	res, err := d.q().ExecContext(ctx, `INSERT INTO webhooks (url, secret, events, active, owner) VALUES (?, ?, ?, ?, ?)`, h.URL, h.Secret, strings.Join(h.Events, ","), h.Active, storage.Owner(ctx))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (d *Database) WebhookEdit(h storage.Webhook, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `UPDATE webhooks SET url = ?, secret = ?, events = ?, active = ? WHERE id = ? AND owner = ?`, h.URL, h.Secret, strings.Join(h.Events, ","), h.Active, h.ID, storage.Owner(ctx))
+	return err
+}
+
+func (d *Database) WebhookDelete(id int64, ctx context.Context) error {
+	return d.tx(ctx, func(tx *sqlx.Tx) error {
+		err := owns(tx, "webhooks", id, ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM deliveries WHERE webhook_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+		return err
+	})
+}
+
+// unixOrNil converts t for a nullable DATETIME column.
+func unixOrNil(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	u := t.Unix()
+	return &u
+}
+
+func deliveryToStorage(d Delivery) storage.Delivery {
+	return storage.Delivery{
+		ID:          d.ID,
+		WebhookID:   d.WebhookID,
+		EventType:   d.EventType,
+		Payload:     []byte(d.Payload),
+		Created:     d.Created,
+		Attempts:    d.Attempts,
+		LastAttempt: d.LastAttempt,
+		StatusCode:  d.StatusCode,
+		Error:       d.Error,
+		NextAttempt: d.NextAttempt,
+		Delivered:   d.Delivered,
+	}
+}
+
+func (d *Database) DeliveryAdd(v storage.Delivery, ctx context.Context) (id int64, err error) {
+	err = owns(d.q(), "webhooks", v.WebhookID, ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := d.q().ExecContext(ctx, `INSERT INTO deliveries (webhook_id, event_type, payload, created, attempts, last_attempt, status_code, error, next_attempt, delivered) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		v.WebhookID,
+		v.EventType,
+		string(v.Payload),
+		v.Created.Unix(),
+		v.Attempts,
+		unixOrNil(v.LastAttempt),
+		v.StatusCode,
+		v.Error,
+		unixOrNil(v.NextAttempt),
+		v.Delivered,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = d.q().ExecContext(ctx, `DELETE FROM deliveries WHERE webhook_id = ? AND next_attempt IS NULL AND id NOT IN (SELECT id FROM deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?)`, v.WebhookID, v.WebhookID, storage.MaxDeliveries)
+	if err != nil {
+		return 0, fmt.Errorf("prune: %w", err)
+	}
+	return id, nil
+}
+
+// DeliveryEdit updates the outcome of the delivery; the webhook, event and payload cannot be changed.
+func (d *Database) DeliveryEdit(v storage.Delivery, ctx context.Context) error {
+	_, err := d.q().ExecContext(ctx, `UPDATE deliveries SET attempts = ?, last_attempt = ?, status_code = ?, error = ?, next_attempt = ?, delivered = ? WHERE id = ? AND webhook_id IN (SELECT id FROM webhooks WHERE owner = ?)`,
+		v.Attempts,
+		unixOrNil(v.LastAttempt),
+		v.StatusCode,
+		v.Error,
+		unixOrNil(v.NextAttempt),
+		v.Delivered,
+		v.ID,
+		storage.Owner(ctx),
+	)
+	return err
+}
+
+func (d *Database) Deliveries(webhookID int64, limit int, ctx context.Context) ([]storage.Delivery, error) {
+	var ds []Delivery
+	err := d.q().SelectContext(ctx, &ds, `SELECT deliveries.* FROM deliveries JOIN webhooks ON (webhooks.id = deliveries.webhook_id) WHERE webhook_id = ? AND webhooks.owner = ? ORDER BY deliveries.id DESC LIMIT ?`, webhookID, storage.Owner(ctx), limit)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	ds2 := make([]storage.Delivery, len(ds))
+	for i := range ds {
+		ds2[i] = deliveryToStorage(ds[i])
+	}
+	return ds2, nil
+}
+
+func (d *Database) DeliveriesDue(t time.Time, ctx context.Context) ([]storage.Delivery, error) {
+	var ds []Delivery
+	err := d.q().SelectContext(ctx, &ds, `SELECT deliveries.* FROM deliveries JOIN webhooks ON (webhooks.id = deliveries.webhook_id) WHERE next_attempt IS NOT NULL AND next_attempt <= ? AND webhooks.owner = ? ORDER BY next_attempt`, t.Unix(), storage.Owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	ds2 := make([]storage.Delivery, len(ds))
+	for i := range ds {
+		ds2[i] = deliveryToStorage(ds[i])
+	}
+	return ds2, nil
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func formatOptional(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	return csv.NewWriter(w).WriteAll(append([][]string{header}, rows...))
+}
+
+// WriteTasksCSV writes a row per task, with the tags comma-separated.
+func WriteTasksCSV(w io.Writer, ds Dataset, loc *time.Location) error {
+	var rows [][]string
+	for _, t := range ds.Tasks {
+		rows = append(rows, []string{
+			strconv.FormatInt(t.ID, 10),
+			t.QuickTitle,
+			t.Description,
+			formatOptional(t.Due, loc),
+			formatOptional(t.Deadline, loc),
+			strings.Join(ds.Tags[t.ID], ","),
+		})
+	}
+	return writeCSV(w, []string{"id", "title", "description", "due", "deadline", "tags"}, rows)
+}
+
+// WriteActivitiesCSV writes a row per activity, with its task's title.
+func WriteActivitiesCSV(w io.Writer, ds Dataset, loc *time.Location) error {
+	var rows [][]string
+	for _, a := range ds.Activities {
+		rows = append(rows, []string{
+			strconv.FormatInt(a.ID, 10),
+			strconv.FormatInt(a.TaskID, 10),
+			ds.task(a.TaskID).QuickTitle,
+			a.TimeStart.In(loc).Format(time.RFC3339),
+			a.TimeEnd.In(loc).Format(time.RFC3339),
+			a.Location,
+			strconv.FormatBool(a.Done),
+			a.Note,
+		})
+	}
+	return writeCSV(w, []string{"id", "task_id", "task", "time_start", "time_end", "location", "done", "note"}, rows)
+}
+
+// WritePlansCSV writes a row per plan, with its task's title; durations are in seconds.
+func WritePlansCSV(w io.Writer, ds Dataset, loc *time.Location) error {
+	var rows [][]string
+	for _, p := range ds.Plans {
+		activityID := ""
+		if p.ActivityID != 0 {
+			activityID = strconv.FormatInt(p.ActivityID, 10)
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(p.ID, 10),
+			strconv.FormatInt(p.TaskID, 10),
+			ds.task(p.TaskID).QuickTitle,
+			activityID,
+			p.Location,
+			p.TimeAtAfter.In(loc).Format(time.RFC3339),
+			p.TimeBefore.In(loc).Format(time.RFC3339),
+			strconv.FormatInt(int64(p.DurationGe.Seconds()), 10),
+			strconv.FormatInt(int64(p.DurationLt.Seconds()), 10),
+		})
+	}
+	return writeCSV(w, []string{"id", "task_id", "task", "activity_id", "location", "time_at_after", "time_before", "duration_ge", "duration_lt"}, rows)
+}
@@ -0,0 +1,202 @@
+// Package export writes tasks, activities and plans in formats for other tools: CSV, JSON Lines, Org-mode and ledger's timeclock.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// Dataset is the data to export.
+type Dataset struct {
+	// Tasks are sorted by ID.
+	Tasks []storage.Task
+	// Tags are the tags of each task.
+	Tags map[int64][]string
+	// Activities are sorted by start time.
+	Activities []storage.Activity
+	// Plans are sorted by start time.
+	Plans []storage.Plan
+}
+
+// Filter limits what is exported.
+type Filter struct {
+	// From and To limit activities and plans to those within [From, To).
+	// Zero times leave the range unbounded.
+	From, To time.Time
+	// Tag, if not empty, limits tasks to those with the tag, and activities and plans to those of the tasks.
+	Tag string
+}
+
+// Format is an export format.
+type Format struct {
+	ContentType string
+	// Extension is the file name extension, including the dot.
+	Extension string
+	// Write writes ds, showing times in loc.
+	Write func(w io.Writer, ds Dataset, loc *time.Location) error
+}
+
+// Formats are the export formats by name.
+var Formats = map[string]Format{
+	"tasks-csv":      {"text/csv; charset=utf-8", ".csv", WriteTasksCSV},
+	"activities-csv": {"text/csv; charset=utf-8", ".csv", WriteActivitiesCSV},
+	"plans-csv":      {"text/csv; charset=utf-8", ".csv", WritePlansCSV},
+	"jsonl":          {"application/jsonl; charset=utf-8", ".jsonl", WriteJSONLines},
+	"org":            {"text/org; charset=utf-8", ".org", WriteOrg},
+	"timeclock":      {"text/plain; charset=utf-8", ".timeclock", WriteTimeclock},
+}
+
+// FormatNames returns the names of Formats, sorted.
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseBound parses a bound of a Filter's range: an RFC 3339 time, or a date in loc.
+// A date as the end of the range includes that day.
+func ParseBound(s string, loc *time.Location, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date (2006-01-02) nor an RFC 3339 time", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+const pageSize = 100
+
+func all[T any](w storage.Window[T]) ([]T, error) {
+	defer w.Close()
+	var res []T
+	for offset := 0; ; offset += pageSize {
+		ts, err := w.Get(pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ts...)
+		if len(ts) < pageSize {
+			return res, nil
+		}
+	}
+}
+
+// Gather reads the data matching f from st.
+// Tasks are those the activities and plans refer to, or all tasks if the range is unbounded.
+func Gather(st storage.Storage, f Filter, ctx context.Context) (Dataset, error) {
+	from, to := f.From, f.To
+	if to.IsZero() {
+		to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	aw, err := st.ActivityRange(from, to, ctx)
+	if err != nil {
+		return Dataset{}, fmt.Errorf("activity: %w", err)
+	}
+	as, err := all(aw)
+	if err != nil {
+		return Dataset{}, fmt.Errorf("activity: %w", err)
+	}
+	pw, err := st.PlanRange(from, to, ctx)
+	if err != nil {
+		return Dataset{}, fmt.Errorf("plan: %w", err)
+	}
+	ps, err := all(pw)
+	if err != nil {
+		return Dataset{}, fmt.Errorf("plan: %w", err)
+	}
+
+	tasks := map[int64]storage.Task{}
+	if f.From.IsZero() && f.To.IsZero() {
+		ts, err := st.Tasks(ctx)
+		if err != nil {
+			return Dataset{}, fmt.Errorf("task: %w", err)
+		}
+		for _, t := range ts {
+			tasks[t.ID] = t
+		}
+	}
+	referred := func(id int64) error {
+		if _, ok := tasks[id]; ok {
+			return nil
+		}
+		t, err := st.TaskGet(id, ctx)
+		if err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+		tasks[id] = t
+		return nil
+	}
+	for _, a := range as {
+		err = referred(a.TaskID)
+		if err != nil {
+			return Dataset{}, err
+		}
+	}
+	for _, p := range ps {
+		err = referred(p.TaskID)
+		if err != nil {
+			return Dataset{}, err
+		}
+	}
+
+	ds := Dataset{Tags: map[int64][]string{}}
+	for id, t := range tasks {
+		tags, err := st.TaskTags(id, ctx)
+		if err != nil {
+			return Dataset{}, fmt.Errorf("task %d: tags: %w", id, err)
+		}
+		if f.Tag != "" && !slices.Contains(tags, f.Tag) {
+			continue
+		}
+		ds.Tasks = append(ds.Tasks, t)
+		ds.Tags[id] = tags
+	}
+	sort.Slice(ds.Tasks, func(i, j int) bool { return ds.Tasks[i].ID < ds.Tasks[j].ID })
+	for _, a := range as {
+		if _, ok := ds.Tags[a.TaskID]; ok {
+			ds.Activities = append(ds.Activities, a)
+		}
+	}
+	sort.SliceStable(ds.Activities, func(i, j int) bool { return ds.Activities[i].TimeStart.Before(ds.Activities[j].TimeStart) })
+	for _, p := range ps {
+		if _, ok := ds.Tags[p.TaskID]; ok {
+			ds.Plans = append(ds.Plans, p)
+		}
+	}
+	sort.SliceStable(ds.Plans, func(i, j int) bool { return ds.Plans[i].TimeAtAfter.Before(ds.Plans[j].TimeAtAfter) })
+	return ds, nil
+}
+
+// task returns the task with the ID.
+func (ds Dataset) task(id int64) storage.Task {
+	i, ok := sort.Find(len(ds.Tasks), func(i int) int {
+		switch {
+		case id < ds.Tasks[i].ID:
+			return -1
+		case id > ds.Tasks[i].ID:
+			return 1
+		}
+		return 0
+	})
+	if !ok {
+		return storage.Task{ID: id}
+	}
+	return ds.Tasks[i]
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/importer"
+	"nyiyui.ca/jks/storage"
+)
+
+// testDataset adds an essay tagged school with two activities (in December and January) and a plan, and an untagged chore.
+func testDataset(t *testing.T) storage.Storage {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	due := time.Date(2025, 1, 10, 23, 59, 0, 0, time.UTC)
+	essay, err := st.TaskAdd(storage.Task{QuickTitle: "essay", Description: "* outline\n* draft", Due: &due}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.TaskSetTags(essay, []string{"school"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chore, err := st.TaskAdd(storage.Task{QuickTitle: "groceries"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := func(day, hour int) time.Time { return time.Date(2024, 12, day, hour, 0, 0, 0, time.UTC) }
+	for _, a := range []storage.Activity{
+		{TaskID: essay, TimeStart: dec(20, 9), TimeEnd: dec(20, 10), Location: "library", Note: "outline"},
+		{TaskID: chore, TimeStart: dec(20, 11), TimeEnd: dec(20, 12)},
+		{TaskID: essay, TimeStart: time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC), TimeEnd: time.Date(2025, 1, 2, 10, 30, 0, 0, time.UTC), Done: true},
+	} {
+		_, err = st.ActivityAdd(a, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = st.PlanAdd(storage.Plan{TaskID: essay, TimeAtAfter: dec(21, 9), TimeBefore: dec(21, 17), DurationGe: time.Hour, DurationLt: 2 * time.Hour}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestGather(t *testing.T) {
+	ctx := context.Background()
+	st := testDataset(t)
+	overdue := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	_, err := st.TaskAdd(storage.Task{QuickTitle: "overdue", Deadline: &overdue}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := Gather(st, Filter{}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Tasks) != 3 || len(ds.Activities) != 3 || len(ds.Plans) != 1 {
+		t.Fatalf("everything: %d tasks, %d activities, %d plans", len(ds.Tasks), len(ds.Activities), len(ds.Plans))
+	}
+	from, err := ParseBound("2024-12-01", time.UTC, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := ParseBound("2024-12-31", time.UTC, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err = Gather(st, Filter{From: from, To: to, Tag: "school"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Tasks) != 1 || ds.Tasks[0].QuickTitle != "essay" || len(ds.Activities) != 1 || len(ds.Plans) != 1 {
+		t.Fatalf("December, school: %#v", ds)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	ds, err := Gather(testDataset(t), Filter{}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, format := range Formats {
+		var b bytes.Buffer
+		err := format.Write(&b, ds, time.UTC)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		switch format.Extension {
+		case ".csv":
+			if _, err := csv.NewReader(&b).ReadAll(); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		case ".jsonl":
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+			var l Line
+			if len(lines) != 6 || json.Unmarshal([]byte(lines[0]), &l) != nil || l.Kind != "task" || len(l.Task.Tags) != 1 {
+				t.Fatalf("%s: %s", name, b.String())
+			}
+		case ".timeclock":
+			if !strings.HasPrefix(b.String(), "i 2024/12/20 09:00:00 essay  at library: outline\no 2024/12/20 10:00:00\n") {
+				t.Fatalf("%s: %s", name, b.String())
+			}
+		}
+	}
+}
+
+func TestOrgRoundTrip(t *testing.T) {
+	ds, err := Gather(testDataset(t), Filter{}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = WriteOrg(&b, ds, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"* DONE essay :school:\n  DEADLINE: <2025-01-10 Fri 23:59> SCHEDULED: <2024-12-21 Sat 09:00>\n",
+		"  CLOCK: [2025-01-02 Thu 09:00]--[2025-01-02 Thu 10:30] =>  1:30\n  CLOCK: [2024-12-20 Fri 09:00]",
+		"  * outline\n",
+		"* TODO groceries\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, b.String())
+		}
+	}
+	es, err := importer.ReadOrg(&b, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 3 || es[0].Title != "essay" || es[0].ID != "jks-task-1@2025-01-02T09:00" || !es[0].Activity.Done {
+		t.Fatalf("read back: %#v", es)
+	}
+}
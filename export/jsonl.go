@@ -0,0 +1,45 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/storage"
+)
+
+// Line is a line of the JSON Lines export.
+// Exactly one of Task, Activity and Plan is set, as named by Kind ("task", "activity" or "plan").
+// Tasks come first, so that the tasks activities and plans refer to are read before them.
+type Line struct {
+	Kind     string
+	Task     *api.Task         `json:",omitempty"`
+	Activity *storage.Activity `json:",omitempty"`
+	Plan     *storage.Plan     `json:",omitempty"`
+}
+
+// WriteJSONLines writes a Line per task, activity and plan.
+// Times are encoded as RFC 3339 times with their offsets, so loc is unused.
+func WriteJSONLines(w io.Writer, ds Dataset, loc *time.Location) error {
+	enc := json.NewEncoder(w)
+	for _, t := range ds.Tasks {
+		err := enc.Encode(Line{Kind: "task", Task: &api.Task{Task: t, Tags: ds.Tags[t.ID]}})
+		if err != nil {
+			return err
+		}
+	}
+	for i := range ds.Activities {
+		err := enc.Encode(Line{Kind: "activity", Activity: &ds.Activities[i]})
+		if err != nil {
+			return err
+		}
+	}
+	for i := range ds.Plans {
+		err := enc.Encode(Line{Kind: "plan", Plan: &ds.Plans[i]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"nyiyui.ca/jks/storage"
+)
+
+func orgTime(t time.Time, loc *time.Location, active bool) string {
+	s := t.In(loc).Format("2006-01-02 Mon 15:04")
+	if active {
+		return "<" + s + ">"
+	}
+	return "[" + s + "]"
+}
+
+// orgTag replaces the characters Org-mode does not allow in tags.
+func orgTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_@#%", r) {
+			return r
+		}
+		return '_'
+	}, tag)
+}
+
+// WriteOrg writes a heading per task, with
+//   - DONE if its latest activity is done, and TODO otherwise,
+//   - its tags,
+//   - DEADLINE at its due time (or else its deadline), and SCHEDULED at the start of its earliest unfulfilled plan,
+//   - its ID, and its deadline (if it has a due time too) as properties,
+//   - a CLOCK line per activity (the latest first, as Org-mode adds them), and
+//   - its description.
+//
+// Such files can be imported again with importer.ReadOrg.
+func WriteOrg(w io.Writer, ds Dataset, loc *time.Location) error {
+	bw := bufio.NewWriter(w)
+	activities := map[int64][]storage.Activity{}
+	for _, a := range ds.Activities {
+		activities[a.TaskID] = append(activities[a.TaskID], a)
+	}
+	scheduled := map[int64]time.Time{}
+	for _, p := range ds.Plans {
+		if _, ok := scheduled[p.TaskID]; !ok && p.ActivityID == 0 {
+			scheduled[p.TaskID] = p.TimeAtAfter
+		}
+	}
+	fmt.Fprintf(bw, "#+TITLE: jks export\n")
+	for _, t := range ds.Tasks {
+		as := activities[t.ID]
+		keyword := "TODO"
+		if len(as) > 0 && as[len(as)-1].Done {
+			keyword = "DONE"
+		}
+		fmt.Fprintf(bw, "* %s %s", keyword, strings.Join(strings.Fields(t.QuickTitle), " "))
+		if tags := ds.Tags[t.ID]; len(tags) > 0 {
+			orgTags := make([]string, len(tags))
+			for i, tag := range tags {
+				orgTags[i] = orgTag(tag)
+			}
+			fmt.Fprintf(bw, " :%s:", strings.Join(orgTags, ":"))
+		}
+		bw.WriteString("\n")
+
+		var planning []string
+		due := t.Due
+		if due == nil {
+			due = t.Deadline
+		}
+		if due != nil {
+			planning = append(planning, "DEADLINE: "+orgTime(*due, loc, true))
+		}
+		if s, ok := scheduled[t.ID]; ok {
+			planning = append(planning, "SCHEDULED: "+orgTime(s, loc, true))
+		}
+		if len(planning) > 0 {
+			fmt.Fprintf(bw, "  %s\n", strings.Join(planning, " "))
+		}
+
+		fmt.Fprintf(bw, "  :PROPERTIES:\n  :ID:       jks-task-%d\n", t.ID)
+		if t.Due != nil && t.Deadline != nil {
+			fmt.Fprintf(bw, "  :JKS_DEADLINE: %s\n", orgTime(*t.Deadline, loc, false))
+		}
+		bw.WriteString("  :END:\n")
+
+		if len(as) > 0 {
+			bw.WriteString("  :LOGBOOK:\n")
+			for i := len(as) - 1; i >= 0; i-- {
+				a := as[i]
+				d := a.TimeEnd.Sub(a.TimeStart).Round(time.Minute)
+				fmt.Fprintf(bw, "  CLOCK: %s--%s => %2d:%02d\n", orgTime(a.TimeStart, loc, false), orgTime(a.TimeEnd, loc, false), int(d.Hours()), int(d.Minutes())%60)
+			}
+			bw.WriteString("  :END:\n")
+		}
+
+		if t.Description != "" {
+			// indented, so that lines starting with * are not headings
+			for _, line := range strings.Split(strings.TrimRight(t.Description, "\n"), "\n") {
+				fmt.Fprintf(bw, "  %s\n", strings.TrimRight(line, "\r"))
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,37 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteTimeclock writes activities as check-in and check-out lines for ledger's (and hledger's) timeclock format, e.g.
+//
+//	i 2024/12/20 09:00:00 essay  at library: outline
+//	o 2024/12/20 10:30:00
+//
+// The account is the task's title, and the payee the location and note.
+func WriteTimeclock(w io.Writer, ds Dataset, loc *time.Location) error {
+	bw := bufio.NewWriter(w)
+	const layout = "2006/01/02 15:04:05"
+	for _, a := range ds.Activities {
+		// two spaces end the account name
+		account := strings.Join(strings.Fields(ds.task(a.TaskID).QuickTitle), " ")
+		var payee []string
+		if a.Location != "" {
+			payee = append(payee, "at "+a.Location)
+		}
+		if a.Note != "" {
+			payee = append(payee, strings.Join(strings.Fields(a.Note), " "))
+		}
+		fmt.Fprintf(bw, "i %s %s", a.TimeStart.In(loc).Format(layout), account)
+		if len(payee) > 0 {
+			fmt.Fprintf(bw, "  %s", strings.Join(payee, ": "))
+		}
+		fmt.Fprintf(bw, "\no %s\n", a.TimeEnd.In(loc).Format(layout))
+	}
+	return bw.Flush()
+}
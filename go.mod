@@ -5,6 +5,7 @@ go 1.23.3
 require (
 	github.com/Masterminds/sprig/v3 v3.3.0
 	github.com/deiu/rdf2go v0.0.0-20241212211204-b661ba0dfd25
+	github.com/go-webauthn/webauthn v0.9.4
 	github.com/golang-migrate/migrate/v4 v4.18.1
 	github.com/google/safehtml v0.1.0
 	github.com/gorilla/schema v1.4.1
@@ -14,6 +15,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.2.3
 	github.com/teambition/rrule-go v1.8.2
 	github.com/yuin/goldmark v1.7.8
+	golang.org/x/crypto v0.27.0
 	golang.org/x/oauth2 v0.24.0
 	nyiyui.ca/seekback-server v0.0.0-20241226075933-6fbdb668938f
 )
@@ -23,6 +25,10 @@ require (
 	github.com/Masterminds/goutils v1.1.1 // indirect
 	github.com/Masterminds/semver/v3 v3.3.0 // indirect
 	github.com/deiu/gon3 v0.0.0-20241212124032-93153c038193 // indirect
+	github.com/fxamacker/cbor/v2 v2.5.0 // indirect
+	github.com/go-webauthn/x v0.1.5 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+	github.com/google/go-tpm v0.9.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
@@ -30,11 +36,13 @@ require (
 	github.com/huandu/xstrings v1.5.0 // indirect
 	github.com/linkeddata/gojsonld v0.0.0-20170418210642-4f5db6791326 // indirect
 	github.com/mitchellh/copystructure v1.2.0 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	github.com/mitchellh/reflectwalk v1.0.2 // indirect
 	github.com/rychipman/easylex v0.0.0-20160129204217-49ee7767142f // indirect
 	github.com/shopspring/decimal v1.4.0 // indirect
 	github.com/spf13/cast v1.7.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
-	golang.org/x/crypto v0.27.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 )
@@ -0,0 +1,228 @@
+// Package importer imports time tracked in other tools as tasks and activities.
+//
+// Each source (e.g. Toggl) has a Reader that turns its export into entries.
+// Import then matches each entry to a task by its title, and adds (or, when re-imported, edits) an activity for it.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// Entry is a span of time tracked for a task in another tool.
+type Entry struct {
+	// ID identifies the entry within its source, so that importing it again edits the activity instead of adding another.
+	ID string
+	// Title is the title of the entry's task.
+	Title string
+	// Tags are set on the task if it is added by the import.
+	Tags []string
+	// Activity is the tracked time, without TaskID.
+	Activity storage.Activity
+}
+
+// Reader reads the entries of a source's export.
+// loc is the time zone of times written without one.
+type Reader func(r io.Reader, loc *time.Location) ([]Entry, error)
+
+// Readers are the supported sources by name.
+var Readers = map[string]Reader{
+	"toggl":       ReadToggl,
+	"timewarrior": ReadTimewarrior,
+	"org":         ReadOrg,
+}
+
+const (
+	KindTask     = "task"
+	KindActivity = "activity"
+)
+
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionAdd
+	ActionEdit
+	// ActionMatch is an existing task first matched to a title.
+	ActionMatch
+)
+
+// Change describes what Import did (or would do, in a dry run) for one task or entry.
+type Change struct {
+	Kind string
+	// Foreign is the task's title or the entry's ID, prefixed with the source.
+	Foreign string
+	// LocalID is zero if the row is added in a dry run.
+	LocalID int64
+	Action  Action
+	// Fields lists the fields that differ from the local row when Action is ActionEdit.
+	Fields []string
+}
+
+func (c Change) String() string {
+	switch c.Action {
+	case ActionAdd:
+		return fmt.Sprintf("+ %s %s", c.Kind, c.Foreign)
+	case ActionEdit:
+		return fmt.Sprintf("~ %s %s → %d (%s)", c.Kind, c.Foreign, c.LocalID, strings.Join(c.Fields, ", "))
+	case ActionMatch:
+		return fmt.Sprintf("> %s %s → %d", c.Kind, c.Foreign, c.LocalID)
+	default:
+		return fmt.Sprintf("= %s %s → %d", c.Kind, c.Foreign, c.LocalID)
+	}
+}
+
+// Mapping assigns titles in a source to existing tasks, for when the titles differ from the tasks' titles.
+// It is read from a TOML file, e.g.
+//
+//	[Tasks]
+//	"Project X: meetings" = 12
+type Mapping struct {
+	Tasks map[string]int64
+}
+
+func LoadMapping(path string) (Mapping, error) {
+	var m Mapping
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Mapping{}, err
+	}
+	err = toml.Unmarshal(data, &m)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Import adds or edits activities in st to match entries read from source.
+//
+// Each entry's task is, in order:
+//   - the task its title is assigned to by m,
+//   - the task matched to its title by a previous import,
+//   - the oldest task with the same title (ignoring case), or else
+//   - a new task.
+//
+// Entries are matched to activities imported before using the mapping table (see storage.Storage.MappingGet), so importing the same export twice changes nothing.
+// If dryRun is true, st is not modified and the returned changes describe what would be done.
+// The import is done in one transaction, so nothing is changed if it fails partway.
+func Import(source string, entries []Entry, m Mapping, st storage.Storage, dryRun bool, ctx context.Context) (changes []Change, err error) {
+	err = st.WithTx(ctx, func(st storage.Storage) error {
+		changes, err = importEntries(source, entries, m, st, dryRun, ctx)
+		return err
+	})
+	return
+}
+
+func importEntries(source string, entries []Entry, m Mapping, st storage.Storage, dryRun bool, ctx context.Context) ([]Change, error) {
+	var changes []Change
+	taskIDs := map[string]int64{}
+	resolveTask := func(e Entry) (int64, error) {
+		if id, ok := m.Tasks[e.Title]; ok {
+			return id, nil
+		}
+		if id, ok := taskIDs[e.Title]; ok {
+			return id, nil
+		}
+		foreign := source + ":" + e.Title
+		id, ok, err := st.MappingGet(KindTask, foreign, ctx)
+		if err != nil {
+			return 0, fmt.Errorf("mapping: %w", err)
+		}
+		if ok {
+			taskIDs[e.Title] = id
+			return id, nil
+		}
+		change := Change{Kind: KindTask, Foreign: foreign}
+		t, ok, err := st.TaskByTitle(e.Title, ctx)
+		if err != nil {
+			return 0, fmt.Errorf("match title: %w", err)
+		}
+		if ok {
+			change.Action = ActionMatch
+			change.LocalID = t.ID
+		} else {
+			change.Action = ActionAdd
+			if !dryRun {
+				change.LocalID, err = st.TaskAdd(storage.Task{QuickTitle: e.Title}, ctx)
+				if err != nil {
+					return 0, fmt.Errorf("add: %w", err)
+				}
+				err = st.TaskSetTags(change.LocalID, e.Tags, ctx)
+				if err != nil {
+					return 0, fmt.Errorf("set tags: %w", err)
+				}
+			}
+		}
+		if !dryRun {
+			// remember the task, even if it is renamed later
+			err = st.MappingSet(KindTask, foreign, change.LocalID, ctx)
+			if err != nil {
+				return 0, fmt.Errorf("mapping: %w", err)
+			}
+		}
+		changes = append(changes, change)
+		taskIDs[e.Title] = change.LocalID
+		return change.LocalID, nil
+	}
+
+	seen := map[string]bool{}
+	for _, e := range entries {
+		foreign := source + ":" + e.ID
+		if seen[foreign] {
+			return nil, fmt.Errorf("entry %s: duplicate ID", foreign)
+		}
+		seen[foreign] = true
+		taskID, err := resolveTask(e)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: task %q: %w", foreign, e.Title, err)
+		}
+		id, ok, err := st.MappingGet(KindActivity, foreign, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: mapping: %w", foreign, err)
+		}
+		want := e.Activity
+		want.TaskID = taskID
+		change := Change{Kind: KindActivity, Foreign: foreign, LocalID: id}
+		if !ok {
+			change.Action = ActionAdd
+			if !dryRun {
+				want.ID = 0
+				change.LocalID, err = st.ActivityAdd(want, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("entry %s: add: %w", foreign, err)
+				}
+				err = st.MappingSet(KindActivity, foreign, change.LocalID, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("entry %s: mapping: %w", foreign, err)
+				}
+			}
+		} else {
+			local, err := st.ActivityGet(id, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("entry %s: get %d: %w", foreign, id, err)
+			}
+			want.ID = id
+			want.Version = local.Version
+			change.Fields = storage.ChangedFields(local, want)
+			if len(change.Fields) != 0 {
+				change.Action = ActionEdit
+				if !dryRun {
+					err = st.ActivityEdit(want, ctx)
+					if err != nil {
+						return nil, fmt.Errorf("entry %s: edit %d: %w", foreign, id, err)
+					}
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
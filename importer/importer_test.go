@@ -0,0 +1,156 @@
+package importer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/storage"
+)
+
+var testLocation = time.FixedZone("EST", -5*60*60)
+
+const togglCSV = "\ufeffUser,Email,Client,Project,Task,Description,Billable,Start date,Start time,End date,End time,Duration,Tags\n" +
+	"me,me@example.com,School,CS2110,,hw3,No,2024-12-20,09:00:00,2024-12-20,10:30:00,01:30:00,\"cs, hw\"\n" +
+	"me,me@example.com,,Chores,,,No,2024-12-20,11:00:00,2024-12-20,11:15:00,00:15:00,\n"
+
+func TestReadToggl(t *testing.T) {
+	es, err := ReadToggl(strings.NewReader(togglCSV), testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 {
+		t.Fatalf("got %d entries", len(es))
+	}
+	e := es[0]
+	if e.Title != "hw3" || e.Activity.Note != "CS2110 (School)" || !reflect.DeepEqual(e.Tags, []string{"cs", "hw"}) || e.ID == "" {
+		t.Fatalf("entry: %#v", e)
+	}
+	if !e.Activity.TimeStart.Equal(time.Date(2024, 12, 20, 14, 0, 0, 0, time.UTC)) || e.Activity.TimeEnd.Sub(e.Activity.TimeStart) != 90*time.Minute {
+		t.Fatalf("times: %s to %s", e.Activity.TimeStart, e.Activity.TimeEnd)
+	}
+	if es[1].Title != "Chores" || es[1].Activity.Note != "" || es[1].ID == e.ID {
+		t.Fatalf("entry without description: %#v", es[1])
+	}
+}
+
+func TestReadTimewarrior(t *testing.T) {
+	data := `inc 20241220T140000Z - 20241220T153000Z # cs2110 "hw 3" # "part \"1\""
+inc 20241220T160000Z - 20241220T161500Z # # "untagged"
+inc 20241220T170000Z # cs2110
+`
+	es, err := ReadTimewarrior(strings.NewReader(data), testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 {
+		t.Fatalf("got %d entries (the open interval should be skipped)", len(es))
+	}
+	e := es[0]
+	if e.ID != "20241220T140000Z" || e.Title != "cs2110 hw 3" || e.Activity.Note != `part "1"` || !reflect.DeepEqual(e.Tags, []string{"cs2110", "hw 3"}) {
+		t.Fatalf("entry: %#v", e)
+	}
+	if !e.Activity.TimeEnd.Equal(time.Date(2024, 12, 20, 15, 30, 0, 0, time.UTC)) {
+		t.Fatalf("end: %s", e.Activity.TimeEnd)
+	}
+	if es[1].Title != "untagged" || es[1].Activity.Note != "" {
+		t.Fatalf("untagged entry: %#v", es[1])
+	}
+}
+
+const orgFile = `#+TITLE: notes
+* School
+** DONE [#A] Write essay :cs:writing:
+   :PROPERTIES:
+   :ID:       essay-id
+   :END:
+   :LOGBOOK:
+   CLOCK: [2024-12-20 Fri 13:00]--[2024-12-20 Fri 14:00] =>  1:00
+   CLOCK: [2024-12-19 Thu 9:00]--[2024-12-19 Thu 10:00] =>  1:00
+   :END:
+** TODO Study
+   CLOCK: [2024-12-20 Fri 15:00]--[2024-12-20 Fri 15:30] =>  0:30
+   CLOCK: [2024-12-21 Sat 15:00]
+`
+
+func TestReadOrg(t *testing.T) {
+	es, err := ReadOrg(strings.NewReader(orgFile), testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 3 {
+		t.Fatalf("got %d entries", len(es))
+	}
+	if es[0].Title != "Write essay" || es[0].ID != "essay-id@2024-12-20T13:00" || !es[0].Activity.Done || es[1].Activity.Done || !reflect.DeepEqual(es[0].Tags, []string{"cs", "writing"}) {
+		t.Fatalf("essay entries: %#v, %#v", es[0], es[1])
+	}
+	if es[2].Title != "Study" || es[2].ID != "School/Study@2024-12-20T15:00" || es[2].Activity.Done {
+		t.Fatalf("study entry: %#v", es[2])
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	existing, err := st.TaskAdd(storage.Task{QuickTitle: "HW3"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := ReadToggl(strings.NewReader(togglCSV), testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Import("toggl", es, Mapping{}, st, true, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{"> task toggl:hw3 → 1", "+ activity toggl:" + es[0].ID, "+ task toggl:Chores", "+ activity toggl:" + es[1].ID}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("dry run: got %q, want %q", got, want)
+	}
+	if as, err := st.TaskGetActivities(existing, ctx); err != nil || len(as) != 0 {
+		t.Fatalf("dry run changed activities: %v %v", as, err)
+	}
+
+	_, err = Import("toggl", es, Mapping{}, st, false, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as, err := st.TaskGetActivities(existing, ctx)
+	if err != nil || len(as) != 1 {
+		t.Fatalf("activities of the matched task: %v %v", as, err)
+	}
+
+	// importing again changes nothing, and editing an entry edits its activity
+	es[1].Activity.Note = "edited"
+	changes, err = Import("toggl", es, Mapping{}, st, false, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, c := range changes {
+		if c.Action != ActionNone {
+			got = append(got, c.String())
+		}
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "~ activity toggl:"+es[1].ID) || !strings.HasSuffix(got[0], "(Note)") {
+		t.Fatalf("re-import: %q", got)
+	}
+
+	// the mapping file takes precedence over titles
+	changes, err = Import("toggl", es[:1], Mapping{Tasks: map[string]int64{"hw3": 2}}, st, true, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Action != ActionEdit || !reflect.DeepEqual(changes[0].Fields, []string{"TaskID"}) {
+		t.Fatalf("mapping file: %#v", changes)
+	}
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	orgHeadline = regexp.MustCompile(`^(\*+)\s+(.*?)\s*$`)
+	orgTags     = regexp.MustCompile(`\s+:([^\s:]+(?::[^\s:]+)*):$`)
+	orgPriority = regexp.MustCompile(`^\[#[A-Za-z0-9]\]\s*`)
+	orgClock    = regexp.MustCompile(`^\s*CLOCK:\s*\[(\d{4}-\d{2}-\d{2})(?: [^\]\s]+)? (\d{1,2}:\d{2})\](?:--\[(\d{4}-\d{2}-\d{2})(?: [^\]\s]+)? (\d{1,2}:\d{2})\])?`)
+	orgID       = regexp.MustCompile(`^\s*:ID:\s*(\S+)`)
+)
+
+// orgKeywords are the default TODO keywords, and whether each means done.
+var orgKeywords = map[string]bool{"TODO": false, "NEXT": false, "WAITING": false, "DONE": true, "CANCELED": true, "CANCELLED": true}
+
+// orgHeading is a heading and the clock entries directly under it.
+type orgHeading struct {
+	path    []string
+	title   string
+	id      string
+	done    bool
+	tags    []string
+	entries []Entry
+}
+
+// ReadOrg reads CLOCK lines (as in a LOGBOOK drawer) under the headings of an Org-mode file, e.g.
+//
+//	#+TITLE: notes
+//	* DONE [#A] Write essay :school:
+//	  :LOGBOOK:
+//	  CLOCK: [2024-12-20 Fri 09:00]--[2024-12-20 Fri 10:30] =>  1:30
+//	  :END:
+//
+// The entry's title is its heading's title, without the TODO keyword, priority and tags (which become the task's tags).
+// For a heading with a done keyword (DONE or CANCELED), its latest entry is marked done.
+// Running clocks are skipped.
+// Entries are identified by their heading's ID property (or else the path of headings to it) and start time.
+func ReadOrg(r io.Reader, loc *time.Location) ([]Entry, error) {
+	var entries []Entry
+	var path []string
+	var h *orgHeading
+	finish := func() {
+		if h == nil || len(h.entries) == 0 {
+			return
+		}
+		key := h.id
+		if key == "" {
+			key = strings.Join(h.path, "/")
+		}
+		latest := 0
+		for i := range h.entries {
+			h.entries[i].ID = key + "@" + h.entries[i].ID
+			h.entries[i].Title = h.title
+			h.entries[i].Tags = h.tags
+			if h.entries[i].Activity.TimeEnd.After(h.entries[latest].Activity.TimeEnd) {
+				latest = i
+			}
+		}
+		h.entries[latest].Activity.Done = h.done
+		entries = append(entries, h.entries...)
+	}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if m := orgHeadline.FindStringSubmatch(text); m != nil {
+			finish()
+			level := len(m[1])
+			title := m[2]
+			var tags []string
+			if tm := orgTags.FindStringSubmatch(title); tm != nil {
+				tags = strings.Split(tm[1], ":")
+				title = strings.TrimSpace(title[:len(title)-len(tm[0])])
+			}
+			done := false
+			if keyword, rest, _ := strings.Cut(title, " "); keyword != "" {
+				if d, ok := orgKeywords[keyword]; ok {
+					done = d
+					title = strings.TrimSpace(rest)
+				}
+			}
+			title = orgPriority.ReplaceAllString(title, "")
+			if len(path) >= level {
+				path = path[:level-1]
+			}
+			for len(path) < level-1 {
+				path = append(path, "")
+			}
+			path = append(path, title)
+			h = &orgHeading{path: append([]string(nil), path...), title: title, done: done, tags: tags}
+			continue
+		}
+		if h == nil {
+			continue
+		}
+		if m := orgID.FindStringSubmatch(text); m != nil {
+			h.id = m[1]
+			continue
+		}
+		m := orgClock.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		if m[3] == "" {
+			continue
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04", m[1]+" "+m[2], loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: start: %w", line, err)
+		}
+		end, err := time.ParseInLocation("2006-01-02 15:04", m[3]+" "+m[4], loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: end: %w", line, err)
+		}
+		if h.title == "" {
+			return nil, fmt.Errorf("line %d: clock under a heading without a title", line)
+		}
+		var e Entry
+		e.ID = start.Format("2006-01-02T15:04")
+		e.Activity.TimeStart = start
+		e.Activity.TimeEnd = end
+		h.entries = append(h.entries, e)
+	}
+	finish()
+	return entries, sc.Err()
+}
@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const timewarriorTime = "20060102T150405Z"
+
+// ReadTimewarrior reads a Timewarrior data file (e.g. ~/.local/share/timewarrior/data/2024-12.data), with lines such as
+//
+//	inc 20241220T140000Z - 20241220T153000Z # cs2110 "hw 3" # "finished part 1"
+//
+// The entry's title is its tags joined by spaces, and its annotation is kept in the note (or is the title, if there are no tags).
+// Open intervals (still being tracked) are skipped.
+// Intervals cannot overlap in Timewarrior, so entries are identified by their start time.
+func ReadTimewarrior(r io.Reader, loc *time.Location) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		rest, ok := strings.CutPrefix(text, "inc ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: not an interval", line)
+		}
+		times, rest, _ := strings.Cut(rest, "#")
+		fields := strings.Fields(times)
+		if len(fields) == 1 {
+			continue
+		}
+		if len(fields) != 3 || fields[1] != "-" {
+			return nil, fmt.Errorf("line %d: invalid interval %q", line, strings.TrimSpace(times))
+		}
+		start, err := time.Parse(timewarriorTime, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: start: %w", line, err)
+		}
+		end, err := time.Parse(timewarriorTime, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: end: %w", line, err)
+		}
+		tags, err := splitQuoted(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		var e Entry
+		// the annotation follows a second #
+		for i, tag := range tags {
+			if tag == "#" {
+				e.Activity.Note = strings.Join(tags[i+1:], " ")
+				tags = tags[:i]
+				break
+			}
+		}
+		e.Title = strings.Join(tags, " ")
+		if e.Title == "" {
+			// untagged intervals are titled by their annotation
+			e.Title, e.Activity.Note = e.Activity.Note, ""
+		}
+		if e.Title == "" {
+			return nil, fmt.Errorf("line %d: no tags or annotation", line)
+		}
+		e.ID = fields[0]
+		e.Tags = tags
+		e.Activity.TimeStart = start.In(loc)
+		e.Activity.TimeEnd = end.In(loc)
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// splitQuoted splits s at spaces, except within double quotes (which are removed, and in which \" is a quote).
+func splitQuoted(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quoted, escaped := false, false, false
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && c == ' ':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReadToggl reads a CSV export of Toggl Track time entries (e.g. a detailed report).
+//
+// The entry's title is its description, or else its task or project.
+// The project (and client) are kept in the note, and the tags become the task's tags.
+// Entries are identified by the Id column if present, and otherwise by their contents.
+func ReadToggl(r io.Reader, loc *time.Location) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		// the first column may have a byte order mark
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"description", "start date", "start time", "end date", "end time"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("header: no %q column", name)
+		}
+	}
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04:05", get("start date")+" "+get("start time"), loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: start: %w", line, err)
+		}
+		end, err := time.ParseInLocation("2006-01-02 15:04:05", get("end date")+" "+get("end time"), loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: end: %w", line, err)
+		}
+		var e Entry
+		e.Title = get("description")
+		if e.Title == "" {
+			e.Title = get("task")
+		}
+		if e.Title == "" {
+			e.Title = get("project")
+		}
+		if e.Title == "" {
+			return nil, fmt.Errorf("line %d: no description, task or project", line)
+		}
+		e.Activity.TimeStart = start
+		e.Activity.TimeEnd = end
+		if project := get("project"); project != "" && project != e.Title {
+			e.Activity.Note = project
+			if client := get("client"); client != "" {
+				e.Activity.Note += " (" + client + ")"
+			}
+		}
+		for _, tag := range strings.Split(get("tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				e.Tags = append(e.Tags, tag)
+			}
+		}
+		e.ID = get("id")
+		if e.ID == "" {
+			h := sha256.Sum256([]byte(strings.Join([]string{start.Format(time.RFC3339), end.Format(time.RFC3339), get("description"), get("project"), get("user")}, "\x00")))
+			e.ID = hex.EncodeToString(h[:8])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,292 @@
+// Package quickcapture parses one-line task descriptions such as
+//
+//	CS2110 hw3 due fri 23:59 deadline sat @library ~2h #cs2110
+//
+// Words are taken as the title, except for:
+//
+//   - due WHEN and deadline WHEN, which set the task's Due and Deadline
+//   - from WHEN, which sets when the plan starts (by default, now)
+//   - @location, which sets the plan's location
+//   - ~D (D ± 25%) or ~A-B (at least A and less than B), which set the plan's duration bounds
+//   - #tag, which adds a tag
+//
+// WHEN is a date (today, tomorrow, a weekday such as fri, 2006-01-02 or 1/2), a time (23:59, 9am, 9:30pm, noon or midnight), or a date followed by a time.
+// A date without a time is at 23:59 (or the start of the day for from); a time without a date is at its next occurrence.
+// A weekday is its next occurrence, or today if the time is still to come.
+//
+// A plan is made if from, @location or a duration is given; it ends at the due date, or at the deadline if there is none.
+package quickcapture
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// Result is a parsed description.
+// Plan.TaskID is not set, as the task does not exist yet.
+type Result struct {
+	Task storage.Task
+	Tags []string
+	// Plan is nil if no plan was asked for.
+	Plan *storage.Plan
+}
+
+// Parse parses s, resolving dates relative to now in loc.
+func Parse(s string, now time.Time, loc *time.Location) (Result, error) {
+	now = now.In(loc)
+	var res Result
+	var title []string
+	var start *time.Time
+	var location string
+	var ge, lt time.Duration
+	words := strings.Fields(s)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			res.Tags = appendUnique(res.Tags, word[1:])
+		case strings.HasPrefix(word, "@") && len(word) > 1:
+			if location != "" {
+				return Result{}, fmt.Errorf("location given twice")
+			}
+			location = word[1:]
+		case strings.HasPrefix(word, "~") && len(word) > 1:
+			if ge != 0 {
+				return Result{}, fmt.Errorf("duration given twice")
+			}
+			var err error
+			ge, lt, err = parseDuration(word[1:])
+			if err != nil {
+				return Result{}, fmt.Errorf("%s: %w", word, err)
+			}
+		case word == "due" || word == "deadline" || word == "from":
+			defaultHour, defaultMinute := 23, 59
+			if word == "from" {
+				defaultHour, defaultMinute = 0, 0
+			}
+			t, n := parseWhen(words[i+1:], now, defaultHour, defaultMinute)
+			if n == 0 {
+				// not followed by a time; e.g. "due process"
+				title = append(title, word)
+				continue
+			}
+			i += n
+			var dst **time.Time
+			switch word {
+			case "due":
+				dst = &res.Task.Due
+			case "deadline":
+				dst = &res.Task.Deadline
+			case "from":
+				dst = &start
+			}
+			if *dst != nil {
+				return Result{}, fmt.Errorf("%s given twice", word)
+			}
+			*dst = &t
+		default:
+			title = append(title, word)
+		}
+	}
+	res.Task.QuickTitle = strings.Join(title, " ")
+	if res.Task.QuickTitle == "" {
+		return Result{}, fmt.Errorf("title is empty")
+	}
+	if res.Task.Due != nil && res.Task.Deadline != nil && res.Task.Due.After(*res.Task.Deadline) {
+		return Result{}, fmt.Errorf("due date is after the deadline")
+	}
+	if start == nil && location == "" && ge == 0 {
+		return res, nil
+	}
+	end := res.Task.Due
+	if end == nil {
+		end = res.Task.Deadline
+	}
+	if end == nil {
+		return Result{}, fmt.Errorf("a plan needs a due date or deadline to end at")
+	}
+	if start == nil {
+		start = &now
+	}
+	if !start.Before(*end) {
+		return Result{}, fmt.Errorf("plan would end before it starts")
+	}
+	res.Plan = &storage.Plan{
+		Location:    location,
+		TimeAtAfter: *start,
+		TimeBefore:  *end,
+		DurationGe:  ge,
+		DurationLt:  lt,
+	}
+	return res, nil
+}
+
+func appendUnique(ss []string, s string) []string {
+	for _, s2 := range ss {
+		if s2 == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+// parseDuration parses "D" as D ± 25%, and "A-B" as [A, B).
+func parseDuration(s string) (ge, lt time.Duration, err error) {
+	if a, b, ok := strings.Cut(s, "-"); ok {
+		ge, err = time.ParseDuration(a)
+		if err != nil {
+			return 0, 0, err
+		}
+		lt, err = time.ParseDuration(b)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ge <= 0 || lt <= ge {
+			return 0, 0, fmt.Errorf("bounds must be positive and increasing")
+		}
+		return ge, lt, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if d <= 0 {
+		return 0, 0, fmt.Errorf("duration must be positive")
+	}
+	return d - d/4, d + d/4, nil
+}
+
+// parseWhen parses a date, a time, or a date followed by a time from the start of words.
+// n is the number of words used, or zero if words does not start with a date or time.
+func parseWhen(words []string, now time.Time, defaultHour, defaultMinute int) (t time.Time, n int) {
+	if len(words) == 0 {
+		return time.Time{}, 0
+	}
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	at := func(day time.Time, hour, minute int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	}
+	if hour, minute, ok := parseClock(words[0]); ok {
+		t = at(today, hour, minute)
+		if !t.After(now) {
+			t = at(today.AddDate(0, 0, 1), hour, minute)
+		}
+		return t, 1
+	}
+	day, weekday, ok := parseDate(words[0], today)
+	if !ok {
+		return time.Time{}, 0
+	}
+	n = 1
+	hour, minute := defaultHour, defaultMinute
+	if len(words) > 1 {
+		if h, m, ok := parseClock(words[1]); ok {
+			hour, minute = h, m
+			n = 2
+		}
+	}
+	t = at(day, hour, minute)
+	if weekday && !t.After(now) {
+		t = at(day.AddDate(0, 0, 7), hour, minute)
+	}
+	return t, n
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseDate parses a date relative to today.
+// weekday is true if s names a weekday, which is today's date if today is that weekday.
+func parseDate(s string, today time.Time) (day time.Time, weekday bool, ok bool) {
+	s = strings.ToLower(s)
+	switch s {
+	case "today", "tonight":
+		return today, false, true
+	case "tomorrow", "tmr", "tmrw":
+		return today.AddDate(0, 0, 1), false, true
+	}
+	if wd, ok := weekdays[s]; ok {
+		return today.AddDate(0, 0, (int(wd)-int(today.Weekday())+7)%7), true, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, today.Location()); err == nil {
+		return t, false, true
+	}
+	if m, d, ok := strings.Cut(s, "/"); ok {
+		month, err1 := strconv.Atoi(m)
+		dayOfMonth, err2 := strconv.Atoi(d)
+		if err1 != nil || err2 != nil || month < 1 || month > 12 || dayOfMonth < 1 || dayOfMonth > 31 {
+			return time.Time{}, false, false
+		}
+		// time.Date normalizes dates such as 2/30, so check that the date exists in the year
+		date := func(year int) (time.Time, bool) {
+			t := time.Date(year, time.Month(month), dayOfMonth, 0, 0, 0, 0, today.Location())
+			return t, t.Month() == time.Month(month) && t.Day() == dayOfMonth
+		}
+		t, exists := date(today.Year())
+		if !exists || t.Before(today) {
+			t, exists = date(today.Year() + 1)
+		}
+		return t, false, exists
+	}
+	return time.Time{}, false, false
+}
+
+// parseClock parses times such as 23:59, 9am, 9:30pm, noon and midnight.
+func parseClock(s string) (hour, minute int, ok bool) {
+	s = strings.ToLower(s)
+	switch s {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 0, 0, true
+	}
+	pm := false
+	twelveHour := false
+	if rest, ok := strings.CutSuffix(s, "am"); ok {
+		s, twelveHour = rest, true
+	} else if rest, ok := strings.CutSuffix(s, "pm"); ok {
+		s, twelveHour, pm = rest, true, true
+	}
+	h, m, hasMinute := strings.Cut(s, ":")
+	if !hasMinute && !twelveHour {
+		// a bare number is not a time
+		return 0, 0, false
+	}
+	hour, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, false
+	}
+	if hasMinute {
+		if len(m) != 2 {
+			return 0, 0, false
+		}
+		minute, err = strconv.Atoi(m)
+		if err != nil || minute < 0 || minute > 59 {
+			return 0, 0, false
+		}
+	}
+	if twelveHour {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	} else if hour < 0 || hour > 23 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
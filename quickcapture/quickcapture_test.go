@@ -0,0 +1,99 @@
+package quickcapture
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a Wednesday
+	now := time.Date(2025, 1, 8, 15, 0, 0, 0, loc)
+	res, err := Parse("CS2110 hw3 due fri 23:59 deadline sat @library ~2h #cs2110", now, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Task.QuickTitle != "CS2110 hw3" {
+		t.Errorf("title %q", res.Task.QuickTitle)
+	}
+	if want := time.Date(2025, 1, 10, 23, 59, 0, 0, loc); res.Task.Due == nil || !res.Task.Due.Equal(want) {
+		t.Errorf("due %v", res.Task.Due)
+	}
+	if want := time.Date(2025, 1, 11, 23, 59, 0, 0, loc); res.Task.Deadline == nil || !res.Task.Deadline.Equal(want) {
+		t.Errorf("deadline %v", res.Task.Deadline)
+	}
+	if len(res.Tags) != 1 || res.Tags[0] != "cs2110" {
+		t.Errorf("tags %v", res.Tags)
+	}
+	p := res.Plan
+	if p == nil {
+		t.Fatal("no plan")
+	}
+	if p.Location != "library" || p.DurationGe != 90*time.Minute || p.DurationLt != 150*time.Minute {
+		t.Errorf("plan %+v", p)
+	}
+	if !p.TimeAtAfter.Equal(now) || !p.TimeBefore.Equal(*res.Task.Due) {
+		t.Errorf("plan window %s to %s", p.TimeAtAfter, p.TimeBefore)
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	loc := time.UTC
+	// a Wednesday
+	now := time.Date(2025, 1, 8, 15, 0, 0, 0, loc)
+	for s, want := range map[string]time.Time{
+		"x due today":          time.Date(2025, 1, 8, 23, 59, 0, 0, loc),
+		"x due tomorrow 9am":   time.Date(2025, 1, 9, 9, 0, 0, 0, loc),
+		"x due 14:00":          time.Date(2025, 1, 9, 14, 0, 0, 0, loc),
+		"x due 9:30pm":         time.Date(2025, 1, 8, 21, 30, 0, 0, loc),
+		"x due wed noon":       time.Date(2025, 1, 15, 12, 0, 0, 0, loc),
+		"x due wed":            time.Date(2025, 1, 8, 23, 59, 0, 0, loc),
+		"x due 2025-02-01":     time.Date(2025, 2, 1, 23, 59, 0, 0, loc),
+		"x due 1/2 midnight":   time.Date(2026, 1, 2, 0, 0, 0, 0, loc),
+		"x due Friday 12pm":    time.Date(2025, 1, 10, 12, 0, 0, 0, loc),
+		"x due monday 12am #a": time.Date(2025, 1, 13, 0, 0, 0, 0, loc),
+	} {
+		res, err := Parse(s, now, loc)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if res.Task.Due == nil || !res.Task.Due.Equal(want) {
+			t.Errorf("%q: got %v, want %s", s, res.Task.Due, want)
+		}
+		if res.Task.QuickTitle != "x" {
+			t.Errorf("%q: title %q", s, res.Task.QuickTitle)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Date(2025, 1, 8, 15, 0, 0, 0, time.UTC)
+	res, err := Parse("due process essay", now, time.UTC)
+	if err != nil || res.Task.QuickTitle != "due process essay" || res.Task.Due != nil {
+		t.Errorf("due not followed by a time: %+v, %v", res, err)
+	}
+	for _, s := range []string{"x due 2/30", "x due 4/31", "x due 2/29"} {
+		res, err = Parse(s, now, time.UTC)
+		if err != nil || res.Task.QuickTitle != s || res.Task.Due != nil {
+			t.Errorf("%q: date that does not exist was parsed: %+v, %v", s, res, err)
+		}
+	}
+	for _, s := range []string{
+		"",
+		"#tag @home",
+		"x ~2h",
+		"x due fri due sat",
+		"x due sat deadline fri",
+		"x ~2h-1h due fri",
+		"x from sat due fri",
+	} {
+		_, err := Parse(s, now, time.UTC)
+		if err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
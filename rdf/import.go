@@ -0,0 +1,221 @@
+package rdf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"nyiyui.ca/jks/storage"
+)
+
+const (
+	KindTask     = "task"
+	KindActivity = "activity"
+	KindPlan     = "plan"
+)
+
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionAdd
+	ActionEdit
+)
+
+// Change describes what Import did (or would do, in a dry run) for one subject.
+type Change struct {
+	Kind string
+	URI  string
+	// LocalID is zero if the subject is added in a dry run.
+	LocalID int64
+	Action  Action
+	// Fields lists the fields that differ from the local row when Action is ActionEdit.
+	Fields []string
+}
+
+func (c Change) String() string {
+	switch c.Action {
+	case ActionAdd:
+		return fmt.Sprintf("+ %s %s", c.Kind, c.URI)
+	case ActionEdit:
+		return fmt.Sprintf("~ %s %s → %d (%s)", c.Kind, c.URI, c.LocalID, strings.Join(c.Fields, ", "))
+	default:
+		return fmt.Sprintf("= %s %s → %d", c.Kind, c.URI, c.LocalID)
+	}
+}
+
+// Import adds or edits tasks, activities and plans in st to match ds.
+// Subjects are matched to local rows using the mapping table (see storage.Storage.MappingGet); subjects without a mapping are added and the mapping is recorded.
+// If dryRun is true, st is not modified and the returned changes describe what would be done.
+// The import is done in one transaction, so nothing is changed if it fails partway.
+func Import(ds Dataset, st storage.Storage, dryRun bool, ctx context.Context) (changes []Change, err error) {
+	err = st.WithTx(ctx, func(st storage.Storage) error {
+		changes, err = importDataset(ds, st, dryRun, ctx)
+		return err
+	})
+	return
+}
+
+func importDataset(ds Dataset, st storage.Storage, dryRun bool, ctx context.Context) ([]Change, error) {
+	var changes []Change
+	taskIDs := map[string]int64{}
+	for _, ft := range ds.Tasks {
+		id, ok, err := st.MappingGet(KindTask, ft.URI, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: mapping: %w", ft.URI, err)
+		}
+		change := Change{Kind: KindTask, URI: ft.URI, LocalID: id}
+		if !ok {
+			change.Action = ActionAdd
+			if !dryRun {
+				change.LocalID, err = st.TaskAdd(ft.Task, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("task %s: add: %w", ft.URI, err)
+				}
+				err = st.MappingSet(KindTask, ft.URI, change.LocalID, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("task %s: mapping: %w", ft.URI, err)
+				}
+			}
+		} else {
+			local, err := st.TaskGet(id, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("task %s: get %d: %w", ft.URI, id, err)
+			}
+			want := ft.Task
+			want.ID = id
+			want.Version = local.Version
+			change.Fields = storage.ChangedFields(local, want)
+			if len(change.Fields) != 0 {
+				change.Action = ActionEdit
+				if !dryRun {
+					err = st.TaskEdit(want, ctx)
+					if err != nil {
+						return nil, fmt.Errorf("task %s: edit %d: %w", ft.URI, id, err)
+					}
+				}
+			}
+		}
+		taskIDs[ft.URI] = change.LocalID
+		changes = append(changes, change)
+	}
+	resolveTask := func(uri string) (int64, error) {
+		if id, ok := taskIDs[uri]; ok {
+			return id, nil
+		}
+		id, ok, err := st.MappingGet(KindTask, uri, ctx)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fmt.Errorf("task %s is neither in the dataset nor imported before", uri)
+		}
+		return id, nil
+	}
+
+	activityIDs := map[string]int64{}
+	for _, fa := range ds.Activities {
+		taskID, err := resolveTask(fa.TaskURI)
+		if err != nil {
+			return nil, fmt.Errorf("activity %s: %w", fa.URI, err)
+		}
+		id, ok, err := st.MappingGet(KindActivity, fa.URI, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("activity %s: mapping: %w", fa.URI, err)
+		}
+		want := fa.Activity
+		want.TaskID = taskID
+		change := Change{Kind: KindActivity, URI: fa.URI, LocalID: id}
+		if !ok {
+			change.Action = ActionAdd
+			if !dryRun {
+				change.LocalID, err = st.ActivityAdd(want, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("activity %s: add: %w", fa.URI, err)
+				}
+				err = st.MappingSet(KindActivity, fa.URI, change.LocalID, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("activity %s: mapping: %w", fa.URI, err)
+				}
+			}
+		} else {
+			local, err := st.ActivityGet(id, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("activity %s: get %d: %w", fa.URI, id, err)
+			}
+			want.ID = id
+			want.Version = local.Version
+			change.Fields = storage.ChangedFields(local, want)
+			if len(change.Fields) != 0 {
+				change.Action = ActionEdit
+				if !dryRun {
+					err = st.ActivityEdit(want, ctx)
+					if err != nil {
+						return nil, fmt.Errorf("activity %s: edit %d: %w", fa.URI, id, err)
+					}
+				}
+			}
+		}
+		activityIDs[fa.URI] = change.LocalID
+		changes = append(changes, change)
+	}
+
+	for _, fp := range ds.Plans {
+		taskID, err := resolveTask(fp.TaskURI)
+		if err != nil {
+			return nil, fmt.Errorf("plan %s: %w", fp.URI, err)
+		}
+		want := fp.Plan
+		want.TaskID = taskID
+		if fp.ActivityURI != "" {
+			activityID, ok := activityIDs[fp.ActivityURI]
+			if !ok {
+				activityID, ok, err = st.MappingGet(KindActivity, fp.ActivityURI, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("plan %s: activity mapping: %w", fp.URI, err)
+				}
+				if !ok {
+					return nil, fmt.Errorf("plan %s: activity %s is neither in the dataset nor imported before", fp.URI, fp.ActivityURI)
+				}
+			}
+			want.ActivityID = activityID
+		}
+		id, ok, err := st.MappingGet(KindPlan, fp.URI, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("plan %s: mapping: %w", fp.URI, err)
+		}
+		change := Change{Kind: KindPlan, URI: fp.URI, LocalID: id}
+		if !ok {
+			change.Action = ActionAdd
+			if !dryRun {
+				change.LocalID, err = st.PlanAdd(want, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("plan %s: add: %w", fp.URI, err)
+				}
+				err = st.MappingSet(KindPlan, fp.URI, change.LocalID, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("plan %s: mapping: %w", fp.URI, err)
+				}
+			}
+		} else {
+			local, err := st.PlanGet(id, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("plan %s: get %d: %w", fp.URI, id, err)
+			}
+			want.ID = id
+			want.Version = local.Version
+			change.Fields = storage.ChangedFields(local, want)
+			if len(change.Fields) != 0 {
+				change.Action = ActionEdit
+				if !dryRun {
+					err = st.PlanEdit(want, ctx)
+					if err != nil {
+						return nil, fmt.Errorf("plan %s: edit %d: %w", fp.URI, id, err)
+					}
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
@@ -0,0 +1,194 @@
+package rdf
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/deiu/rdf2go"
+	"nyiyui.ca/jks/storage"
+)
+
+const rdfTypeURI = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+
+// Dataset is the set of tasks, activities and plans read back from a graph produced by Serializer.
+// Each entry keeps the subject URI it was read from, so it can be mapped to a local ID.
+type Dataset struct {
+	Tasks      []ForeignTask
+	Activities []ForeignActivity
+	Plans      []ForeignPlan
+}
+
+type ForeignTask struct {
+	URI  string
+	Task storage.Task
+}
+
+type ForeignActivity struct {
+	URI      string
+	TaskURI  string
+	Activity storage.Activity
+}
+
+type ForeignPlan struct {
+	URI     string
+	TaskURI string
+	// ActivityURI is empty if there is no associated activity.
+	ActivityURI string
+	Plan        storage.Plan
+}
+
+// Parse reads a graph in the given MIME type (text/turtle or application/ld+json) from r.
+func (s *Serializer) Parse(r io.Reader, mime string) (*rdf2go.Graph, error) {
+	g := rdf2go.NewGraph(s.baseURI)
+	err := g.Parse(r, mime)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// FromRDF is the inverse of TaskToRDF, ActivityToRDF and PlanToRDF.
+// IDs in the returned values are left zero; use the URIs to find local IDs.
+func (s *Serializer) FromRDF(g *rdf2go.Graph) (Dataset, error) {
+	var ds Dataset
+	for _, subject := range subjectsOfType(g, s.taskURI) {
+		t, err := s.taskFromRDF(g, subject)
+		if err != nil {
+			return Dataset{}, fmt.Errorf("task %s: %w", subject.RawValue(), err)
+		}
+		ds.Tasks = append(ds.Tasks, t)
+	}
+	for _, subject := range subjectsOfType(g, s.activityURI) {
+		a, err := s.activityFromRDF(g, subject)
+		if err != nil {
+			return Dataset{}, fmt.Errorf("activity %s: %w", subject.RawValue(), err)
+		}
+		ds.Activities = append(ds.Activities, a)
+	}
+	for _, subject := range subjectsOfType(g, s.planURI) {
+		p, err := s.planFromRDF(g, subject)
+		if err != nil {
+			return Dataset{}, fmt.Errorf("plan %s: %w", subject.RawValue(), err)
+		}
+		ds.Plans = append(ds.Plans, p)
+	}
+	return ds, nil
+}
+
+func subjectsOfType(g *rdf2go.Graph, type_ rdf2go.Term) []rdf2go.Term {
+	var subjects []rdf2go.Term
+	// TaskToRDF etc. write rdf:type unexpanded, but other tools may expand it
+	for _, t := range g.All(nil, rdfType, type_) {
+		subjects = append(subjects, t.Subject)
+	}
+	for _, t := range g.All(nil, rdf2go.NewResource(rdfTypeURI), type_) {
+		subjects = append(subjects, t.Subject)
+	}
+	return subjects
+}
+
+func (s *Serializer) taskFromRDF(g *rdf2go.Graph, subject rdf2go.Term) (ForeignTask, error) {
+	t := ForeignTask{URI: subject.RawValue()}
+	t.Task.Description = literal(g, subject, s.description)
+	t.Task.QuickTitle = literal(g, subject, s.quickTitle)
+	var err error
+	t.Task.Deadline, err = optionalTime(g, subject, s.deadline)
+	if err != nil {
+		return ForeignTask{}, fmt.Errorf("deadline: %w", err)
+	}
+	t.Task.Due, err = optionalTime(g, subject, s.due)
+	if err != nil {
+		return ForeignTask{}, fmt.Errorf("due: %w", err)
+	}
+	return t, nil
+}
+
+func (s *Serializer) activityFromRDF(g *rdf2go.Graph, subject rdf2go.Term) (ForeignActivity, error) {
+	a := ForeignActivity{URI: subject.RawValue()}
+	a.TaskURI = literal(g, subject, s.forTask)
+	if a.TaskURI == "" {
+		return ForeignActivity{}, fmt.Errorf("no task")
+	}
+	a.Activity.Location = literal(g, subject, s.location)
+	a.Activity.Note = literal(g, subject, s.note)
+	var err error
+	a.Activity.TimeStart, err = requiredTime(g, subject, s.timeStart)
+	if err != nil {
+		return ForeignActivity{}, fmt.Errorf("time start: %w", err)
+	}
+	a.Activity.TimeEnd, err = requiredTime(g, subject, s.timeEnd)
+	if err != nil {
+		return ForeignActivity{}, fmt.Errorf("time end: %w", err)
+	}
+	a.Activity.Done = literal(g, subject, s.done) == "true"
+	return a, nil
+}
+
+func (s *Serializer) planFromRDF(g *rdf2go.Graph, subject rdf2go.Term) (ForeignPlan, error) {
+	p := ForeignPlan{URI: subject.RawValue()}
+	p.TaskURI = literal(g, subject, s.forTask)
+	if p.TaskURI == "" {
+		return ForeignPlan{}, fmt.Errorf("no task")
+	}
+	p.ActivityURI = literal(g, subject, s.forActivity)
+	p.Plan.Location = literal(g, subject, s.location)
+	var err error
+	p.Plan.TimeAtAfter, err = requiredTime(g, subject, s.timeStart)
+	if err != nil {
+		return ForeignPlan{}, fmt.Errorf("time start: %w", err)
+	}
+	p.Plan.TimeBefore, err = requiredTime(g, subject, s.timeEnd)
+	if err != nil {
+		return ForeignPlan{}, fmt.Errorf("time end: %w", err)
+	}
+	p.Plan.DurationGe, err = optionalDuration(g, subject, s.durationGe)
+	if err != nil {
+		return ForeignPlan{}, fmt.Errorf("duration ge: %w", err)
+	}
+	p.Plan.DurationLt, err = optionalDuration(g, subject, s.durationLt)
+	if err != nil {
+		return ForeignPlan{}, fmt.Errorf("duration lt: %w", err)
+	}
+	return p, nil
+}
+
+// literal returns the raw value of the object of (subject, predicate, ?), or "" if there is none.
+func literal(g *rdf2go.Graph, subject, predicate rdf2go.Term) string {
+	t := g.One(subject, predicate, nil)
+	if t == nil {
+		return ""
+	}
+	return t.Object.RawValue()
+}
+
+func optionalTime(g *rdf2go.Graph, subject, predicate rdf2go.Term) (*time.Time, error) {
+	raw := literal(g, subject, predicate)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func requiredTime(g *rdf2go.Graph, subject, predicate rdf2go.Term) (time.Time, error) {
+	t, err := optionalTime(g, subject, predicate)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t == nil {
+		return time.Time{}, fmt.Errorf("missing")
+	}
+	return *t, nil
+}
+
+func optionalDuration(g *rdf2go.Graph, subject, predicate rdf2go.Term) (time.Duration, error) {
+	raw := literal(g, subject, predicate)
+	if raw == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(raw)
+}
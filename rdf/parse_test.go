@@ -0,0 +1,62 @@
+package rdf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/deiu/rdf2go"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestRoundTrip(t *testing.T) {
+	s := NewSerializer("https://example.com/jks/")
+	deadline := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	task := storage.Task{ID: 1, QuickTitle: "hw3", Description: "problem set\n3", Deadline: &deadline}
+	activity := storage.Activity{ID: 2, TaskID: 1, Location: "library", TimeStart: deadline.Add(-time.Hour), TimeEnd: deadline, Done: true, Note: "done"}
+	plan := storage.Plan{ID: 3, TaskID: 1, ActivityID: 2, TimeAtAfter: deadline.Add(-2 * time.Hour), TimeBefore: deadline, DurationGe: time.Hour, DurationLt: 2 * time.Hour}
+
+	g := rdf2go.NewGraph(s.GraphURI())
+	for _, sub := range []func() (*rdf2go.Graph, rdf2go.Term){
+		func() (*rdf2go.Graph, rdf2go.Term) { return s.TaskToRDF(task) },
+		func() (*rdf2go.Graph, rdf2go.Term) { return s.ActivityToRDF(activity) },
+		func() (*rdf2go.Graph, rdf2go.Term) { return s.PlanToRDF(plan) },
+	} {
+		subG, _ := sub()
+		g.Merge(subG)
+	}
+	var buf bytes.Buffer
+	err := g.Serialize(&buf, "text/turtle")
+	if err != nil {
+		t.Fatalf("serialize: %s", err)
+	}
+	g2, err := s.Parse(&buf, "text/turtle")
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	ds, err := s.FromRDF(g2)
+	if err != nil {
+		t.Fatalf("from rdf: %s", err)
+	}
+	if len(ds.Tasks) != 1 || len(ds.Activities) != 1 || len(ds.Plans) != 1 {
+		t.Fatalf("expected 1 of each, got %d tasks, %d activities, %d plans", len(ds.Tasks), len(ds.Activities), len(ds.Plans))
+	}
+	task.ID = 0
+	if fields := storage.ChangedFields(task, ds.Tasks[0].Task); len(fields) != 0 {
+		t.Fatalf("task differs in %v: %#v", fields, ds.Tasks[0].Task)
+	}
+	activity.ID, activity.TaskID = 0, 0
+	if fields := storage.ChangedFields(activity, ds.Activities[0].Activity); len(fields) != 0 {
+		t.Fatalf("activity differs in %v: %#v", fields, ds.Activities[0].Activity)
+	}
+	plan.ID, plan.TaskID, plan.ActivityID = 0, 0, 0
+	if fields := storage.ChangedFields(plan, ds.Plans[0].Plan); len(fields) != 0 {
+		t.Fatalf("plan differs in %v: %#v", fields, ds.Plans[0].Plan)
+	}
+	if ds.Activities[0].TaskURI != ds.Tasks[0].URI {
+		t.Fatalf("activity task URI %s does not match task URI %s", ds.Activities[0].TaskURI, ds.Tasks[0].URI)
+	}
+	if ds.Plans[0].ActivityURI != ds.Activities[0].URI {
+		t.Fatalf("plan activity URI %s does not match activity URI %s", ds.Plans[0].ActivityURI, ds.Activities[0].URI)
+	}
+}
@@ -42,12 +42,14 @@ type Serializer struct {
 	deadline    rdf2go.Term
 	due         rdf2go.Term
 	forTask     rdf2go.Term
+	forActivity rdf2go.Term
 	location    rdf2go.Term
 	timeStart   rdf2go.Term
 	timeEnd     rdf2go.Term
 	done        rdf2go.Term
 	durationGe  rdf2go.Term
 	durationLt  rdf2go.Term
+	note        rdf2go.Term
 }
 
 func NewSerializer(baseURI string) *Serializer {
@@ -61,12 +63,14 @@ func NewSerializer(baseURI string) *Serializer {
 		deadline:    rdf2go.NewResource(mustJoinPath(jksBaseURI, "deadline")),
 		due:         rdf2go.NewResource(mustJoinPath(jksBaseURI, "due")),
 		forTask:     rdf2go.NewResource(mustJoinPath(jksBaseURI, "forTask")),
+		forActivity: rdf2go.NewResource(mustJoinPath(jksBaseURI, "forActivity")),
 		location:    rdf2go.NewResource(mustJoinPath(jksBaseURI, "location")),
 		timeStart:   rdf2go.NewResource(mustJoinPath(jksBaseURI, "timeStart")),
 		timeEnd:     rdf2go.NewResource(mustJoinPath(jksBaseURI, "timeEnd")),
 		done:        rdf2go.NewResource(mustJoinPath(jksBaseURI, "done")),
 		durationGe:  rdf2go.NewResource(mustJoinPath(jksBaseURI, "durationGe")),
 		durationLt:  rdf2go.NewResource(mustJoinPath(jksBaseURI, "durationLt")),
+		note:        rdf2go.NewResource(mustJoinPath(jksBaseURI, "note")),
 	}
 }
 
@@ -74,6 +78,14 @@ func (s *Serializer) GraphURI() string {
 	return s.baseURI
 }
 
+// Prefixes returns the prefixes used by the serialized graph: jks: for the vocabulary and data: for subjects.
+func (s *Serializer) Prefixes() map[string]string {
+	return map[string]string{
+		"jks":  jksBaseURI,
+		"data": s.baseURI,
+	}
+}
+
 func (s *Serializer) TaskToRDF(t storage.Task) (*rdf2go.Graph, rdf2go.Term) {
 	taskURI := mustJoinPath(s.baseURI, "tasks", fmt.Sprint(t.ID))
 	g := rdf2go.NewGraph(taskURI)
@@ -100,6 +112,7 @@ func (s *Serializer) ActivityToRDF(a storage.Activity) (*rdf2go.Graph, rdf2go.Te
 	g.AddTriple(subject, s.timeStart, rdf2go.NewLiteralWithDatatype(a.TimeStart.Format(time.RFC3339), xsdDateTime))
 	g.AddTriple(subject, s.timeEnd, rdf2go.NewLiteralWithDatatype(a.TimeEnd.Format(time.RFC3339), xsdDateTime))
 	g.AddTriple(subject, s.done, boolToRDF(a.Done))
+	g.AddTriple(subject, s.note, rdf2go.NewLiteral(a.Note))
 	return g, subject
 }
 
@@ -109,6 +122,9 @@ func (s *Serializer) PlanToRDF(p storage.Plan) (*rdf2go.Graph, rdf2go.Term) {
 	subject := rdf2go.NewResource(planURI)
 	g.AddTriple(subject, rdfType, s.planURI)
 	g.AddTriple(subject, s.forTask, rdf2go.NewResource(mustJoinPath(s.baseURI, "tasks", fmt.Sprint(p.TaskID))))
+	if p.ActivityID != 0 {
+		g.AddTriple(subject, s.forActivity, rdf2go.NewResource(mustJoinPath(s.baseURI, "activities", fmt.Sprint(p.ActivityID))))
+	}
 	g.AddTriple(subject, s.location, rdf2go.NewLiteral(p.Location))
 	g.AddTriple(subject, s.timeStart, rdf2go.NewLiteralWithDatatype(p.TimeAtAfter.Format(time.RFC3339), xsdDateTime))
 	g.AddTriple(subject, s.timeEnd, rdf2go.NewLiteralWithDatatype(p.TimeBefore.Format(time.RFC3339), xsdDateTime))
@@ -0,0 +1,107 @@
+package recurrence
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// ReadICS reads the events of an iCalendar file (RFC 5545) as ranges of days, e.g. to make an exception calendar of a school's breaks.
+// name is the calendar's X-WR-CALNAME, if it has one.
+//
+// An event's range is from the date of its DTSTART to the date of its DTEND; DTENDs of all-day events (and others ending at midnight) are exclusive.
+// Times are not converted between time zones, so a DTSTART;TZID=America/New_York:20250317T090000 is on 2025-03-17.
+// Recurring events only have their first occurrence.
+func ReadICS(r io.Reader) (name string, ranges []storage.DateRange, err error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			// folded
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := s.Err(); err != nil {
+		return "", nil, err
+	}
+
+	var event *storage.DateRange
+	var hasEnd bool
+	// nested counts the components (e.g. VALARM) open within the event
+	var nested int
+	for i, line := range lines {
+		prop, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		propName, _, _ := strings.Cut(prop, ";")
+		switch {
+		case propName == "X-WR-CALNAME" && event == nil:
+			name = unescapeICS(value)
+		case propName == "BEGIN" && value == "VEVENT":
+			event = &storage.DateRange{}
+			hasEnd = false
+			nested = 0
+		case event == nil:
+		case propName == "BEGIN":
+			nested++
+		case propName == "END" && nested > 0:
+			nested--
+		case nested > 0:
+		case propName == "SUMMARY":
+			event.Summary = unescapeICS(value)
+		case propName == "DTSTART":
+			event.Start, _, err = parseICSDate(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("line %d: DTSTART: %w", i+1, err)
+			}
+		case propName == "DTEND":
+			var midnight bool
+			event.End, midnight, err = parseICSDate(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("line %d: DTEND: %w", i+1, err)
+			}
+			if midnight {
+				event.End = event.End.AddDate(0, 0, -1)
+			}
+			hasEnd = true
+		case propName == "END" && value == "VEVENT":
+			if event.Start.IsZero() {
+				return "", nil, fmt.Errorf("line %d: event without DTSTART", i+1)
+			}
+			if !hasEnd || event.End.Before(event.Start) {
+				event.End = event.Start
+			}
+			ranges = append(ranges, *event)
+			event = nil
+		}
+	}
+	return name, ranges, nil
+}
+
+// parseICSDate returns the date of a DATE or DATE-TIME value.
+// midnight is true for DATE values and DATE-TIME values at 00:00:00, as they end on the day before when used as DTEND.
+func parseICSDate(value string) (date time.Time, midnight bool, err error) {
+	if len(value) < 8 {
+		return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+	}
+	date, err = time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	t := strings.TrimSuffix(value[8:], "Z")
+	return date, t == "" || t == "T000000", nil
+}
+
+var icsUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, `,`, `\;`, `;`, `\n`, "\n", `\N`, "\n")
+
+func unescapeICS(s string) string {
+	return icsUnescaper.Replace(s)
+}
@@ -0,0 +1,362 @@
+// Package recurrence adds tasks for the occurrences of recurrence rules.
+//
+// Each generated task is recorded as a storage.Occurrence of its rule, so generating the same range again edits the tasks instead of adding duplicates.
+package recurrence
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// Rule is a task to add for each occurrence of a recurrence set.
+type Rule struct {
+	// Key identifies the rule in occurrence keys, so it must not change when the rule is edited.
+	Key string
+	Set *rrule.Set
+	// ExDays are days without occurrences.
+	// Only their dates are used: an occurrence is skipped if its date, in its own time zone, is one of them.
+	ExDays []time.Time
+	// Exceptions are ranges of days without occurrences, e.g. those of exception calendars.
+	Exceptions []storage.DateRange
+	// Task is the template of each occurrence's task; Due and Deadline are set to the occurrence's time.
+	Task storage.Task
+	// Plan is the template of a plan to add for each occurrence's task, or nil to add none.
+	// Plans added before are kept when Plan is changed to nil.
+	Plan *storage.PlanTemplate
+}
+
+// ParseSet parses a recurrence set of DTSTART, RRULE, RDATE and EXDATE lines, as in RFC 5545.
+// Blank lines are ignored.
+func ParseSet(s string) (*rrule.Set, error) {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty recurrence set")
+	}
+	return rrule.StrSliceToRRuleSet(lines)
+}
+
+// ParseDays parses dates (2006-01-02) separated by commas or whitespace.
+func ParseDays(s string) ([]time.Time, error) {
+	var days []time.Time
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}) {
+		day, err := time.Parse(time.DateOnly, field)
+		if err != nil {
+			return nil, fmt.Errorf("day %q: %w", field, err)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// ParseRange parses a range of days such as "2025-03-17/2025-03-21 Spring break" or "2025-01-20", followed by an optional summary.
+func ParseRange(s string) (storage.DateRange, error) {
+	days, summary, _ := strings.Cut(strings.TrimSpace(s), " ")
+	start, end, isRange := strings.Cut(days, "/")
+	if !isRange {
+		end = start
+	}
+	var r storage.DateRange
+	var err error
+	r.Start, err = time.Parse(time.DateOnly, start)
+	if err != nil {
+		return storage.DateRange{}, fmt.Errorf("start: %w", err)
+	}
+	r.End, err = time.Parse(time.DateOnly, end)
+	if err != nil {
+		return storage.DateRange{}, fmt.Errorf("end: %w", err)
+	}
+	if r.End.Before(r.Start) {
+		return storage.DateRange{}, fmt.Errorf("%s ends before it starts", days)
+	}
+	r.Summary = strings.TrimSpace(summary)
+	return r, nil
+}
+
+// ParseRanges parses a range (see ParseRange) per line, ignoring blank lines.
+func ParseRanges(s string) ([]storage.DateRange, error) {
+	var rs []storage.DateRange
+	for i, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		r, err := ParseRange(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// FormatRange formats r as parsed by ParseRange.
+func FormatRange(r storage.DateRange) string {
+	s := r.Start.Format(time.DateOnly)
+	if end := r.End.Format(time.DateOnly); end != s {
+		s += "/" + end
+	}
+	if r.Summary != "" {
+		s += " " + r.Summary
+	}
+	return s
+}
+
+// Occurrences returns the times of the rule's occurrences between from and to (inclusive).
+func (r Rule) Occurrences(from, to time.Time) []time.Time {
+	skip := map[string]bool{}
+	for _, day := range r.ExDays {
+		skip[day.Format(time.DateOnly)] = true
+	}
+	var ts []time.Time
+occurrences:
+	for _, t := range r.Set.Between(from, to, true) {
+		if skip[t.Format(time.DateOnly)] {
+			continue
+		}
+		for _, e := range r.Exceptions {
+			if e.Contains(t) {
+				continue occurrences
+			}
+		}
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionAdd
+	ActionEdit
+	// ActionRemove is an occurrence generated before that the rule no longer has; its task and plan are deleted.
+	ActionRemove
+	// ActionKeep is like ActionRemove, but the task is kept as it has activities.
+	ActionKeep
+)
+
+// Change describes what Generate did (or would do, in a dry run) for one occurrence.
+type Change struct {
+	Time time.Time
+	// TaskID is zero if the task is added in a dry run.
+	TaskID int64
+	// PlanID is zero if there is no plan, or it is added in a dry run.
+	PlanID int64
+	Action Action
+	// Fields lists the fields of the task, and of the plan (prefixed with "Plan."), that differ from the rule's when Action is ActionEdit.
+	// It is just "Plan" if the plan is added to an existing task.
+	Fields []string
+}
+
+func (c Change) String() string {
+	switch c.Action {
+	case ActionAdd:
+		return fmt.Sprintf("+ %s", c.Time)
+	case ActionEdit:
+		return fmt.Sprintf("~ %s → %d (%s)", c.Time, c.TaskID, strings.Join(c.Fields, ", "))
+	case ActionRemove:
+		return fmt.Sprintf("- %s → %d", c.Time, c.TaskID)
+	case ActionKeep:
+		return fmt.Sprintf("! %s → %d (no longer an occurrence, but kept as it has activities)", c.Time, c.TaskID)
+	default:
+		return fmt.Sprintf("= %s → %d", c.Time, c.TaskID)
+	}
+}
+
+// Generate adds a task for each occurrence of the rule between from and to (inclusive), and edits the tasks of occurrences generated before to match the rule.
+// The changes are made atomically; in a dry run, they are only returned.
+func Generate(r Rule, st storage.Storage, from, to time.Time, dryRun bool, ctx context.Context) ([]Change, error) {
+	var changes []Change
+	err := st.WithTx(ctx, func(st storage.Storage) error {
+		for _, t := range r.Occurrences(from, to) {
+			change, err := generate(r, t, st, dryRun, ctx)
+			if err != nil {
+				return fmt.Errorf("occurrence at %s: %w", t, err)
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Extend is Generate, but only adds the tasks of occurrences not generated before; the tasks of those generated before are left as they are, so that edits made to them are kept.
+func Extend(r Rule, st storage.Storage, from, to time.Time, dryRun bool, ctx context.Context) ([]Change, error) {
+	var changes []Change
+	err := st.WithTx(ctx, func(st storage.Storage) error {
+		for _, t := range r.Occurrences(from, to) {
+			o, ok, err := st.OccurrenceGet(r.Key, t, ctx)
+			if err != nil {
+				return fmt.Errorf("occurrence at %s: %w", t, err)
+			}
+			if ok {
+				changes = append(changes, Change{Time: t, TaskID: o.TaskID, PlanID: o.PlanID, Action: ActionNone})
+				continue
+			}
+			change, err := generate(r, t, st, dryRun, ctx)
+			if err != nil {
+				return fmt.Errorf("occurrence at %s: %w", t, err)
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Reconcile is Generate, but also removes the tasks of occurrences between from and to that were generated before, but that the rule no longer has (e.g. after an exception date was added).
+// Tasks with activities are kept.
+// The changes are ordered by time.
+func Reconcile(r Rule, st storage.Storage, from, to time.Time, dryRun bool, ctx context.Context) ([]Change, error) {
+	var changes []Change
+	err := st.WithTx(ctx, func(st storage.Storage) error {
+		want := map[int64]bool{}
+		for _, t := range r.Occurrences(from, to) {
+			change, err := generate(r, t, st, dryRun, ctx)
+			if err != nil {
+				return fmt.Errorf("occurrence at %s: %w", t, err)
+			}
+			changes = append(changes, change)
+			want[t.Unix()] = true
+		}
+		os, err := st.OccurrenceRange(r.Key, from, to, ctx)
+		if err != nil {
+			return err
+		}
+		for _, o := range os {
+			if want[o.Time.Unix()] {
+				continue
+			}
+			change := Change{Time: o.Time, TaskID: o.TaskID, PlanID: o.PlanID, Action: ActionRemove}
+			as, err := st.TaskGetActivities(o.TaskID, ctx)
+			if err != nil {
+				return fmt.Errorf("occurrence at %s: %w", o.Time, err)
+			}
+			if len(as) != 0 {
+				change.Action = ActionKeep
+			} else if !dryRun {
+				err = st.TaskDelete(o.TaskID, ctx)
+				if err != nil {
+					return fmt.Errorf("occurrence at %s: delete %d: %w", o.Time, o.TaskID, err)
+				}
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time.Before(changes[j].Time) })
+	return changes, nil
+}
+
+func generate(r Rule, t time.Time, st storage.Storage, dryRun bool, ctx context.Context) (Change, error) {
+	change := Change{Time: t}
+	want := r.Task
+	want.Due = &t
+	want.Deadline = &t
+	o, ok, err := st.OccurrenceGet(r.Key, t, ctx)
+	if err != nil {
+		return Change{}, err
+	}
+	if !ok {
+		change.Action = ActionAdd
+		if dryRun {
+			return change, nil
+		}
+		change.TaskID, err = st.TaskAdd(want, ctx)
+		if err != nil {
+			return Change{}, fmt.Errorf("add: %w", err)
+		}
+		if r.Plan != nil {
+			change.PlanID, err = st.PlanAdd(r.Plan.Plan(change.TaskID, t), ctx)
+			if err != nil {
+				return Change{}, fmt.Errorf("add plan: %w", err)
+			}
+		}
+		return change, st.OccurrenceSet(storage.Occurrence{Rule: r.Key, Time: t, TaskID: change.TaskID, PlanID: change.PlanID}, ctx)
+	}
+	change.TaskID = o.TaskID
+	change.PlanID = o.PlanID
+	local, err := st.TaskGet(o.TaskID, ctx)
+	if err != nil {
+		return Change{}, fmt.Errorf("get %d: %w", o.TaskID, err)
+	}
+	want.ID = local.ID
+	want.Version = local.Version
+	taskFields := storage.ChangedFields(local, want)
+	change.Fields = taskFields
+
+	var wantPlan storage.Plan
+	var planFields []string
+	if r.Plan != nil {
+		wantPlan = r.Plan.Plan(o.TaskID, t)
+		if o.PlanID == 0 {
+			change.Fields = append(change.Fields, "Plan")
+		} else {
+			localPlan, err := st.PlanGet(o.PlanID, ctx)
+			if err != nil {
+				return Change{}, fmt.Errorf("get plan %d: %w", o.PlanID, err)
+			}
+			wantPlan.ID = localPlan.ID
+			wantPlan.ActivityID = localPlan.ActivityID
+			wantPlan.Version = localPlan.Version
+			planFields = storage.ChangedFields(localPlan, wantPlan)
+			for _, field := range planFields {
+				change.Fields = append(change.Fields, "Plan."+field)
+			}
+		}
+	}
+	if len(change.Fields) == 0 {
+		return change, nil
+	}
+	change.Action = ActionEdit
+	if dryRun {
+		return change, nil
+	}
+	if len(taskFields) != 0 {
+		err = st.TaskEdit(want, ctx)
+		if err != nil {
+			return Change{}, fmt.Errorf("edit %d: %w", o.TaskID, err)
+		}
+	}
+	switch {
+	case r.Plan != nil && o.PlanID == 0:
+		change.PlanID, err = st.PlanAdd(wantPlan, ctx)
+		if err != nil {
+			return Change{}, fmt.Errorf("add plan: %w", err)
+		}
+		o.PlanID = change.PlanID
+		err = st.OccurrenceSet(o, ctx)
+		if err != nil {
+			return Change{}, err
+		}
+	case len(planFields) != 0:
+		err = st.PlanEdit(wantPlan, ctx)
+		if err != nil {
+			return Change{}, fmt.Errorf("edit plan %d: %w", o.PlanID, err)
+		}
+	}
+	return change, nil
+}
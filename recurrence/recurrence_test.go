@@ -0,0 +1,174 @@
+package recurrence
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	exDays, err := ParseDays("2025-01-08")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := st.RecurrenceAdd(storage.Recurrence{
+		Name:   "lecture",
+		Set:    "DTSTART;TZID=America/New_York:20250106T093000\r\nRRULE:FREQ=DAILY;COUNT=5\n",
+		ExDays: exDays,
+		Task:   storage.Task{QuickTitle: "lecture"},
+		Active: true,
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(st)
+	s.Horizon = 7 * 24 * time.Hour
+	now := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	s.GenerateAll(now, ctx)
+	s.GenerateAll(now, ctx)
+
+	r, err := st.RecurrenceGet(id, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// edits to generated tasks survive the scheduler
+	rule, err := s.rule(r, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, ok, err := st.OccurrenceGet(rule.Key, rule.Occurrences(now, now.Add(s.Horizon))[0], ctx)
+	if err != nil || !ok {
+		t.Fatal(o, ok, err)
+	}
+	task, err := st.TaskGet(o.TaskID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.QuickTitle = "lecture (room 101)"
+	err = st.TaskEdit(task, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.GenerateAll(now, ctx)
+	task, err = st.TaskGet(o.TaskID, ctx)
+	if err != nil || task.QuickTitle != "lecture (room 101)" {
+		t.Fatalf("edit reverted: %#v %v", task, err)
+	}
+	task.QuickTitle = "lecture"
+	err = st.TaskEdit(task, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Task.QuickTitle = "Lecture"
+	changes, err := s.Generate(r, now, true, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 {
+		t.Fatalf("changes %v", changes)
+	}
+	for _, c := range changes {
+		if c.Action != ActionEdit || c.TaskID == 0 || c.Time.Weekday() == time.Wednesday || c.Time.Hour() != 9 {
+			t.Fatalf("change %v", c)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	set, err := ParseSet("DTSTART:20250106T093000Z\nRRULE:FREQ=DAILY;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Rule{Key: "lecture", Set: set, Task: storage.Task{QuickTitle: "lecture"}, Plan: &storage.PlanTemplate{TimeBeforeOffset: time.Hour}}
+	from := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+	added, err := Generate(r, st, from, to, false, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first lecture was attended before both were cancelled
+	_, err = st.ActivityAdd(storage.Activity{TaskID: added[0].TaskID, TimeStart: added[0].Time, TimeEnd: added[0].Time.Add(time.Hour)}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ExDays, err = ParseDays("2025-01-06 2025-01-07")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dryRun := range []bool{true, false} {
+		changes, err := Reconcile(r, st, from, to, dryRun, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 3 || changes[0].Action != ActionKeep || changes[1].Action != ActionRemove || changes[2].Action != ActionNone {
+			t.Fatalf("dry run %t: %v", dryRun, changes)
+		}
+	}
+	_, err = st.TaskGet(added[1].TaskID, ctx)
+	if err == nil {
+		t.Fatal("removed task still exists")
+	}
+	_, err = st.PlanGet(added[1].PlanID, ctx)
+	if err == nil {
+		t.Fatal("removed plan still exists")
+	}
+	err = st.TaskDelete(added[0].TaskID, ctx)
+	if err != storage.ErrHasActivities {
+		t.Fatalf("delete task with activities: %v", err)
+	}
+}
+
+func TestReadICS(t *testing.T) {
+	name, ranges, err := ReadICS(strings.NewReader(strings.ReplaceAll(`BEGIN:VCALENDAR
+X-WR-CALNAME:GT Spring 2025
+BEGIN:VEVENT
+SUMMARY:Spring break\, no classes
+DTSTART;VALUE=DATE:20250317
+DTEND;VALUE=DATE:20250322
+BEGIN:VALARM
+SUMMARY:alarm
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:MLK
+  Day
+DTSTART;TZID=America/New_York:20250120T090000
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "GT Spring 2025" || len(ranges) != 2 {
+		t.Fatalf("%q %v", name, ranges)
+	}
+	for i, want := range []string{"2025-03-17/2025-03-21 Spring break, no classes", "2025-01-20 MLK Day"} {
+		if got := FormatRange(ranges[i]); got != want {
+			t.Fatalf("range %d: %q", i, got)
+		}
+		r, err := ParseRange(want)
+		if err != nil || r != ranges[i] {
+			t.Fatalf("parse range %d: %v %v", i, r, err)
+		}
+	}
+
+	set, err := ParseSet("DTSTART;TZID=America/New_York:20250314T233000\nRRULE:FREQ=DAILY;COUNT=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the day of an occurrence is in its own time zone, although it is the next day in UTC
+	r := Rule{Set: set, Exceptions: ranges}
+	ts := r.Occurrences(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	if len(ts) != 5 || ts[2].Day() != 16 || ts[3].Day() != 22 {
+		t.Fatalf("occurrences %v", ts)
+	}
+}
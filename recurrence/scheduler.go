@@ -0,0 +1,160 @@
+package recurrence
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// FromStorage returns the rule of a stored recurrence, with the ranges of its calendars as exceptions.
+func FromStorage(r storage.Recurrence, calendars []storage.Calendar) (Rule, error) {
+	set, err := ParseSet(r.Set)
+	if err != nil {
+		return Rule{}, err
+	}
+	var exceptions []storage.DateRange
+	for _, c := range calendars {
+		exceptions = append(exceptions, c.Ranges...)
+	}
+	return Rule{
+		Key:        r.OccurrenceRule(),
+		Set:        set,
+		ExDays:     r.ExDays,
+		Exceptions: exceptions,
+		Task: storage.Task{
+			QuickTitle:  r.Task.QuickTitle,
+			Description: r.Task.Description,
+		},
+		Plan: r.Plan,
+	}, nil
+}
+
+// Scheduler generates the occurrences of the active stored recurrences periodically, up to Horizon ahead.
+type Scheduler struct {
+	st storage.Storage
+	// Horizon is how far ahead occurrences are generated.
+	Horizon time.Duration
+	// Interval is how often occurrences are generated.
+	Interval time.Duration
+	// Owners returns the owners (see storage.WithOwner) whose recurrences are generated by Run.
+	// If it is nil, only those of the owner of the context passed to Run are.
+	Owners func(ctx context.Context) ([]string, error)
+}
+
+func NewScheduler(st storage.Storage) *Scheduler {
+	return &Scheduler{
+		st:       st,
+		Horizon:  14 * 24 * time.Hour,
+		Interval: time.Hour,
+	}
+}
+
+// In returns a copy of s that uses st, e.g. the storage of a transaction (see storage.Storage.WithTx).
+func (s *Scheduler) In(st storage.Storage) *Scheduler {
+	s2 := *s
+	s2.st = st
+	return &s2
+}
+
+// Run generates occurrences immediately, and then every Interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.generateOwners(time.Now(), ctx)
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.generateOwners(now, ctx)
+		}
+	}
+}
+
+// generateOwners runs GenerateAll for each of Owners.
+func (s *Scheduler) generateOwners(now time.Time, ctx context.Context) {
+	if s.Owners == nil {
+		s.GenerateAll(now, ctx)
+		return
+	}
+	owners, err := s.Owners(ctx)
+	if err != nil {
+		log.Printf("recurrence: owners: %s", err)
+		return
+	}
+	for _, owner := range owners {
+		s.GenerateAll(now, storage.WithOwner(ctx, owner))
+	}
+}
+
+// GenerateAll adds the missing occurrences of every active recurrence of the owner of ctx between now and Horizon ahead (see Extend).
+// The tasks of occurrences generated before are not edited, so that edits made to them are kept; they are made to match a recurrence when it is saved (see Reconcile).
+// Errors are logged, and do not stop the other recurrences.
+func (s *Scheduler) GenerateAll(now time.Time, ctx context.Context) {
+	rs, err := s.st.Recurrences(ctx)
+	if err != nil {
+		log.Printf("recurrence: %s", err)
+		return
+	}
+	for _, r := range rs {
+		if !r.Active {
+			continue
+		}
+		changes, err := s.Extend(r, now, false, ctx)
+		if err != nil {
+			log.Printf("recurrence: %d %s: %s", r.ID, r.Name, err)
+			continue
+		}
+		for _, change := range changes {
+			if change.Action != ActionNone {
+				log.Printf("recurrence: %d %s: %s", r.ID, r.Name, change)
+			}
+		}
+	}
+}
+
+// Generate generates the occurrences of r between now and Horizon ahead, regardless of whether r is active.
+func (s *Scheduler) Generate(r storage.Recurrence, now time.Time, dryRun bool, ctx context.Context) ([]Change, error) {
+	rule, err := s.rule(r, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Generate(rule, s.st, now, now.Add(s.Horizon), dryRun, ctx)
+}
+
+// Extend is Generate, but only adds the tasks of occurrences not generated before; see Extend.
+func (s *Scheduler) Extend(r storage.Recurrence, now time.Time, dryRun bool, ctx context.Context) ([]Change, error) {
+	rule, err := s.rule(r, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Extend(rule, s.st, now, now.Add(s.Horizon), dryRun, ctx)
+}
+
+// Reconcile is Generate, but also removes the tasks of occurrences r no longer has; see Reconcile.
+func (s *Scheduler) Reconcile(r storage.Recurrence, now time.Time, dryRun bool, ctx context.Context) ([]Change, error) {
+	rule, err := s.rule(r, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Reconcile(rule, s.st, now, now.Add(s.Horizon), dryRun, ctx)
+}
+
+func (s *Scheduler) rule(r storage.Recurrence, ctx context.Context) (Rule, error) {
+	calendars := make([]storage.Calendar, len(r.CalendarIDs))
+	for i, id := range r.CalendarIDs {
+		var err error
+		calendars[i], err = s.st.CalendarGet(id, ctx)
+		if err != nil {
+			return Rule{}, fmt.Errorf("calendar %d: %w", id, err)
+		}
+	}
+	rule, err := FromStorage(r, calendars)
+	if err != nil {
+		return Rule{}, fmt.Errorf("parse: %w", err)
+	}
+	return rule, nil
+}
@@ -0,0 +1,308 @@
+// Package reminder sends reminders about upcoming deadlines, due dates and plans through Notifiers.
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+const (
+	// KindDue reminds Lead before the due date of a task that is not done.
+	KindDue = "due"
+	// KindDeadline reminds Lead before the deadline of a task that is not done.
+	KindDeadline = "deadline"
+	// KindPlan reminds Lead before a plan's window opens, unless the plan already has an activity.
+	KindPlan = "plan"
+	// KindIdle reminds Lead before the due date of a task that has no activities at all.
+	KindIdle = "idle"
+)
+
+// Rule is when to send a reminder.
+type Rule struct {
+	Kind string
+	Lead time.Duration
+}
+
+// ParseRule parses rules such as "due:24h", "deadline:1h", "plan", "plan:10m" and "idle:24h".
+// The lead defaults to zero.
+func ParseRule(s string) (Rule, error) {
+	kind, lead, hasLead := strings.Cut(s, ":")
+	r := Rule{Kind: kind}
+	switch kind {
+	case KindDue, KindDeadline, KindPlan, KindIdle:
+	default:
+		return Rule{}, fmt.Errorf("unknown rule kind %q", kind)
+	}
+	if hasLead {
+		var err error
+		r.Lead, err = time.ParseDuration(lead)
+		if err != nil {
+			return Rule{}, fmt.Errorf("lead: %w", err)
+		}
+		if r.Lead < 0 {
+			return Rule{}, fmt.Errorf("lead must not be negative")
+		}
+	}
+	return r, nil
+}
+
+func (r Rule) String() string {
+	if r.Lead == 0 {
+		return r.Kind
+	}
+	return fmt.Sprintf("%s:%s", r.Kind, r.Lead)
+}
+
+func (r Rule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rule) UnmarshalText(text []byte) error {
+	var err error
+	*r, err = ParseRule(string(text))
+	return err
+}
+
+// Reminder is a notification to send.
+type Reminder struct {
+	Rule Rule `json:"rule"`
+	// Time is when the reminder was scheduled to be sent.
+	Time  time.Time     `json:"time"`
+	Title string        `json:"title"`
+	Body  string        `json:"body"`
+	Task  *storage.Task `json:"task,omitempty"`
+	Plan  *storage.Plan `json:"plan,omitempty"`
+}
+
+// Notifier delivers reminders, e.g. by email or push notification.
+type Notifier interface {
+	Notify(r Reminder, ctx context.Context) error
+}
+
+// planSpan is the longest plan KindPlan reminds of; longer plans are not found by storage.Storage.PlanRange.
+const planSpan = 30 * 24 * time.Hour
+
+// Engine checks the rules periodically, and sends the reminders that became due since the last check.
+type Engine struct {
+	st        storage.Storage
+	rules     []Rule
+	notifiers []Notifier
+	// Interval is how often the rules are checked.
+	Interval time.Duration
+	// Location is the time zone times are shown in.
+	Location *time.Location
+	// Owners returns the owners (see storage.WithOwner) whose tasks Run checks.
+	// If it is nil, only those of the owner of the context passed to Run are.
+	Owners func(ctx context.Context) ([]string, error)
+	// Recipient returns the notifiers of the owner of ctx, and the time zone times in their reminders are shown in.
+	// If ok is false, or Recipient is nil, the notifiers given to NewEngine and Location are used.
+	Recipient func(ctx context.Context) (notifiers []Notifier, loc *time.Location, ok bool, err error)
+}
+
+func NewEngine(st storage.Storage, rules []Rule, notifiers []Notifier) *Engine {
+	return &Engine{
+		st:        st,
+		rules:     rules,
+		notifiers: notifiers,
+		Interval:  time.Minute,
+		Location:  time.Local,
+	}
+}
+
+// Run sends reminders until ctx is done.
+// Reminders that became due while Run was not running are not sent.
+func (e *Engine) Run(ctx context.Context) {
+	last := time.Now()
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.remindOwners(last, now, ctx)
+			last = now
+		}
+	}
+}
+
+// remindOwners runs remind for each of Owners.
+func (e *Engine) remindOwners(from, to time.Time, ctx context.Context) {
+	if e.Owners == nil {
+		e.remind(from, to, ctx)
+		return
+	}
+	owners, err := e.Owners(ctx)
+	if err != nil {
+		log.Printf("reminder: owners: %s", err)
+		return
+	}
+	for _, owner := range owners {
+		e.remind(from, to, storage.WithOwner(ctx, owner))
+	}
+}
+
+// remind sends the reminders of the owner of ctx scheduled in (from, to] to their Recipient.
+func (e *Engine) remind(from, to time.Time, ctx context.Context) {
+	if e.Recipient != nil {
+		notifiers, loc, ok, err := e.Recipient(ctx)
+		if err != nil {
+			log.Printf("reminder: recipient of %q: %s", storage.Owner(ctx), err)
+			return
+		}
+		if ok {
+			e2 := *e
+			e2.notifiers = notifiers
+			e2.Location = loc
+			e = &e2
+		}
+	}
+	if len(e.notifiers) == 0 {
+		return
+	}
+	rs, err := e.Due(from, to, ctx)
+	if err != nil {
+		log.Printf("reminder: %s", err)
+	}
+	for _, r := range rs {
+		e.notify(r, ctx)
+	}
+}
+
+// notify sends r through every notifier; failures are logged and not retried.
+func (e *Engine) notify(r Reminder, ctx context.Context) {
+	for _, n := range e.notifiers {
+		err := n.Notify(r, ctx)
+		if err != nil {
+			log.Printf("reminder: %T: %s: %s", n, r.Title, err)
+		}
+	}
+}
+
+// Due returns the reminders scheduled in (from, to].
+func (e *Engine) Due(from, to time.Time, ctx context.Context) ([]Reminder, error) {
+	var rs []Reminder
+	in := func(t time.Time) bool { return t.After(from) && !t.After(to) }
+	var taskRules, planRules []Rule
+	for _, rule := range e.rules {
+		if rule.Kind == KindPlan {
+			planRules = append(planRules, rule)
+		} else {
+			taskRules = append(taskRules, rule)
+		}
+	}
+
+	if len(taskRules) > 0 {
+		// tasks whose deadline passed in (from, to] still get reminders
+		tsw, err := e.st.TaskSearch("", from, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("undone tasks: %w", err)
+		}
+		defer tsw.Close()
+		const page = 100
+		for offset := 0; ; offset += page {
+			ts, err := tsw.Get(page, offset)
+			if err != nil {
+				return nil, fmt.Errorf("undone tasks: %w", err)
+			}
+			for _, t := range ts {
+				for _, rule := range taskRules {
+					r, ok, err := e.taskReminder(rule, t, in, ctx)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						rs = append(rs, r)
+					}
+				}
+			}
+			if len(ts) < page {
+				break
+			}
+		}
+	}
+
+	for _, rule := range planRules {
+		psw, err := e.st.PlanRange(from.Add(rule.Lead), to.Add(rule.Lead+planSpan), ctx)
+		if err != nil {
+			return nil, fmt.Errorf("plans: %w", err)
+		}
+		const page = 100
+		for offset := 0; ; offset += page {
+			ps, err := psw.Get(page, offset)
+			if err != nil {
+				psw.Close()
+				return nil, fmt.Errorf("plans: %w", err)
+			}
+			for _, p := range ps {
+				p := p
+				at := p.TimeAtAfter.Add(-rule.Lead)
+				if p.ActivityID != 0 || !in(at) {
+					continue
+				}
+				t, err := e.st.TaskGet(p.TaskID, ctx)
+				if err != nil {
+					psw.Close()
+					return nil, fmt.Errorf("task %d: %w", p.TaskID, err)
+				}
+				title := "Plan starts: " + t.QuickTitle
+				if rule.Lead != 0 {
+					title = fmt.Sprintf("Plan starts in %s: %s", rule.Lead, t.QuickTitle)
+				}
+				body := fmt.Sprintf("%s to %s", e.format(p.TimeAtAfter), e.format(p.TimeBefore))
+				if p.Location != "" {
+					body += " at " + p.Location
+				}
+				rs = append(rs, Reminder{Rule: rule, Time: at, Title: title, Body: body, Task: &t, Plan: &p})
+			}
+			if len(ps) < page {
+				break
+			}
+		}
+		psw.Close()
+	}
+	return rs, nil
+}
+
+// taskReminder returns the reminder for t under rule, if it is scheduled at a time in returns true for.
+func (e *Engine) taskReminder(rule Rule, t storage.Task, in func(time.Time) bool, ctx context.Context) (Reminder, bool, error) {
+	var when *time.Time
+	var what string
+	switch rule.Kind {
+	case KindDue, KindIdle:
+		when, what = t.Due, "Due"
+	case KindDeadline:
+		when, what = t.Deadline, "Deadline"
+	}
+	if when == nil || !in(when.Add(-rule.Lead)) {
+		return Reminder{}, false, nil
+	}
+	title := fmt.Sprintf("%s in %s: %s", what, rule.Lead, t.QuickTitle)
+	if rule.Lead == 0 {
+		title = fmt.Sprintf("%s now: %s", what, t.QuickTitle)
+	}
+	if rule.Kind == KindIdle {
+		as, err := e.st.TaskGetActivities(t.ID, ctx)
+		if err != nil {
+			return Reminder{}, false, fmt.Errorf("task %d activities: %w", t.ID, err)
+		}
+		if len(as) > 0 {
+			return Reminder{}, false, nil
+		}
+		title = "Not started, " + strings.ToLower(title[:1]) + title[1:]
+	}
+	body := fmt.Sprintf("%s %s", what, e.format(*when))
+	if t.Description != "" {
+		body += "\n\n" + t.Description
+	}
+	return Reminder{Rule: rule, Time: when.Add(-rule.Lead), Title: title, Body: body, Task: &t}, true, nil
+}
+
+func (e *Engine) format(t time.Time) string {
+	return t.In(e.Location).Format("Mon 2006-01-02 15:04")
+}
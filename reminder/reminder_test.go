@@ -0,0 +1,264 @@
+package reminder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/storage"
+	"nyiyui.ca/jks/webhook"
+)
+
+func TestDue(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(24 * time.Hour)
+	idleID, err := st.TaskAdd(storage.Task{QuickTitle: "idle", Due: &due}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startedID, err := st.TaskAdd(storage.Task{QuickTitle: "started", Due: &due}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.ActivityAdd(storage.Activity{TaskID: startedID, TimeStart: now.Add(-2 * time.Hour), TimeEnd: now.Add(-time.Hour)}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doneID, err := st.TaskAdd(storage.Task{QuickTitle: "done", Due: &due}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.ActivityAdd(storage.Activity{TaskID: doneID, TimeStart: now.Add(-2 * time.Hour), TimeEnd: now.Add(-time.Hour), Done: true}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.PlanAdd(storage.Plan{TaskID: idleID, TimeAtAfter: now.Add(10 * time.Minute), TimeBefore: now.Add(2 * time.Hour)}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine(st, []Rule{{KindDue, 24 * time.Hour}, {KindIdle, 24 * time.Hour}, {KindPlan, 10 * time.Minute}}, nil)
+	rs, err := e.Due(now.Add(-time.Minute), now, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, r := range rs {
+		got[r.Rule.String()+" "+r.Task.QuickTitle] = true
+	}
+	want := map[string]bool{
+		"due:24h0m0s idle":    true,
+		"due:24h0m0s started": true,
+		"idle:24h0m0s idle":   true,
+		"plan:10m0s idle":     true,
+	}
+	if len(got) != len(want) || len(rs) != len(want) {
+		t.Fatalf("got %v", got)
+	}
+	for k := range want {
+		if !got[k] {
+			t.Fatalf("missing %q; got %v", k, got)
+		}
+	}
+
+	rs, err = e.Due(now, now.Add(time.Minute), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 0 {
+		t.Fatalf("reminders sent twice: %v", rs)
+	}
+}
+
+// notifierFunc is a Notifier that calls itself.
+type notifierFunc func(r Reminder, ctx context.Context) error
+
+func (f notifierFunc) Notify(r Reminder, ctx context.Context) error { return f(r, ctx) }
+
+func TestRemindOwners(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, owner := range []string{"", "bob", "carol"} {
+		_, err := st.TaskAdd(storage.Task{QuickTitle: "essay of " + owner, Due: &now}, storage.WithOwner(ctx, owner))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := map[string][]string{}
+	record := func(to string) Notifier {
+		return notifierFunc(func(r Reminder, ctx context.Context) error {
+			got[to] = append(got[to], r.Title+" "+r.Body)
+			return nil
+		})
+	}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	e := NewEngine(st, []Rule{{Kind: KindDue}}, []Notifier{record("main")})
+	e.Location = time.UTC
+	e.Owners = func(ctx context.Context) ([]string, error) { return []string{"", "bob", "carol"}, nil }
+	e.Recipient = func(ctx context.Context) ([]Notifier, *time.Location, bool, error) {
+		switch storage.Owner(ctx) {
+		case "bob":
+			return []Notifier{record("bob")}, tokyo, true, nil
+		case "carol":
+			return nil, nil, true, nil
+		}
+		return nil, nil, false, nil
+	}
+	e.remindOwners(now.Add(-time.Minute), now, ctx)
+	if len(got) != 2 ||
+		len(got["main"]) != 1 || got["main"][0] != "Due now: essay of  Due Wed 2025-01-01 12:00" ||
+		len(got["bob"]) != 1 || got["bob"][0] != "Due now: essay of bob Due Wed 2025-01-01 21:00" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("due:24h")
+	if err != nil || r != (Rule{KindDue, 24 * time.Hour}) {
+		t.Fatal(r, err)
+	}
+	r, err = ParseRule("plan")
+	if err != nil || r != (Rule{KindPlan, 0}) {
+		t.Fatal(r, err)
+	}
+	for _, s := range []string{"due:-1h", "soon:1h", "due:1"} {
+		_, err = ParseRule(s)
+		if err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+var testReminder = Reminder{
+	Rule:  Rule{KindDue, time.Hour},
+	Title: "Due in 1h0m0s: essay",
+	Body:  "Due Wed 2025-01-01 13:00",
+	Task:  &storage.Task{ID: 1, QuickTitle: "essay"},
+}
+
+func TestNtfy(t *testing.T) {
+	var title, auth, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title, auth = r.Header.Get("Title"), r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer srv.Close()
+	n, err := ParseNotifier("ntfy+" + srv.URL + "/jks?token=tk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Notify(testReminder, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != testReminder.Title || auth != "Bearer tk" || body != testReminder.Body {
+		t.Fatalf("title=%q auth=%q body=%q", title, auth, body)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got Reminder
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Jks-Signature") != webhook.Sign("s3cret", b) {
+			t.Error("bad signature")
+		}
+		err := json.Unmarshal(b, &got)
+		if err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	n, err := ParseNotifier("webhook+" + srv.URL + "?secret=s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Notify(testReminder, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rule != testReminder.Rule || got.Title != testReminder.Title || got.Task == nil || got.Task.QuickTitle != "essay" {
+		t.Fatalf("got %#v", got)
+	}
+}
+
+// fakeSMTP accepts one message and sends its DATA on the returned channel.
+func fakeSMTP(t *testing.T) (addr string, data <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		reply := func(s string) { io.WriteString(c, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var b strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					b.WriteString(line)
+				}
+				ch <- b.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestSMTP(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	n, err := ParseNotifier("smtp://" + addr + "?from=jks@example.com&to=me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Notify(testReminder, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-data
+	if !strings.Contains(msg, "Subject: "+testReminder.Title) || !strings.Contains(msg, "To: me@example.com") || !strings.Contains(msg, testReminder.Body) {
+		t.Fatalf("message:\n%s", msg)
+	}
+}
@@ -0,0 +1,446 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/api"
+	"nyiyui.ca/jks/auth"
+	"nyiyui.ca/jks/quickcapture"
+	"nyiyui.ca/jks/storage"
+)
+
+// The JSON API is under /api/; see package api for the bodies.
+
+// apiLogin authenticates with an API token (Authorization: Bearer jks_...), or else with the login session like mainLogin.
+// The X-Jks-Timezone header sets the time zone for times given without one (e.g. in quick capture), instead of the account's.
+func (s *Server) apiLogin(next http.Handler) http.Handler {
+	// applied after logging in, so that it overrides the account's time zone
+	next = apiTimezone(next)
+	session := s.mainLogin(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			session.ServeHTTP(w, r)
+			return
+		}
+		t, ok, err := s.st.TokenByHash(storage.HashToken(token), r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			apiError(w, 500, "storage error")
+			return
+		}
+		if !ok {
+			apiError(w, 401, "invalid token")
+			return
+		}
+		name := s.nameOf(t.Owner)
+		u, ok, err := s.account(name, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			apiError(w, 500, "storage error")
+			return
+		}
+		if !ok || !u.Approved {
+			apiError(w, 403, "the token's user is not approved")
+			return
+		}
+		ctx, err := s.withAccount(u, r.Context())
+		if err != nil {
+			apiError(w, 500, err.Error())
+			return
+		}
+		r = r.WithContext(ctx)
+		err = s.st.TokenUsed(t.ID, time.Now(), r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+		}
+		data := auth.User{Login: name}
+		r = r.WithContext(context.WithValue(r.Context(), LoginUserDataKey, data))
+		r = r.WithContext(storage.WithAuthor(r.Context(), fmt.Sprintf("%s (token %s)", name, t.Name)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiTimezone sets the time zone from the X-Jks-Timezone header, if given.
+func apiTimezone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tz := r.Header.Get("X-Jks-Timezone"); tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				apiError(w, 422, fmt.Sprintf("invalid timezone: %s", tz))
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), TimeLocationKey, loc))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("json encode: %s", err)
+	}
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, api.Error{Error: msg})
+}
+
+func apiStorageError(w http.ResponseWriter, err error) {
+	log.Printf("storage: %s", err)
+	apiError(w, 500, "storage error")
+}
+
+func readJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding JSON body: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) activityJSON(a storage.Activity, ctx context.Context) (api.Activity, error) {
+	t, err := s.st.TaskGet(a.TaskID, ctx)
+	if err != nil {
+		return api.Activity{}, err
+	}
+	return api.Activity{Activity: a, Task: t}, nil
+}
+
+// apiTasks returns undone tasks, matching q if given.
+func (s *Server) apiTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			apiError(w, 422, "limit must be a positive int")
+			return
+		}
+	}
+	query := ""
+	if v := q.Get("q"); v != "" {
+		query = "%" + v + "%"
+	}
+	tsw, err := s.st.TaskSearch(query, time.Now(), r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	defer tsw.Close()
+	ts, err := tsw.Get(limit, 0)
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	writeJSON(w, 200, ts)
+}
+
+func (s *Server) apiTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		apiError(w, 422, "id must be int")
+		return
+	}
+	t, err := s.st.TaskGet(id, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	tags, err := s.st.TaskTags(id, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	writeJSON(w, 200, api.Task{Task: t, Tags: tags})
+}
+
+func (s *Server) apiTaskAdd(w http.ResponseWriter, r *http.Request) {
+	var t api.Task
+	err := readJSON(r, &t)
+	if err != nil {
+		apiError(w, 400, err.Error())
+		return
+	}
+	if t.QuickTitle == "" {
+		apiError(w, 422, "QuickTitle is required")
+		return
+	}
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		t.ID, err = st.TaskAdd(t.Task, r.Context())
+		if err != nil {
+			return err
+		}
+		t.Version = 1
+		return st.TaskSetTags(t.ID, t.Tags, r.Context())
+	})
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	writeJSON(w, 201, t)
+}
+
+func (s *Server) apiQuick(w http.ResponseWriter, r *http.Request) {
+	var req api.QuickRequest
+	err := readJSON(r, &req)
+	if err != nil {
+		apiError(w, 400, err.Error())
+		return
+	}
+	res, err := quickcapture.Parse(req.Text, time.Now().Truncate(time.Second), getTimeLocation(r))
+	if err != nil {
+		apiError(w, 422, err.Error())
+		return
+	}
+	if req.Preview {
+		writeJSON(w, 200, res)
+		return
+	}
+	err = s.quickSave(&res, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	writeJSON(w, 201, res)
+}
+
+// parseRange parses the from and to query parameters, which are RFC 3339 times.
+func parseRange(r *http.Request) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	from, err = time.Parse(time.RFC3339, q.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be an RFC 3339 time")
+	}
+	to, err = time.Parse(time.RFC3339, q.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be an RFC 3339 time")
+	}
+	return from, to, nil
+}
+
+// apiActivities returns the activities in [from, to).
+func (s *Server) apiActivities(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseRange(r)
+	if err != nil {
+		apiError(w, 422, err.Error())
+		return
+	}
+	_, as, _, err := s.st.Range(from, to, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	res := make([]api.Activity, len(as))
+	for i, a := range as {
+		res[i], err = s.activityJSON(a, r.Context())
+		if err != nil {
+			apiStorageError(w, err)
+			return
+		}
+	}
+	writeJSON(w, 200, res)
+}
+
+// apiRange returns the activities and plans in [from, to), like the day view.
+func (s *Server) apiRange(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseRange(r)
+	if err != nil {
+		apiError(w, 422, err.Error())
+		return
+	}
+	ts, as, ps, err := s.st.Range(from, to, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	writeJSON(w, 200, api.Range{Tasks: ts, Activities: as, Plans: ps})
+}
+
+// runningActivities returns the activities that have started and not yet ended.
+func runningActivities(st storage.Storage, now time.Time, ctx context.Context) ([]storage.Activity, error) {
+	as, err := st.ActivityLatestN(ctx, 10)
+	if err != nil {
+		return nil, err
+	}
+	var running []storage.Activity
+	for _, a := range as {
+		if !a.TimeStart.After(now) && a.TimeEnd.After(now) {
+			running = append(running, a)
+		}
+	}
+	return running, nil
+}
+
+func (s *Server) apiCurrent(w http.ResponseWriter, r *http.Request) {
+	as, err := runningActivities(s.st, time.Now(), r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	res := make([]api.Activity, len(as))
+	for i, a := range as {
+		res[i], err = s.activityJSON(a, r.Context())
+		if err != nil {
+			apiStorageError(w, err)
+			return
+		}
+	}
+	writeJSON(w, 200, res)
+}
+
+func (s *Server) apiActivityAdd(w http.ResponseWriter, r *http.Request) {
+	var a storage.Activity
+	err := readJSON(r, &a)
+	if err != nil {
+		apiError(w, 400, err.Error())
+		return
+	}
+	if !a.TimeEnd.After(a.TimeStart) {
+		apiError(w, 422, "TimeEnd must be after TimeStart")
+		return
+	}
+	a.ID = 0
+	a.ID, err = s.st.ActivityAdd(a, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	a.Version = 1
+	res, err := s.activityJSON(a, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	writeJSON(w, 201, res)
+}
+
+// stopRunning ends the running activities at now.
+func stopRunning(st storage.Storage, now time.Time, done bool, ctx context.Context) ([]storage.Activity, error) {
+	as, err := runningActivities(st, now, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range as {
+		as[i].TimeEnd = now
+		as[i].Done = as[i].Done || done
+		err = st.ActivityEdit(as[i], ctx)
+		if err != nil {
+			return nil, err
+		}
+		as[i].Version++
+	}
+	return as, nil
+}
+
+var errPlanTask = errors.New("plan is not for the task")
+
+// apiStart stops the running activities, and starts one for the task.
+func (s *Server) apiStart(w http.ResponseWriter, r *http.Request) {
+	var req api.StartRequest
+	err := readJSON(r, &req)
+	if err != nil {
+		apiError(w, 400, err.Error())
+		return
+	}
+	if req.For <= 0 {
+		apiError(w, 422, "For must be positive")
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	var stopped []storage.Activity
+	a := storage.Activity{TaskID: req.TaskID, Location: req.Location, Note: req.Note, TimeStart: now, TimeEnd: now.Add(req.For)}
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		_, err := st.TaskGet(req.TaskID, r.Context())
+		if err != nil {
+			return err
+		}
+		stopped, err = stopRunning(st, now, false, r.Context())
+		if err != nil {
+			return err
+		}
+		a.ID, err = st.ActivityAdd(a, r.Context())
+		if err != nil {
+			return err
+		}
+		a.Version = 1
+		if req.PlanID == 0 {
+			return nil
+		}
+		p, err := st.PlanGet(req.PlanID, r.Context())
+		if err != nil {
+			return err
+		}
+		if p.TaskID != req.TaskID {
+			return errPlanTask
+		}
+		p.ActivityID = a.ID
+		return st.PlanEdit(p, r.Context())
+	})
+	if err == errPlanTask {
+		apiError(w, 422, err.Error())
+		return
+	}
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	var res api.StartResponse
+	for _, a := range stopped {
+		a2, err := s.activityJSON(a, r.Context())
+		if err != nil {
+			apiStorageError(w, err)
+			return
+		}
+		res.Stopped = append(res.Stopped, a2)
+	}
+	started, err := s.activityJSON(a, r.Context())
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	res.Started = &started
+	writeJSON(w, 201, res)
+}
+
+func (s *Server) apiStop(w http.ResponseWriter, r *http.Request) {
+	var req api.StopRequest
+	err := readJSON(r, &req)
+	if err != nil {
+		apiError(w, 400, err.Error())
+		return
+	}
+	var stopped []storage.Activity
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		stopped, err = stopRunning(st, time.Now().Truncate(time.Second), req.Done, r.Context())
+		return err
+	})
+	if err != nil {
+		apiStorageError(w, err)
+		return
+	}
+	res := api.StartResponse{Stopped: []api.Activity{}}
+	for _, a := range stopped {
+		a2, err := s.activityJSON(a, r.Context())
+		if err != nil {
+			apiStorageError(w, err)
+			return
+		}
+		res.Stopped = append(res.Stopped, a2)
+	}
+	writeJSON(w, 200, res)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"nyiyui.ca/jks/database"
+)
+
+type backupConfig struct {
+	db        *sqlx.DB
+	dir       string
+	retention database.Retention
+}
+
+// SetupBackup enables POST /admin/backup, which writes a snapshot of db into dir and rotates snapshots according to retention.
+func (s *Server) SetupBackup(db *sqlx.DB, dir string, retention database.Retention) {
+	s.backup = &backupConfig{db, dir, retention}
+}
+
+func (s *Server) snapshot(ctx context.Context) (path string, err error) {
+	path, err = database.Snapshot(ctx, s.backup.db, s.backup.dir)
+	if err != nil {
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+	deleted, err := database.RotateSnapshots(s.backup.dir, s.backup.retention)
+	if err != nil {
+		return path, fmt.Errorf("rotate: %w", err)
+	}
+	for _, deletedPath := range deleted {
+		log.Printf("backup: deleted snapshot %s", deletedPath)
+	}
+	return path, nil
+}
+
+// RunBackups writes a snapshot every interval until ctx is done.
+// SetupBackup must be called first.
+func (s *Server) RunBackups(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := s.snapshot(ctx)
+			if err != nil {
+				log.Printf("backup: %s", err)
+				continue
+			}
+			log.Printf("backup: wrote snapshot %s", path)
+		}
+	}
+}
+
+func (s *Server) adminBackup(w http.ResponseWriter, r *http.Request) {
+	if s.backup == nil {
+		http.Error(w, "backups are not configured", 404)
+		return
+	}
+	path, err := s.snapshot(r.Context())
+	if err != nil {
+		log.Printf("backup: %s", err)
+		http.Error(w, "backup error", 500)
+		return
+	}
+	http.Error(w, fmt.Sprintf("wrote snapshot %s", path), 200)
+}
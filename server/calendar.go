@@ -0,0 +1,199 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/recurrence"
+	"nyiyui.ca/jks/storage"
+)
+
+// parseCalendar parses the form of calendar.html, including the ranges of an uploaded ICS file.
+func parseCalendar(r *http.Request) (storage.Calendar, error) {
+	c := storage.Calendar{Name: r.PostForm.Get("Name")}
+	if c.Name == "" {
+		return c, fmt.Errorf("name is required")
+	}
+	var err error
+	c.Ranges, err = recurrence.ParseRanges(strings.ReplaceAll(r.PostForm.Get("Ranges"), "\r\n", "\n"))
+	if err != nil {
+		return c, fmt.Errorf("ranges: %w", err)
+	}
+	f, _, err := r.FormFile("ICS")
+	if err == http.ErrMissingFile {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("ICS file: %w", err)
+	}
+	defer f.Close()
+	_, ranges, err := recurrence.ReadICS(f)
+	if err != nil {
+		return c, fmt.Errorf("ICS file: %w", err)
+	}
+	c.Ranges = append(c.Ranges, ranges...)
+	return c, nil
+}
+
+// calendarPreview is an active recurrence that uses a calendar being edited, and what saving the calendar does to its occurrences.
+type calendarPreview struct {
+	Recurrence  storage.Recurrence
+	Occurrences []occurrencePreview
+}
+
+// errPreview rolls back the transaction of a previewed edit.
+var errPreview = errors.New("preview")
+
+// renderCalendar renders calendar.html; previews is nil unless the Preview button was pressed.
+func (s *Server) renderCalendar(w http.ResponseWriter, r *http.Request, c storage.Calendar, previews []calendarPreview, formErr error) {
+	ranges := make([]string, len(c.Ranges))
+	for i, dr := range c.Ranges {
+		ranges[i] = recurrence.FormatRange(dr)
+	}
+	data := map[string]interface{}{
+		"calendar": c,
+		"ranges":   strings.Join(ranges, "\n"),
+		"previews": previews,
+		"preview":  previews != nil,
+		"horizon":  s.recurrences.Horizon,
+	}
+	if formErr != nil {
+		data["error"] = formErr.Error()
+		w.WriteHeader(422)
+	}
+	s.renderTemplate("calendar.html", w, r, data)
+}
+
+func (s *Server) calendarList(w http.ResponseWriter, r *http.Request) {
+	cs, err := s.st.Calendars(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTemplate("calendars.html", w, r, map[string]interface{}{
+		"calendars": cs,
+	})
+}
+
+func (s *Server) calendarNew(w http.ResponseWriter, r *http.Request) {
+	s.renderCalendar(w, r, storage.Calendar{}, nil, nil)
+}
+
+func (s *Server) calendarNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	c, err := parseCalendar(r)
+	if err != nil {
+		s.renderCalendar(w, r, c, nil, err)
+		return
+	}
+	id, err := s.st.CalendarAdd(c, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/calendar/%d", id), 302)
+}
+
+func (s *Server) calendarView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	c, err := s.st.CalendarGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderCalendar(w, r, c, nil, nil)
+}
+
+// calendarEditPost saves the calendar, and reconciles the active recurrences that refer to it, so that occurrences in added ranges are removed (and those in removed ranges added).
+// If the Preview button was pressed, nothing is saved, and what saving would do to the occurrences is shown instead.
+func (s *Server) calendarEditPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	c, err := parseCalendar(r)
+	c.ID = id
+	if err != nil {
+		s.renderCalendar(w, r, c, nil, err)
+		return
+	}
+	preview := r.PostForm.Has("Preview")
+	previews := []calendarPreview{}
+	now := time.Now()
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		err := st.CalendarEdit(c, r.Context())
+		if err != nil {
+			return err
+		}
+		rs, err := st.Recurrences(r.Context())
+		if err != nil {
+			return err
+		}
+		// the recurrences are reconciled against the edited calendar, which is only visible in this transaction
+		sch := s.recurrences.In(st)
+		for _, rec := range rs {
+			if !rec.Active || !slices.Contains(rec.CalendarIDs, id) {
+				continue
+			}
+			changes, err := sch.Reconcile(rec, now, preview, r.Context())
+			if err != nil {
+				return fmt.Errorf("recurrence %d: %w", rec.ID, err)
+			}
+			ps := occurrencePreviews(rec, changes)
+			ps = slices.DeleteFunc(ps, func(p occurrencePreview) bool { return p.Action == "" })
+			previews = append(previews, calendarPreview{Recurrence: rec, Occurrences: ps})
+		}
+		if preview {
+			return errPreview
+		}
+		return nil
+	})
+	if err == errPreview {
+		s.renderCalendar(w, r, c, previews, nil)
+		return
+	}
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/calendar/%d", id), 302)
+}
+
+func (s *Server) calendarDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = s.st.CalendarDelete(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/calendars", 302)
+}
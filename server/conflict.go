@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+	"nyiyui.ca/jks/storage"
+)
+
+// conflictField is one field of the edit form shown on the conflict page.
+type conflictField struct {
+	Name string
+	// Input is Name, for use as the name attribute of inputs.
+	Input safehtml.Identifier
+	// Mine is the submitted value and Theirs is the stored value, both formatted as form values.
+	Mine   string
+	Theirs string
+	Same   bool
+}
+
+// conflictFields compares the submitted and stored versions of a row field by field.
+// Fields named in skip (e.g. ones not in the edit form) are left out, as are ID and Version.
+func conflictFields[T any](mine, theirs T, loc *time.Location, skip ...string) []conflictField {
+	vm := reflect.ValueOf(mine)
+	vt := reflect.ValueOf(theirs)
+	changed := storage.ChangedFields(mine, theirs)
+	var fields []conflictField
+	for i := 0; i < vm.NumField(); i++ {
+		name := vm.Type().Field(i).Name
+		if !vm.Type().Field(i).IsExported() || name == "ID" || name == "Version" || slices.Contains(skip, name) {
+			continue
+		}
+		fields = append(fields, conflictField{
+			Name:   name,
+			Input:  uncheckedconversions.IdentifierFromStringKnownToSatisfyTypeContract(name),
+			Mine:   formValue(vm.Field(i), loc),
+			Theirs: formValue(vt.Field(i), loc),
+			Same:   !slices.Contains(changed, name),
+		})
+	}
+	return fields
+}
+
+// formValue formats v as newDecoder expects it in a form.
+func formValue(v reflect.Value, loc *time.Location) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v := v.Interface().(type) {
+	case time.Time:
+		return v.In(loc).Format("2006-01-02T15:04")
+	case time.Duration:
+		return v.String()
+	case bool:
+		if v {
+			return "on"
+		}
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// renderConflict shows a stale edit next to the stored row, so that the user can pick each field's value and submit the edit again.
+func (s *Server) renderConflict(w http.ResponseWriter, r *http.Request, entity string, id int64, version int64, fields []conflictField) {
+	w.WriteHeader(409)
+	s.renderTemplate("conflict.html", w, r, map[string]interface{}{
+		"entity":   entity,
+		"entityID": id,
+		"action":   fmt.Sprintf("/%s/%d/edit", entityPaths[entity], id),
+		"view":     fmt.Sprintf("/%s/%d", entityPaths[entity], id),
+		"version":  version,
+		"fields":   fields,
+	})
+}
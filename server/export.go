@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"nyiyui.ca/jks/export"
+)
+
+// exportGet shows the export form, or (given a format) downloads the export.
+// from and to are dates (the range includes to) or RFC 3339 times, and tag limits the export to tasks with the tag.
+func (s *Server) exportGet(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("format") == "" {
+		s.renderTemplate("export.html", w, r, map[string]interface{}{
+			"formats": export.FormatNames(),
+		})
+		return
+	}
+	s.exportDownload(w, r)
+}
+
+func (s *Server) exportDownload(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	loc := getTimeLocation(r)
+	format, ok := export.Formats[q.Get("format")]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q", q.Get("format")), 422)
+		return
+	}
+	var f export.Filter
+	var err error
+	f.From, err = export.ParseBound(q.Get("from"), loc, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("from: %s", err), 422)
+		return
+	}
+	f.To, err = export.ParseBound(q.Get("to"), loc, true)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("to: %s", err), 422)
+		return
+	}
+	f.Tag = q.Get("tag")
+	ds, err := export.Gather(s.st, f, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	name := fmt.Sprintf("jks-%s-%s%s", q.Get("format"), time.Now().In(loc).Format("20060102"), format.Extension)
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	err = format.Write(w, ds, loc)
+	if err != nil {
+		log.Printf("export: %s", err)
+	}
+}
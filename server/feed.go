@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nyiyui.ca/jks/changefeed"
+	"nyiyui.ca/jks/storage"
+)
+
+// feedKeep is the number of recent changes kept for clients resuming the change feed.
+const feedKeep = 1000
+
+// feedHeartbeat is how often an idle change feed sends a comment, so that proxies do not time it out.
+const feedHeartbeat = 30 * time.Second
+
+// changeFeed streams changes as Server-Sent Events, one "change" event per changefeed.Event with its Seq as the event ID.
+// Clients resume with the Last-Event-ID header (which EventSource sends when reconnecting) or the after query parameter.
+// If changes since then are no longer kept, a "reset" event is sent first, and the client should reload everything.
+// Only the changes of the user's own rows are sent.
+func (s *Server) changeFeed(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", 500)
+		return
+	}
+	after := int64(-1)
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("after")
+	}
+	if resume != "" {
+		var err error
+		after, err = strconv.ParseInt(resume, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID and after must be int", 422)
+			return
+		}
+	}
+	owner := storage.Owner(r.Context())
+	backlog, complete, ch, cancel := s.feed.Subscribe(after)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	if !complete {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", s.feed.Seq())
+	}
+	for _, e := range backlog {
+		if e.Owner != owner {
+			continue
+		}
+		if !writeChange(w, e) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				// dropped for falling behind; the client reconnects with Last-Event-ID
+				return
+			}
+			if e.Owner != owner {
+				continue
+			}
+			if !writeChange(w, e) {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeChange(w http.ResponseWriter, e changefeed.Event) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("change feed: marshal: %s", err)
+		return false
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", e.Seq, data)
+	return err == nil
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"nyiyui.ca/jks/auth"
+	"nyiyui.ca/jks/storage"
+)
+
+type accessKey struct{}
+
+// access returns the most access any of the grants gives to the task, or "" if none do.
+// ctx must be scoped to the owner of the grants, as the task's tags are checked against tag grants.
+func (s *Server) access(gs []storage.Grant, taskID int64, ctx context.Context) (storage.Access, error) {
+	var a storage.Access
+	var tags []string
+	for _, g := range gs {
+		if a.Allows(g.Access) {
+			continue
+		}
+		if g.TaskID != 0 {
+			if g.TaskID == taskID {
+				a = g.Access
+			}
+			continue
+		}
+		if tags == nil {
+			var err error
+			tags, err = s.st.TaskTags(taskID, ctx)
+			if err != nil {
+				return "", err
+			}
+		}
+		if slices.Contains(tags, g.Tag) {
+			a = g.Access
+		}
+	}
+	return a, nil
+}
+
+// requireGrant requires the user set by mainLogin to have been granted at least access to the task {id} of the user {owner}.
+// Storage is scoped to the owner's rows; revisions are still authored by the user.
+func (s *Server) requireGrant(access storage.Access) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := r.Context().Value(LoginUserDataKey).(auth.User)
+			id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "id must be int", 422)
+				return
+			}
+			owner := s.ownerOf(r.PathValue("owner"))
+			gs, err := s.st.GrantsTo(user.Name(), r.Context())
+			if err != nil {
+				log.Printf("storage: %s", err)
+				http.Error(w, "storage error", 500)
+				return
+			}
+			gs = slices.DeleteFunc(gs, func(g storage.Grant) bool { return g.Owner != owner })
+			ctx := storage.WithOwner(r.Context(), owner)
+			a, err := s.access(gs, id, ctx)
+			if err != nil {
+				log.Printf("storage: %s", err)
+				http.Error(w, "storage error", 500)
+				return
+			}
+			if !a.Allows(access) {
+				http.Error(w, "this task is not shared with you", 403)
+				return
+			}
+			ctx = context.WithValue(ctx, accessKey{}, a)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (s *Server) grantList(w http.ResponseWriter, r *http.Request) {
+	gs, err := s.st.Grants(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	titles := make([]string, len(gs))
+	for i, g := range gs {
+		if g.TaskID == 0 {
+			continue
+		}
+		t, err := s.st.TaskGet(g.TaskID, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		titles[i] = t.QuickTitle
+	}
+	s.renderTemplate("grants.html", w, r, map[string]interface{}{
+		"grants": gs,
+		"titles": titles,
+		"task":   r.URL.Query().Get("task"),
+	})
+}
+
+// grantNewPost shares a task (TaskID) or the tasks with a tag (Tag) with another user.
+func (s *Server) grantNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	g := storage.Grant{
+		Grantee: r.PostForm.Get("Grantee"),
+		Tag:     r.PostForm.Get("Tag"),
+		Access:  storage.Access(r.PostForm.Get("Access")),
+		Created: time.Now(),
+	}
+	if taskID := r.PostForm.Get("TaskID"); taskID != "" {
+		g.TaskID, err = strconv.ParseInt(taskID, 10, 64)
+		if err != nil {
+			http.Error(w, "TaskID must be int or \"\"", 422)
+			return
+		}
+	}
+	if (g.TaskID == 0) == (g.Tag == "") {
+		http.Error(w, "exactly one of task and tag is required", 422)
+		return
+	}
+	if g.Access != storage.AccessRead && g.Access != storage.AccessLog {
+		http.Error(w, fmt.Sprintf("invalid access: %s", g.Access), 422)
+		return
+	}
+	if g.Grantee == "" {
+		http.Error(w, "grantee is required", 422)
+		return
+	}
+	_, ok, err := s.account(g.Grantee, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	if !ok {
+		http.Error(w, "no such user", 422)
+		return
+	}
+	_, err = s.st.GrantAdd(g, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/grants", 302)
+}
+
+func (s *Server) grantDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = s.st.GrantDelete(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/grants", 302)
+}
+
+// sharedGrant is a grant to the user, with the tasks it shares.
+type sharedGrant struct {
+	storage.Grant
+	// OwnerName is the name of the user who shared the tasks.
+	OwnerName string
+	Tasks     []storage.Task
+}
+
+// shared shows the tasks other users shared with the user.
+func (s *Server) shared(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(LoginUserDataKey).(auth.User)
+	gs, err := s.st.GrantsTo(user.Name(), r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	sgs := make([]sharedGrant, len(gs))
+	for i, g := range gs {
+		ctx := storage.WithOwner(r.Context(), g.Owner)
+		sgs[i] = sharedGrant{Grant: g, OwnerName: s.nameOf(g.Owner)}
+		if g.TaskID != 0 {
+			t, err := s.st.TaskGet(g.TaskID, ctx)
+			if err != nil {
+				log.Printf("storage: %s", err)
+				http.Error(w, "storage error", 500)
+				return
+			}
+			sgs[i].Tasks = []storage.Task{t}
+		} else {
+			sgs[i].Tasks, err = s.st.TagTasks(g.Tag, ctx)
+			if err != nil {
+				log.Printf("storage: %s", err)
+				http.Error(w, "storage error", 500)
+				return
+			}
+		}
+	}
+	s.renderTemplate("shared.html", w, r, map[string]interface{}{
+		"grants": sgs,
+	})
+}
+
+// sharedTask shows a task shared with the user and its activities; see requireGrant.
+func (s *Server) sharedTask(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	t, err := s.st.TaskGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	as, err := s.st.TaskGetActivities(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	slices.SortFunc(as, func(a, b storage.Activity) int { return b.TimeStart.Compare(a.TimeStart) })
+	var totalSpent time.Duration
+	for _, a := range as {
+		totalSpent += a.TimeEnd.Sub(a.TimeStart)
+	}
+	s.renderTemplate("shared-task.html", w, r, map[string]interface{}{
+		"owner":      r.PathValue("owner"),
+		"task":       t,
+		"activities": as,
+		"totalSpent": totalSpent,
+		"canLog":     r.Context().Value(accessKey{}).(storage.Access).Allows(storage.AccessLog),
+	})
+}
+
+// sharedTaskActivityNewPost logs an activity on a task shared with the user; see requireGrant.
+// Only the owner can mark the task as done.
+func (s *Server) sharedTaskActivityNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	t, err := s.st.TaskGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	var a storage.Activity
+	decoder := newDecoder(r)
+	err = decoder.Decode(&a, r.PostForm)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("form data decode failed: %s", err), 422)
+		return
+	}
+	if t.Deadline != nil && (a.TimeStart.After(*t.Deadline) || a.TimeEnd.After(*t.Deadline)) {
+		http.Error(w, "activity cannot be after deadline", 422)
+		return
+	}
+	a.ID = 0
+	a.Version = 0
+	a.TaskID = id
+	a.Done = false
+	_, err = s.st.ActivityAdd(a, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/shared/%s/task/%d", url.PathEscape(r.PathValue("owner")), id), 302)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// entityPaths maps storage entity names to the path prefix of their history.
+var entityPaths = map[string]string{
+	storage.EntityTask:     "task",
+	storage.EntityActivity: "activity",
+	storage.EntityPlan:     "plan",
+}
+
+// entityURL returns the URL of the view of the entity of the revisions (newest first).
+// Plans have no view of their own, so they link to their task's.
+func entityURL(entity string, id int64, rs []storage.Revision) (string, error) {
+	if entity != storage.EntityPlan {
+		return fmt.Sprintf("/%s/%d", entityPaths[entity], id), nil
+	}
+	if len(rs) == 0 {
+		return "", nil
+	}
+	raw := rs[0].After
+	if len(raw) == 0 {
+		raw = rs[0].Before
+	}
+	var p storage.Plan
+	err := json.Unmarshal(raw, &p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/task/%d", p.TaskID), nil
+}
+
+// deleted returns whether the newest of the revisions deleted the entity.
+func deleted(rs []storage.Revision) bool {
+	return len(rs) != 0 && len(rs[0].After) == 0
+}
+
+func (s *Server) makeHistory(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be int", 422)
+			return
+		}
+		rs, err := s.st.Revisions(entity, id, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		u, err := entityURL(entity, id, rs)
+		if err != nil {
+			log.Printf("revision: %s", err)
+			http.Error(w, "revision decode error", 500)
+			return
+		}
+		s.renderTemplate("history.html", w, r, map[string]interface{}{
+			"entity":    entity,
+			"entityID":  id,
+			"entityURL": u,
+			"deleted":   deleted(rs),
+			"revisions": rs,
+		})
+	}
+}
+
+// revisionRevert edits the entity of a revision back to how it was right after that revision.
+// The revert is itself recorded as a new revision, and overwrites the current version regardless of storage.ErrConflict.
+// Deleted entities cannot be reverted.
+func (s *Server) revisionRevert(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	rev, err := s.st.RevisionGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	rs, err := s.st.Revisions(rev.Entity, rev.EntityID, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	if deleted(rs) {
+		http.Error(w, fmt.Sprintf("%s %d was deleted", rev.Entity, rev.EntityID), 422)
+		return
+	}
+	switch rev.Entity {
+	case storage.EntityTask:
+		var t storage.Task
+		t, err = rev.AfterTask()
+		if err == nil {
+			t.ID = rev.EntityID
+			t.Version = 0
+			err = s.st.TaskEdit(t, r.Context())
+		}
+	case storage.EntityActivity:
+		var a storage.Activity
+		a, err = rev.AfterActivity()
+		if err == nil {
+			a.ID = rev.EntityID
+			a.Version = 0
+			err = s.st.ActivityEdit(a, r.Context())
+		}
+	case storage.EntityPlan:
+		var p storage.Plan
+		p, err = rev.AfterPlan()
+		if err == nil {
+			p.ID = rev.EntityID
+			p.Version = 0
+			err = s.st.PlanEdit(p, r.Context())
+		}
+	default:
+		err = fmt.Errorf("unknown entity %q", rev.Entity)
+	}
+	if err != nil {
+		log.Printf("revert revision %d: %s", id, err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/%s/%d/history", entityPaths[rev.Entity], rev.EntityID), 302)
+}
@@ -3,26 +3,33 @@ package server
 import (
 	"context"
 	"encoding/gob"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
+	"nyiyui.ca/jks/auth"
+	"nyiyui.ca/jks/reminder"
+	"nyiyui.ca/jks/storage"
 )
 
 type key struct{}
 
 // LoginUserDataKey is the key for the login user data in the request context.
-// When using mainLogin, this key will be set to the githubUserData struct.
+// When using mainLogin, this key will be set to the auth.User struct.
 var LoginUserDataKey key
 
 // TimeLocationKey is the key for the *time.Location in the request context.
 // When using mainLogin, this key will be set to the *time.Location set by the user.
+// Sessions from before timezones were stored in accounts may have a timezone, which is used until the user sets one.
 var TimeLocationKey = "timeLocation"
 
+// loginUserKey is the key of the auth.User in the login session.
+// It is named so as sessions had only GitHub users before there were other providers.
+const loginUserKey = "githubUserData"
+
 func getTimeLocation(r *http.Request) *time.Location {
 	loc, ok := r.Context().Value(TimeLocationKey).(*time.Location)
 	if !ok {
@@ -32,41 +39,33 @@ func getTimeLocation(r *http.Request) *time.Location {
 }
 
 func init() {
-	gob.RegisterName("githubUserData", githubUserData{})
+	// registered under the name of the type it replaced, so that existing sessions stay logged in
+	gob.RegisterName("githubUserData", auth.User{})
 }
 
-func (s *Server) mainLogin(next http.Handler) http.Handler {
-	return s.requireUser(s.mainUser, next)
+// AddLoginProvider adds a provider to log in with at /login/with/{name}; its redirect URL must be /login/callback.
+// Its name must not be that of a provider added before.
+// It must be called before serving.
+func (s *Server) AddLoginProvider(p auth.Provider) error {
+	if _, ok := s.loginProvider(p.Name()); ok {
+		return fmt.Errorf("a login provider named %q was already added", p.Name())
+	}
+	s.loginProviders = append(s.loginProviders, p)
+	return nil
 }
 
-func (s *Server) someLogin(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		loginSession, err := s.store.Get(r, "login")
-		if err != nil {
-			log.Printf("login session get: %s", err)
-			http.Error(w, "session failure", 400)
-			return
-		}
-		_, ok := loginSession.Values["githubUserData"]
-		if !ok {
-			http.Redirect(w, r, "/login", 302)
-			return
-		}
-		data := loginSession.Values["githubUserData"].(githubUserData)
-		if _, ok := loginSession.Values["timezone"]; ok {
-			tzName := loginSession.Values["timezone"].(string)
-			loc, err := time.LoadLocation(tzName)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("invalid timezone: %s", tzName), 500)
-				return
-			}
-			r = r.WithContext(context.WithValue(r.Context(), TimeLocationKey, loc))
-		}
-		r = r.WithContext(context.WithValue(r.Context(), LoginUserDataKey, data))
-		next.ServeHTTP(w, r)
-	})
+// SetupLocalLogin lets the local accounts log in with their passwords.
+// It must be called before serving.
+func (s *Server) SetupLocalLogin(l *auth.Local) {
+	s.localLogin = l
+}
+
+// mainLogin requires a user with an approved account; see requireAccount.
+func (s *Server) mainLogin(next http.Handler) http.Handler {
+	return s.requireUser("", s.requireAccount(false, next))
 }
 
+// requireUser requires the user's name (see auth.User.Name) to be user, or any logged-in user if user is empty.
 func (s *Server) requireUser(user string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		loginSession, err := s.store.Get(r, "login")
@@ -75,13 +74,12 @@ func (s *Server) requireUser(user string, next http.Handler) http.Handler {
 			http.Error(w, "session failure", 400)
 			return
 		}
-		_, ok := loginSession.Values["githubUserData"]
+		data, ok := loginSession.Values[loginUserKey].(auth.User)
 		if !ok {
 			http.Redirect(w, r, "/login", 302)
 			return
 		}
-		data := loginSession.Values["githubUserData"].(githubUserData)
-		if data.Login != user {
+		if user != "" && data.Name() != user {
 			http.Error(w, "unauthorized user", 401)
 			return
 		}
@@ -95,15 +93,57 @@ func (s *Server) requireUser(user string, next http.Handler) http.Handler {
 			r = r.WithContext(context.WithValue(r.Context(), TimeLocationKey, loc))
 		}
 		r = r.WithContext(context.WithValue(r.Context(), LoginUserDataKey, data))
+		r = r.WithContext(storage.WithAuthor(r.Context(), data.Name()))
 		next.ServeHTTP(w, r)
 	})
 }
 
+func (s *Server) loginProvider(name string) (auth.Provider, bool) {
+	for _, p := range s.loginProviders {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// login shows the ways to log in, or redirects to the only provider if there are no local accounts or passkeys.
 func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Query().Has("code") {
 		http.Error(w, "login page should not have query parameter `code' - make sure your redirect URI is set correctly.", 500)
 		return
 	}
+	if len(s.loginProviders) == 1 && s.localLogin == nil && s.passkeys == nil {
+		s.loginWith(w, r, s.loginProviders[0])
+		return
+	}
+	s.renderLogin(w, r, "")
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, loginErr string) {
+	data := map[string]interface{}{
+		"providers": s.loginProviders,
+		"local":     s.localLogin != nil,
+		"passkeys":  s.passkeys != nil,
+	}
+	if loginErr != "" {
+		data["error"] = loginErr
+		w.WriteHeader(401)
+	}
+	s.renderTemplate("login.html", w, r, data)
+}
+
+func (s *Server) loginProviderStart(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.loginProvider(r.PathValue("provider"))
+	if !ok {
+		http.Error(w, "no such login provider", 404)
+		return
+	}
+	s.loginWith(w, r, p)
+}
+
+// loginWith redirects to the provider, to come back to loginCallback.
+func (s *Server) loginWith(w http.ResponseWriter, r *http.Request, p auth.Provider) {
 	session, err := s.store.Get(r, "login-oauth2")
 	if err != nil {
 		log.Printf("session get: %s", err)
@@ -111,23 +151,20 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	verifier := oauth2.GenerateVerifier()
+	state := oauth2.GenerateVerifier()
 	session.Values["verifier"] = verifier
+	session.Values["state"] = state
+	session.Values["provider"] = p.Name()
 	err = session.Save(r, w)
 	if err != nil {
 		log.Printf("session save: %s", err)
 		http.Error(w, "session failure", 400)
 		return
 	}
-	url := s.oauthConfig.AuthCodeURL("", oauth2.S256ChallengeOption(verifier))
+	url := p.Config().AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
 	http.Redirect(w, r, url, 302)
 }
 
-type githubUserData struct {
-	Login     string `json:"login"`
-	AvatarURL string `json:"avatar_url"`
-	HTMLURL   string `json:"html_url"`
-}
-
 func (s *Server) loginCallback(w http.ResponseWriter, r *http.Request) {
 	session, err := s.store.Get(r, "login-oauth2")
 	if err != nil {
@@ -135,102 +172,143 @@ func (s *Server) loginCallback(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "session failure", 400)
 		return
 	}
-	loginSession, err := s.store.Get(r, "login")
-	if err != nil {
-		log.Printf("login session get: %s", err)
-		http.Error(w, "session failure", 400)
-		return
-	}
-
-	log.Printf("session: %s", session.Values)
 
-	_, ok := session.Values["verifier"]
+	verifier, ok := session.Values["verifier"].(string)
 	if !ok {
 		http.Error(w, "try logging in again", 400)
 		return
 	}
-
-	verifier := session.Values["verifier"].(string)
+	state, _ := session.Values["state"].(string)
+	providerName, _ := session.Values["provider"].(string)
 	delete(session.Values, "verifier")
+	delete(session.Values, "state")
+	delete(session.Values, "provider")
+	if r.URL.Query().Get("state") != state {
+		http.Error(w, "state mismatch; try logging in again", 400)
+		return
+	}
+	p, ok := s.loginProvider(providerName)
+	if !ok {
+		http.Error(w, "try logging in again", 400)
+		return
+	}
 	code := r.URL.Query().Get("code")
-	token, err := s.oauthConfig.Exchange(r.Context(), code, oauth2.VerifierOption(verifier))
+	token, err := p.Config().Exchange(r.Context(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	client := s.oauthConfig.Client(r.Context(), token)
-	resp, err := client.Get("https://api.github.com/user")
+	data, err := p.User(token, r.Context())
 	if err != nil {
-		http.Error(w, "failed to get user data from GitHub (request)", 500)
+		log.Printf("login with %s: %s", p.Name(), err)
+		http.Error(w, fmt.Sprintf("failed to get user data from %s", p.Name()), 500)
 		return
 	}
-	if resp.StatusCode != 200 {
-		http.Error(w, "failed to get user data from GitHub (response status code)", 500)
+	err = session.Save(r, w)
+	if err != nil {
+		log.Printf("session save: %s", err)
+		http.Error(w, "session failure", 400)
 		return
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "failed to get user data from GitHub (response body)", 500)
+	s.loggedIn(w, r, data)
+}
+
+func (s *Server) loginPasswordPost(w http.ResponseWriter, r *http.Request) {
+	if s.localLogin == nil {
+		http.Error(w, "local accounts are disabled", 404)
 		return
 	}
-	var data githubUserData
-	err = json.Unmarshal(body, &data)
+	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, "failed to get user data from GitHub (response json)", 500)
+		http.Error(w, "failed to parse form", 422)
 		return
 	}
-	loginSession.Values["githubUserData"] = data
-	err = session.Save(r, w)
+	data, ok := s.localLogin.Check(r.PostForm.Get("Login"), r.PostForm.Get("Password"))
+	if !ok {
+		s.renderLogin(w, r, "wrong login or password")
+		return
+	}
+	s.loggedIn(w, r, data)
+}
+
+// loggedIn saves the user to the login session.
+func (s *Server) loggedIn(w http.ResponseWriter, r *http.Request, data auth.User) {
+	loginSession, err := s.store.Get(r, "login")
 	if err != nil {
-		log.Printf("session save: %s", err)
+		log.Printf("login session get: %s", err)
 		http.Error(w, "session failure", 400)
 		return
 	}
+	loginSession.Values[loginUserKey] = data
 	err = loginSession.Save(r, w)
 	if err != nil {
 		log.Printf("login session save: %s", err)
 		http.Error(w, "session failure", 400)
 		return
 	}
-	http.Error(w, fmt.Sprintf("logged in as %s", data.Login), 200)
+	http.Error(w, fmt.Sprintf("logged in as %s", data.Name()), 200)
 }
 
+// loginSettings shows and saves the settings of the user's account.
 func (s *Server) loginSettings(w http.ResponseWriter, r *http.Request) {
-	loginSession, err := s.store.Get(r, "login")
-	if err != nil {
-		log.Printf("login session get: %s", err)
-		http.Error(w, "session failure", 400)
-		return
-	}
+	u := r.Context().Value(accountKey{}).(storage.User)
 	if r.Method == "POST" {
-		err = r.ParseForm()
+		err := r.ParseForm()
 		if err != nil {
 			http.Error(w, "failed to parse form", 422)
 			return
 		}
 		tzName := r.Form.Get("timezone")
-		_, err := time.LoadLocation(tzName)
+		loc, err := time.LoadLocation(tzName)
 		if err != nil {
 			http.Error(w, "invalid timezone", 422)
 			return
 		}
-		loginSession.Values["timezone"] = tzName
-		err = loginSession.Save(r, w)
+		u.Timezone = tzName
+		if s.reminders {
+			u.Notify = strings.Fields(r.Form.Get("notify"))
+			for _, n := range u.Notify {
+				_, err = reminder.ParseNotifier(n)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("invalid reminder destination: %s", err), 422)
+					return
+				}
+			}
+		}
+		_, stored, err := s.st.UserGet(u.Name, r.Context())
+		if err == nil && stored {
+			err = s.st.UserEdit(u, r.Context())
+		} else if err == nil {
+			// the main user's account is only stored once it has settings
+			u.Created = time.Now()
+			err = s.st.UserAdd(u, r.Context())
+		}
 		if err != nil {
-			log.Printf("login session save: %s", err)
-			http.Error(w, "session failure", 400)
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
 			return
 		}
+		r = r.WithContext(context.WithValue(r.Context(), TimeLocationKey, loc))
 	}
-	var tzName string
-	_, ok := loginSession.Values["timezone"]
-	if ok {
-		tzName = loginSession.Values["timezone"].(string)
-	} else {
-		tzName = ""
+	tzName := u.Timezone
+	if loc, ok := r.Context().Value(TimeLocationKey).(*time.Location); ok {
+		tzName = loc.String()
 	}
-	s.renderTemplate("login-settings.html", w, r, map[string]interface{}{
-		"timezone": tzName,
-	})
+	data := map[string]interface{}{
+		"timezone":  tzName,
+		"reminders": s.reminders,
+		"notify":    strings.Join(u.Notify, "\n"),
+	}
+	if s.passkeys != nil {
+		user := r.Context().Value(LoginUserDataKey).(auth.User)
+		ps, err := s.st.Passkeys(user.Provider, user.Login, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		data["passkeysEnabled"] = true
+		data["passkeys"] = ps
+	}
+	s.renderTemplate("login-settings.html", w, r, data)
 }
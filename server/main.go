@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,11 +20,14 @@ import (
 
 	"github.com/google/safehtml/template"
 
-	"nyiyui.ca/jks/database"
+	"nyiyui.ca/jks/auth"
+	"nyiyui.ca/jks/changefeed"
 	"nyiyui.ca/jks/layout"
 	"nyiyui.ca/jks/linkdata"
 	"nyiyui.ca/jks/rdf"
+	"nyiyui.ca/jks/recurrence"
 	"nyiyui.ca/jks/storage"
+	"nyiyui.ca/jks/webhook"
 	"nyiyui.ca/seekback-server/tokens"
 )
 
@@ -41,15 +46,25 @@ type Server struct {
 	mux                   *http.ServeMux
 	st                    storage.Storage
 	tps                   map[string]*template.Template
-	oauthConfig           *oauth2.Config
+	loginProviders        []auth.Provider
+	localLogin            *auth.Local
+	passkeys              *auth.Passkeys
 	store                 sessions.Store
 	mainUser              string
 	serializer            *rdf.Serializer
 	seekbackServerBaseURI *url.URL
 	seekbackServerToken   tokens.Token
 	seekbackServerEnabled bool
-	customLogUser         string
 	linkProviders         []linkdata.LinkProvider
+	feed                  *changefeed.Bus
+	graphIndex            graphIndex
+	backup                *backupConfig
+	undo                  undoStacks
+	webhooks              *webhook.Dispatcher
+	// recurrences generates occurrences through st, so that they are published to feed.
+	recurrences *recurrence.Scheduler
+	// reminders is set by SetupReminders, so that users can set where their reminders are sent.
+	reminders bool
 }
 
 func newDecoder(r *http.Request) *schema.Decoder {
@@ -72,15 +87,24 @@ func newDecoder(r *http.Request) *schema.Decoder {
 	return decoder
 }
 
-func New(st storage.Storage, oauthConfig *oauth2.Config, store sessions.Store, adminUser string, serializer *rdf.Serializer, customLogUser string) (*Server, error) {
+func New(st storage.Storage, oauthConfig *oauth2.Config, store sessions.Store, adminUser string, serializer *rdf.Serializer) (*Server, error) {
+	feed := changefeed.NewBus(feedKeep)
 	s := &Server{
-		mux:           http.NewServeMux(),
-		st:            st,
-		oauthConfig:   oauthConfig,
-		store:         store,
-		mainUser:      adminUser,
-		serializer:    serializer,
-		customLogUser: customLogUser,
+		mux:        http.NewServeMux(),
+		st:         changefeed.Wrap(st, feed),
+		feed:       feed,
+		store:      store,
+		mainUser:   adminUser,
+		serializer: serializer,
+		webhooks:   webhook.NewDispatcher(st),
+	}
+	s.recurrences = recurrence.NewScheduler(s.st)
+	s.recurrences.Owners = s.owners
+	if oauthConfig != nil {
+		err := s.AddLoginProvider(auth.NewGitHub(oauthConfig))
+		if err != nil {
+			return nil, err
+		}
 	}
 	return s, s.setup()
 }
@@ -107,21 +131,80 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) setup() error {
 	s.mux.HandleFunc("GET /login", s.login)
 	s.mux.HandleFunc("GET /login/callback", s.loginCallback)
-	s.mux.Handle("GET /login/settings", composeFunc(s.loginSettings, s.someLogin))
-	s.mux.Handle("POST /login/settings", composeFunc(s.loginSettings, s.someLogin))
+	s.mux.HandleFunc("GET /login/with/{provider}", s.loginProviderStart)
+	s.mux.HandleFunc("POST /login/password", s.loginPasswordPost)
+	s.mux.HandleFunc("POST /login/passkey/begin", s.passkeyLoginBegin)
+	s.mux.HandleFunc("POST /login/passkey/finish", s.passkeyLoginFinish)
+	s.mux.Handle("POST /login/settings/passkeys/begin", composeFunc(s.passkeyRegisterBegin, s.mainLogin))
+	s.mux.Handle("POST /login/settings/passkeys/finish", composeFunc(s.passkeyRegisterFinish, s.mainLogin))
+	s.mux.Handle("POST /login/settings/passkey/{id}/delete", composeFunc(s.passkeyDeletePost, s.mainLogin))
+	s.mux.Handle("GET /login/settings", composeFunc(s.loginSettings, s.mainLogin))
+	s.mux.Handle("POST /login/settings", composeFunc(s.loginSettings, s.mainLogin))
 
 	s.mux.Handle("GET /rdf/all", composeFunc(s.getRDF, s.mainLogin))
-
-	s.mux.Handle("GET /custom-log", s.requireUser(s.customLogUser, http.HandlerFunc(s.getCustomLog)))
+	s.mux.Handle("GET /sparql", composeFunc(s.sparqlQuery, s.mainLogin))
+	s.mux.Handle("POST /sparql", composeFunc(s.sparqlQuery, s.mainLogin))
+	s.mux.Handle("GET /events", composeFunc(s.changeFeed, s.mainLogin))
+	s.mux.Handle("POST /admin/backup", composeFunc(s.adminBackup, s.adminLogin))
+	s.mux.Handle("GET /admin/users", composeFunc(s.userList, s.adminLogin))
+	s.mux.Handle("POST /admin/users", composeFunc(s.userNewPost, s.adminLogin))
+	s.mux.Handle("POST /admin/user/{name}/edit", composeFunc(s.userEditPost, s.adminLogin))
+	s.mux.Handle("POST /admin/user/{name}/delete", composeFunc(s.userDeletePost, s.adminLogin))
+	s.mux.Handle("GET /webhooks", composeFunc(s.webhookList, s.mainLogin))
+	s.mux.Handle("POST /webhooks", composeFunc(s.webhookNewPost, s.mainLogin))
+	s.mux.Handle("GET /webhook/{id}", composeFunc(s.webhookView, s.mainLogin))
+	s.mux.Handle("POST /webhook/{id}/edit", composeFunc(s.webhookEditPost, s.mainLogin))
+	s.mux.Handle("POST /webhook/{id}/delete", composeFunc(s.webhookDeletePost, s.mainLogin))
+	s.mux.Handle("POST /webhook/{id}/test", composeFunc(s.webhookTestPost, s.mainLogin))
+	s.mux.Handle("GET /tokens", composeFunc(s.tokenList, s.mainLogin))
+	s.mux.Handle("POST /tokens", composeFunc(s.tokenNewPost, s.mainLogin))
+	s.mux.Handle("POST /token/{id}/delete", composeFunc(s.tokenDeletePost, s.mainLogin))
+	s.mux.Handle("GET /export", composeFunc(s.exportGet, s.mainLogin))
+	s.mux.Handle("GET /recurrences", composeFunc(s.recurrenceList, s.mainLogin))
+	s.mux.Handle("GET /recurrence/new", composeFunc(s.recurrenceNew, s.mainLogin))
+	s.mux.Handle("POST /recurrences", composeFunc(s.recurrenceNewPost, s.mainLogin))
+	s.mux.Handle("GET /recurrence/{id}", composeFunc(s.recurrenceView, s.mainLogin))
+	s.mux.Handle("POST /recurrence/{id}/edit", composeFunc(s.recurrenceEditPost, s.mainLogin))
+	s.mux.Handle("POST /recurrence/{id}/delete", composeFunc(s.recurrenceDeletePost, s.mainLogin))
+	s.mux.Handle("GET /calendars", composeFunc(s.calendarList, s.mainLogin))
+	s.mux.Handle("GET /calendar/new", composeFunc(s.calendarNew, s.mainLogin))
+	s.mux.Handle("POST /calendars", composeFunc(s.calendarNewPost, s.mainLogin))
+	s.mux.Handle("GET /calendar/{id}", composeFunc(s.calendarView, s.mainLogin))
+	s.mux.Handle("POST /calendar/{id}/edit", composeFunc(s.calendarEditPost, s.mainLogin))
+	s.mux.Handle("POST /calendar/{id}/delete", composeFunc(s.calendarDeletePost, s.mainLogin))
+
+	s.mux.Handle("GET /api/tasks", composeFunc(s.apiTasks, s.apiLogin))
+	s.mux.Handle("POST /api/tasks", composeFunc(s.apiTaskAdd, s.apiLogin))
+	s.mux.Handle("GET /api/tasks/{id}", composeFunc(s.apiTask, s.apiLogin))
+	s.mux.Handle("POST /api/quick", composeFunc(s.apiQuick, s.apiLogin))
+	s.mux.Handle("GET /api/activities", composeFunc(s.apiActivities, s.apiLogin))
+	s.mux.Handle("POST /api/activities", composeFunc(s.apiActivityAdd, s.apiLogin))
+	s.mux.Handle("GET /api/activities/current", composeFunc(s.apiCurrent, s.apiLogin))
+	s.mux.Handle("POST /api/activities/start", composeFunc(s.apiStart, s.apiLogin))
+	s.mux.Handle("POST /api/activities/stop", composeFunc(s.apiStop, s.apiLogin))
+	s.mux.Handle("GET /api/range", composeFunc(s.apiRange, s.apiLogin))
+	s.mux.Handle("GET /api/export", composeFunc(s.exportDownload, s.apiLogin))
+	s.mux.Handle("GET /api/events", composeFunc(s.changeFeed, s.apiLogin))
+
+	s.mux.Handle("GET /grants", composeFunc(s.grantList, s.mainLogin))
+	s.mux.Handle("POST /grants", composeFunc(s.grantNewPost, s.mainLogin))
+	s.mux.Handle("POST /grant/{id}/delete", composeFunc(s.grantDeletePost, s.mainLogin))
+	s.mux.Handle("GET /shared", composeFunc(s.shared, s.mainLogin))
+	s.mux.Handle("GET /shared/{owner}/task/{id}", composeFunc(s.sharedTask, s.mainLogin, s.requireGrant(storage.AccessRead)))
+	s.mux.Handle("POST /shared/{owner}/task/{id}/activity/new", composeFunc(s.sharedTaskActivityNewPost, s.mainLogin, s.requireGrant(storage.AccessLog)))
 
 	s.mux.Handle("GET /undone-tasks", composeFunc(s.undoneTasks, s.mainLogin))
 	s.mux.Handle("GET /activity/{id}", composeFunc(s.activityView, s.mainLogin))
 	s.mux.Handle("GET /activity/{id}/edit", composeFunc(s.activityEdit, s.mainLogin))
+	s.mux.Handle("GET /activity/{id}/history", composeFunc(s.makeHistory(storage.EntityActivity), s.mainLogin))
 	s.mux.Handle("POST /activity/{id}/edit", composeFunc(s.activityEditPost, s.mainLogin))
 	s.mux.Handle("GET /task/new", composeFunc(s.taskNew, s.mainLogin))
+	s.mux.Handle("GET /quick", composeFunc(s.quick, s.mainLogin))
+	s.mux.Handle("POST /quick", composeFunc(s.quickPost, s.mainLogin))
 	s.mux.Handle("POST /task/new", composeFunc(s.taskNewPost, s.mainLogin))
 	s.mux.Handle("GET /task/{id}", composeFunc(s.taskView, s.mainLogin))
 	s.mux.Handle("GET /task/{id}/edit", composeFunc(s.taskEdit, s.mainLogin))
+	s.mux.Handle("GET /task/{id}/history", composeFunc(s.makeHistory(storage.EntityTask), s.mainLogin))
 	s.mux.Handle("POST /task/{id}/edit", composeFunc(s.taskEditPost, s.mainLogin))
 	s.mux.Handle("GET /task/{id}/activity/new", composeFunc(s.taskActivityNew, s.mainLogin))
 	s.mux.Handle("POST /task/{id}/activity/new", composeFunc(s.taskActivityNewPost, s.mainLogin))
@@ -129,9 +212,13 @@ func (s *Server) setup() error {
 	s.mux.Handle("POST /task/new/activity/new", composeFunc(s.taskNewActivityNewPost, s.mainLogin))
 	s.mux.Handle("GET /task/{id}/plan/new", composeFunc(s.taskPlanNew, s.mainLogin))
 	s.mux.Handle("POST /task/{id}/plan/new", composeFunc(s.taskPlanNewPost, s.mainLogin))
+	s.mux.Handle("GET /plan/{id}/history", composeFunc(s.makeHistory(storage.EntityPlan), s.mainLogin))
+	s.mux.Handle("POST /revision/{id}/revert", composeFunc(s.revisionRevert, s.mainLogin))
 	s.mux.Handle("GET /activity/latest", composeFunc(s.activityLatest, s.mainLogin))
 	s.mux.Handle("POST /activity/{id}/extend", composeFunc(s.activityExtend, s.mainLogin))
 	s.mux.Handle("POST /activity/{id}/resume", composeFunc(s.activityResume, s.mainLogin))
+	s.mux.Handle("POST /activity/{id}/delete", composeFunc(s.activityDelete, s.mainLogin))
+	s.mux.Handle("POST /undo", composeFunc(s.undoPost, s.mainLogin))
 	s.mux.Handle("GET /day/{date}", composeFunc(s.dayView, s.mainLogin))
 	s.mux.Handle("GET /day/yesterday", composeFunc(s.makeDayViewDelta(-1), s.mainLogin))
 	s.mux.Handle("GET /day/today", composeFunc(s.makeDayViewDelta(0), s.mainLogin))
@@ -270,12 +357,30 @@ func (s *Server) activityEditPost(w http.ResponseWriter, r *http.Request) {
 	}
 	parsed.ID = id
 	parsed.TaskID = a.TaskID // do not allow changing task ID
+	if parsed.Version == 0 {
+		http.Error(w, "form data must include Version", 422)
+		return
+	}
 	err = s.st.ActivityEdit(parsed, r.Context())
+	if errors.Is(err, storage.ErrConflict) {
+		a, err = s.st.ActivityGet(id, r.Context())
+		if err != nil {
+			log.Printf("storage: activity get: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		s.renderConflict(w, r, storage.EntityActivity, id, a.Version, conflictFields(parsed, a, getTimeLocation(r), "TaskID"))
+		return
+	}
 	if err != nil {
 		log.Printf("storage: activity edit: %s", err)
 		http.Error(w, "storage error", 500)
 		return
 	}
+	s.pushUndo(w, r, fmt.Sprintf("Edited activity %d.", id), func(ctx context.Context) error {
+		a.Version++
+		return s.st.ActivityEdit(a, ctx)
+	})
 	http.Redirect(w, r, fmt.Sprintf("/activity/%d", id), 302)
 	return
 }
@@ -308,12 +413,19 @@ func (s *Server) taskView(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "too many plans", 500)
 		return
 	}
+	tags, err := s.st.TaskTags(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
 	var totalSpent time.Duration
 	for _, a := range as {
 		totalSpent += a.TimeEnd.Sub(a.TimeStart)
 	}
 	s.renderTemplate("task.html", w, r, map[string]interface{}{
 		"task":       t,
+		"tags":       tags,
 		"activities": as,
 		"plans":      ps,
 		"totalSpent": totalSpent,
@@ -372,12 +484,36 @@ func (s *Server) taskEditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	parsed.ID = id
+	if parsed.Version == 0 {
+		http.Error(w, "form data must include Version", 422)
+		return
+	}
+	t, err := s.st.TaskGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
 	err = s.st.TaskEdit(parsed, r.Context())
+	if errors.Is(err, storage.ErrConflict) {
+		t, err = s.st.TaskGet(id, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		s.renderConflict(w, r, storage.EntityTask, id, t.Version, conflictFields(parsed, t, getTimeLocation(r)))
+		return
+	}
 	if err != nil {
 		log.Printf("storage: %s", err)
 		http.Error(w, "storage error", 500)
 		return
 	}
+	s.pushUndo(w, r, fmt.Sprintf("Edited task %s.", t.QuickTitle), func(ctx context.Context) error {
+		t.Version++
+		return s.st.TaskEdit(t, ctx)
+	})
 	http.Redirect(w, r, fmt.Sprintf("/task/%d", id), 302)
 	return
 }
@@ -454,16 +590,21 @@ func (s *Server) taskNewActivityNewPost(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("form data decode failed: %s", err), 422)
 		return
 	}
-	taskID, err := s.st.TaskAdd(parsed.Task, r.Context())
-	if err != nil {
-		log.Printf("storage: add task: %s", err)
-		http.Error(w, "storage error", 500)
-		return
-	}
-	parsed.Activity.TaskID = taskID
-	activityID, err := s.st.ActivityAdd(parsed.Activity, r.Context())
+	var activityID int64
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		taskID, err := st.TaskAdd(parsed.Task, r.Context())
+		if err != nil {
+			return fmt.Errorf("add task: %w", err)
+		}
+		parsed.Activity.TaskID = taskID
+		activityID, err = st.ActivityAdd(parsed.Activity, r.Context())
+		if err != nil {
+			return fmt.Errorf("add activity: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("storage: add activity: %s", err)
+		log.Printf("storage: %s", err)
 		http.Error(w, "storage error", 500)
 		return
 	}
@@ -551,33 +692,41 @@ func (s *Server) taskActivityNewPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "end time cannot be after deadline", 422)
 		return
 	}
-	a.TaskID = id
-	activityID, err := s.st.ActivityAdd(a, r.Context())
-	if err != nil {
-		log.Printf("storage: %s", err)
-		http.Error(w, "storage error", 500)
-		return
-	}
+	var planID2 int64
 	if planID != "" {
-		log.Printf("update plan")
-		planID2, err := strconv.ParseInt(planID, 10, 64)
+		planID2, err = strconv.ParseInt(planID, 10, 64)
 		if err != nil {
 			http.Error(w, "PlanID must be int or \"\"", 422)
 			return
 		}
-		plan, err := s.st.PlanGet(planID2, r.Context())
+	}
+	a.TaskID = id
+	var activityID int64
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		var err error
+		activityID, err = st.ActivityAdd(a, r.Context())
 		if err != nil {
-			log.Printf("storage: %s", err)
-			http.Error(w, "storage error", 500)
-			return
+			return fmt.Errorf("add activity: %w", err)
+		}
+		if planID == "" {
+			return nil
+		}
+		log.Printf("update plan")
+		plan, err := st.PlanGet(planID2, r.Context())
+		if err != nil {
+			return fmt.Errorf("get plan: %w", err)
 		}
 		plan.ActivityID = activityID
-		err = s.st.PlanEdit(plan, r.Context())
+		err = st.PlanEdit(plan, r.Context())
 		if err != nil {
-			log.Printf("storage: %s", err)
-			http.Error(w, "storage error", 500)
-			return
+			return fmt.Errorf("edit plan: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
 	}
 	http.Redirect(w, r, fmt.Sprintf("/activity/%d", activityID), 302)
 }
@@ -699,6 +848,7 @@ func (s *Server) activityExtend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "storage error", 500)
 		return
 	}
+	before := a
 	a.TimeEnd = timeEnd
 	err = s.st.ActivityEdit(a, r.Context())
 	if err != nil {
@@ -706,6 +856,10 @@ func (s *Server) activityExtend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "storage error", 500)
 		return
 	}
+	s.pushUndo(w, r, fmt.Sprintf("Extended activity %d.", id), func(ctx context.Context) error {
+		before.Version++
+		return s.st.ActivityEdit(before, ctx)
+	})
 	http.Redirect(w, r, "/activity/latest", 302)
 }
 
@@ -741,12 +895,15 @@ func (s *Server) activityResume(w http.ResponseWriter, r *http.Request) {
 	a.TimeStart = timeStart
 	a.TimeEnd = timeEnd
 	a.Location = location
-	_, err = s.st.ActivityAdd(a, r.Context())
+	newID, err := s.st.ActivityAdd(a, r.Context())
 	if err != nil {
 		log.Printf("storage: %s", err)
 		http.Error(w, "storage error", 500)
 		return
 	}
+	s.pushUndo(w, r, fmt.Sprintf("Resumed activity %d.", id), func(ctx context.Context) error {
+		return s.st.ActivityDelete(newID, ctx)
+	})
 	http.Redirect(w, r, "/activity/latest", 302)
 }
 
@@ -783,6 +940,7 @@ func (s *Server) dayView(w http.ResponseWriter, r *http.Request) {
 
 	s.renderTemplate("day.html", w, r, map[string]interface{}{
 		"date":     date,
+		"dateEnd":  dateEnd,
 		"events":   events,
 		"tasks":    tasksByID,
 		"nColumns": nColumns,
@@ -830,79 +988,59 @@ func (s *Server) getRDF(w http.ResponseWriter, r *http.Request) {
 		accept = "text/turtle"
 	}
 
-	g := rdf2go.NewGraph(s.serializer.GraphURI())
-
-	// === Task ===
-	tw, err := s.st.TaskSearch("", time.Now(), r.Context())
+	g, err := s.buildGraph(r.Context())
 	if err != nil {
-		log.Printf("storage: storage: initial: %s", err)
+		log.Printf("storage: %s", err)
 		http.Error(w, "storage error", 500)
 		return
 	}
-	err = mergeWindowToGraph(tw, g, s.serializer.TaskToRDF)
+
+	w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", accept))
+	err = g.Serialize(w, accept)
 	if err != nil {
-		log.Printf("storage: storage: merge: %s", err)
-		http.Error(w, "storage error", 500)
+		log.Printf("rdf serialization: %s", err)
+		http.Error(w, "rdf serialization error", 500)
 		return
 	}
+	return
+}
 
-	// === Activity ===
-	aw, err := s.st.ActivityRange(time.Time{}, time.Now(), r.Context())
+// buildGraph serializes all tasks, activities and plans (including done tasks, and future activities and plans) into one graph.
+// It does not depend on the current time, so that the index built from it only changes with the storage (see getGraphIndex).
+func (s *Server) buildGraph(ctx context.Context) (*rdf2go.Graph, error) {
+	g := rdf2go.NewGraph(s.serializer.GraphURI())
+	end := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// === Task ===
+	ts, err := s.st.Tasks(ctx)
 	if err != nil {
-		log.Printf("storage: activity: initial: %s", err)
-		http.Error(w, "storage error", 500)
-		return
+		return nil, fmt.Errorf("task: %w", err)
 	}
-	err = mergeWindowToGraph(aw, g, s.serializer.ActivityToRDF)
-	if err != nil {
-		log.Printf("storage: activity: merge: %s", err)
-		http.Error(w, "storage error", 500)
-		return
+	for _, t := range ts {
+		subG, _ := s.serializer.TaskToRDF(t)
+		g.Merge(subG)
 	}
 
-	// === Plan ===
-	pw, err := s.st.PlanRange(time.Time{}, time.Now(), r.Context())
+	// === Activity ===
+	aw, err := s.st.ActivityRange(time.Time{}, end, ctx)
 	if err != nil {
-		log.Printf("storage: plan: initial: %s", err)
-		http.Error(w, "storage error", 500)
-		return
+		return nil, fmt.Errorf("activity: initial: %w", err)
 	}
-	err = mergeWindowToGraph(pw, g, s.serializer.PlanToRDF)
+	err = mergeWindowToGraph(aw, g, s.serializer.ActivityToRDF)
 	if err != nil {
-		log.Printf("storage: plan: merge: %s", err)
-		http.Error(w, "storage error", 500)
-		return
+		return nil, fmt.Errorf("activity: merge: %w", err)
 	}
 
-	w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", accept))
-	err = g.Serialize(w, accept)
+	// === Plan ===
+	pw, err := s.st.PlanRange(time.Time{}, end, ctx)
 	if err != nil {
-		log.Printf("rdf serialization: %s", err)
-		http.Error(w, "rdf serialization error", 500)
-		return
+		return nil, fmt.Errorf("plan: initial: %w", err)
 	}
-	return
-}
-
-func (s *Server) getCustomLog(w http.ResponseWriter, r *http.Request) {
-	var activities []database.Activity
-	err := s.st.(*database.Database).DB.Select(&activities, `
-SELECT * FROM activity_log
-WHERE task_id IN (
-  SELECT id FROM tasks
-	WHERE quick_title = 'お手洗い'
-)
-ORDER BY time_start DESC
-`)
-	s.renderTemplate("custom-log.html", w, r, map[string]interface{}{
-		"activities": activities,
-	})
+	err = mergeWindowToGraph(pw, g, s.serializer.PlanToRDF)
 	if err != nil {
-		log.Printf("template: %s", err)
-		http.Error(w, "template error", 500)
-		return
+		return nil, fmt.Errorf("plan: merge: %w", err)
 	}
-	return
+	return g, nil
 }
 
 func (s *Server) linkdata(w http.ResponseWriter, r *http.Request) {
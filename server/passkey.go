@@ -0,0 +1,177 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"nyiyui.ca/jks/auth"
+)
+
+// SetupPasskeys lets users log in with passkeys, which they register at /login/settings.
+// origin is the server's origin as seen by browsers, e.g. "https://jks.example".
+// It must be called before serving.
+func (s *Server) SetupPasskeys(origin string) error {
+	p, err := auth.NewPasskeys(origin, s.st)
+	if err != nil {
+		return err
+	}
+	s.passkeys = p
+	return nil
+}
+
+func (s *Server) passkeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if s.passkeys == nil {
+		http.Error(w, "passkeys are disabled", 404)
+		return
+	}
+	assertion, data, err := s.passkeys.BeginLogin()
+	if err != nil {
+		log.Printf("passkey: %s", err)
+		http.Error(w, "passkey failure", 500)
+		return
+	}
+	session, err := s.store.Get(r, "login-passkey")
+	if err != nil {
+		log.Printf("session get: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	session.Values["login"] = data
+	err = session.Save(r, w)
+	if err != nil {
+		log.Printf("session save: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	writeJSON(w, 200, assertion)
+}
+
+func (s *Server) passkeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if s.passkeys == nil {
+		http.Error(w, "passkeys are disabled", 404)
+		return
+	}
+	session, err := s.store.Get(r, "login-passkey")
+	if err != nil {
+		log.Printf("session get: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	data, ok := session.Values["login"].([]byte)
+	if !ok {
+		http.Error(w, "try logging in again", 400)
+		return
+	}
+	delete(session.Values, "login")
+	err = session.Save(r, w)
+	if err != nil {
+		log.Printf("session save: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	user, err := s.passkeys.FinishLogin(data, r, r.Context())
+	if err != nil {
+		log.Printf("passkey login: %s", err)
+		http.Error(w, "passkey not accepted", 401)
+		return
+	}
+	s.loggedIn(w, r, user)
+}
+
+func (s *Server) passkeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if s.passkeys == nil {
+		http.Error(w, "passkeys are disabled", 404)
+		return
+	}
+	user := r.Context().Value(LoginUserDataKey).(auth.User)
+	creation, data, err := s.passkeys.BeginRegistration(user, r.Context())
+	if err != nil {
+		log.Printf("passkey: %s", err)
+		http.Error(w, "passkey failure", 500)
+		return
+	}
+	session, err := s.store.Get(r, "login-passkey")
+	if err != nil {
+		log.Printf("session get: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	session.Values["registration"] = data
+	err = session.Save(r, w)
+	if err != nil {
+		log.Printf("session save: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	writeJSON(w, 200, creation)
+}
+
+// passkeyRegisterFinish adds the passkey named by the name query parameter.
+func (s *Server) passkeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if s.passkeys == nil {
+		http.Error(w, "passkeys are disabled", 404)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", 422)
+		return
+	}
+	session, err := s.store.Get(r, "login-passkey")
+	if err != nil {
+		log.Printf("session get: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	data, ok := session.Values["registration"].([]byte)
+	if !ok {
+		http.Error(w, "try registering again", 400)
+		return
+	}
+	delete(session.Values, "registration")
+	err = session.Save(r, w)
+	if err != nil {
+		log.Printf("session save: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	user := r.Context().Value(LoginUserDataKey).(auth.User)
+	_, err = s.passkeys.FinishRegistration(user, name, data, r, r.Context())
+	if err != nil {
+		log.Printf("passkey registration: %s", err)
+		http.Error(w, "passkey not accepted", 400)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// passkeyDeletePost deletes one of the user's passkeys.
+func (s *Server) passkeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	user := r.Context().Value(LoginUserDataKey).(auth.User)
+	ps, err := s.st.Passkeys(user.Provider, user.Login, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	for _, p := range ps {
+		if p.ID != id {
+			continue
+		}
+		err = s.st.PasskeyDelete(id, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		http.Redirect(w, r, "/login/settings", 302)
+		return
+	}
+	http.Error(w, "no such passkey", 404)
+}
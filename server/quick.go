@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/quickcapture"
+	"nyiyui.ca/jks/storage"
+)
+
+// wantsJSON reports whether the client asked for a JSON response instead of HTML.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// quickParse parses the text field, relative to the now field (Unix time) if given, so that saving a preview gives the same result.
+func quickParse(r *http.Request, form func(string) string) (res quickcapture.Result, now time.Time, err error) {
+	now = time.Now().Truncate(time.Second)
+	if v := form("now"); v != "" {
+		unix, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return quickcapture.Result{}, now, fmt.Errorf("now must be int")
+		}
+		now = time.Unix(unix, 0)
+	}
+	res, err = quickcapture.Parse(form("text"), now, getTimeLocation(r))
+	return res, now, err
+}
+
+// quick shows the quick capture form, and a preview of what would be saved if text is given.
+// With Accept: application/json, only the preview is returned.
+func (s *Server) quick(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	text := q.Get("text")
+	var res quickcapture.Result
+	var now time.Time
+	var parseErr error
+	if text != "" {
+		res, now, parseErr = quickParse(r, q.Get)
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		if parseErr != nil {
+			w.WriteHeader(422)
+			json.NewEncoder(w).Encode(map[string]string{"error": parseErr.Error()})
+			return
+		}
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			log.Printf("json encode: %s", err)
+		}
+		return
+	}
+	data := map[string]interface{}{
+		"text": text,
+	}
+	if text != "" {
+		data["now"] = now.Unix()
+		if parseErr != nil {
+			data["error"] = parseErr.Error()
+		} else {
+			data["result"] = res
+		}
+	}
+	s.renderTemplate("quick.html", w, r, data)
+}
+
+// quickPost saves the task, its tags and plan.
+// With Accept: application/json, the saved result is returned instead of redirecting to the task.
+func (s *Server) quickPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	res, _, err := quickParse(r, r.PostForm.Get)
+	if err != nil {
+		http.Error(w, err.Error(), 422)
+		return
+	}
+	err = s.quickSave(&res, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			log.Printf("json encode: %s", err)
+		}
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/task/%d", res.Task.ID), 302)
+}
+
+// quickSave adds the task, its tags and plan, and sets their IDs in res.
+func (s *Server) quickSave(res *quickcapture.Result, ctx context.Context) error {
+	return s.st.WithTx(ctx, func(st storage.Storage) error {
+		var err error
+		res.Task.ID, err = st.TaskAdd(res.Task, ctx)
+		if err != nil {
+			return err
+		}
+		res.Task.Version = 1
+		if len(res.Tags) > 0 {
+			err = st.TaskSetTags(res.Task.ID, res.Tags, ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if res.Plan != nil {
+			res.Plan.TaskID = res.Task.ID
+			res.Plan.ID, err = st.PlanAdd(*res.Plan, ctx)
+			if err != nil {
+				return err
+			}
+			res.Plan.Version = 1
+		}
+		return nil
+	})
+}
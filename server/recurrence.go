@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/recurrence"
+	"nyiyui.ca/jks/storage"
+)
+
+// SetupRecurrences sets how far ahead the occurrences of recurrences are generated.
+// It must be called before serving.
+func (s *Server) SetupRecurrences(horizon time.Duration) {
+	s.recurrences.Horizon = horizon
+}
+
+// RunRecurrences generates the occurrences of every user's active recurrences every hour until ctx is done.
+func (s *Server) RunRecurrences(ctx context.Context) {
+	s.recurrences.Run(ctx)
+}
+
+// occurrencePreview is an occurrence shown when editing a recurrence, and what saving the recurrence does to its task.
+type occurrencePreview struct {
+	Time   time.Time
+	TaskID int64
+	PlanID int64
+	Action string
+}
+
+func (s *Server) previewOccurrences(rec storage.Recurrence, ctx context.Context) ([]occurrencePreview, error) {
+	changes, err := s.recurrences.Reconcile(rec, time.Now(), true, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return occurrencePreviews(rec, changes), nil
+}
+
+// occurrencePreviews describes what saving rec does to the tasks of changes (from a dry run of Reconcile).
+func occurrencePreviews(rec storage.Recurrence, changes []recurrence.Change) []occurrencePreview {
+	ps := make([]occurrencePreview, len(changes))
+	for i, change := range changes {
+		ps[i] = occurrencePreview{Time: change.Time, TaskID: change.TaskID, PlanID: change.PlanID}
+		if !rec.Active {
+			// saving does not generate anything
+			continue
+		}
+		switch change.Action {
+		case recurrence.ActionAdd:
+			ps[i].Action = "will be added"
+		case recurrence.ActionEdit:
+			ps[i].Action = "will be edited: " + strings.Join(change.Fields, ", ")
+		case recurrence.ActionRemove:
+			ps[i].Action = "will be removed, as it is no longer an occurrence"
+		case recurrence.ActionKeep:
+			ps[i].Action = "is no longer an occurrence, but will be kept as it has activities"
+		}
+	}
+	return ps
+}
+
+// parseRecurrence parses the form of recurrence.html.
+func parseRecurrence(r *http.Request) (storage.Recurrence, error) {
+	rec := storage.Recurrence{
+		Name: r.PostForm.Get("Name"),
+		Set:  strings.ReplaceAll(r.PostForm.Get("Set"), "\r\n", "\n"),
+		Task: storage.Task{
+			QuickTitle:  r.PostForm.Get("QuickTitle"),
+			Description: r.PostForm.Get("Description"),
+		},
+		Active: r.PostForm.Get("Active") == "on",
+	}
+	if rec.Name == "" {
+		return rec, fmt.Errorf("name is required")
+	}
+	var err error
+	rec.ExDays, err = recurrence.ParseDays(r.PostForm.Get("ExDays"))
+	if err != nil {
+		return rec, fmt.Errorf("exception dates: %w", err)
+	}
+	for _, v := range r.PostForm["CalendarIDs"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return rec, fmt.Errorf("calendar ID: %w", err)
+		}
+		rec.CalendarIDs = append(rec.CalendarIDs, id)
+	}
+	_, err = recurrence.ParseSet(rec.Set)
+	if err != nil {
+		return rec, fmt.Errorf("recurrence set: %w", err)
+	}
+	if r.PostForm.Get("Plan") == "on" {
+		rec.Plan = &storage.PlanTemplate{Location: r.PostForm.Get("PlanLocation")}
+		for _, field := range []struct {
+			name string
+			d    *time.Duration
+		}{
+			{"PlanTimeAtAfterOffset", &rec.Plan.TimeAtAfterOffset},
+			{"PlanTimeBeforeOffset", &rec.Plan.TimeBeforeOffset},
+			{"PlanDurationGe", &rec.Plan.DurationGe},
+			{"PlanDurationLt", &rec.Plan.DurationLt},
+		} {
+			v := r.PostForm.Get(field.name)
+			if v == "" {
+				continue
+			}
+			*field.d, err = time.ParseDuration(v)
+			if err != nil {
+				return rec, fmt.Errorf("%s: %w", field.name, err)
+			}
+		}
+		if rec.Plan.TimeBeforeOffset <= rec.Plan.TimeAtAfterOffset {
+			return rec, fmt.Errorf("the plan must end after it starts")
+		}
+	}
+	return rec, nil
+}
+
+// renderRecurrence shows the form for rec (a new recurrence if its ID is zero), with its upcoming occurrences or formErr.
+func (s *Server) renderRecurrence(w http.ResponseWriter, r *http.Request, rec storage.Recurrence, formErr error) {
+	data := map[string]interface{}{
+		"recurrence": rec,
+		"exDays":     strings.Join(formatDays(rec.ExDays), " "),
+		"horizon":    s.recurrences.Horizon,
+	}
+	cs, err := s.st.Calendars(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	data["calendars"] = cs
+	if formErr == nil {
+		ps, err := s.previewOccurrences(rec, r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		data["occurrences"] = ps
+	} else {
+		data["error"] = formErr.Error()
+		w.WriteHeader(422)
+	}
+	s.renderTemplate("recurrence.html", w, r, data)
+}
+
+func formatDays(days []time.Time) []string {
+	ss := make([]string, len(days))
+	for i, day := range days {
+		ss[i] = day.Format(time.DateOnly)
+	}
+	return ss
+}
+
+func (s *Server) recurrenceList(w http.ResponseWriter, r *http.Request) {
+	rs, err := s.st.Recurrences(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTemplate("recurrences.html", w, r, map[string]interface{}{
+		"recurrences": rs,
+	})
+}
+
+func (s *Server) recurrenceNew(w http.ResponseWriter, r *http.Request) {
+	cs, err := s.st.Calendars(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTemplate("recurrence.html", w, r, map[string]interface{}{
+		"recurrence": storage.Recurrence{Active: true},
+		"horizon":    s.recurrences.Horizon,
+		"calendars":  cs,
+	})
+}
+
+// recurrenceNewPost adds the recurrence and generates its occurrences, or only previews them if the Preview button was pressed.
+func (s *Server) recurrenceNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	rec, err := parseRecurrence(r)
+	if err != nil || r.PostForm.Has("Preview") {
+		s.renderRecurrence(w, r, rec, err)
+		return
+	}
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		var err error
+		rec.ID, err = st.RecurrenceAdd(rec, r.Context())
+		if err != nil {
+			return err
+		}
+		return s.reconcileRecurrence(rec, st, r.Context())
+	})
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/recurrence/%d", rec.ID), 302)
+}
+
+// reconcileRecurrence reconciles the occurrences of the recurrence just saved in st (if it is active), so that it is saved with its occurrences or not at all.
+// As shown by the preview, this removes the tasks of occurrences it no longer has.
+func (s *Server) reconcileRecurrence(rec storage.Recurrence, st storage.Storage, ctx context.Context) error {
+	if !rec.Active {
+		return nil
+	}
+	_, err := s.recurrences.In(st).Reconcile(rec, time.Now(), false, ctx)
+	return err
+}
+
+func (s *Server) recurrenceView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	rec, err := s.st.RecurrenceGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderRecurrence(w, r, rec, nil)
+}
+
+// recurrenceEditPost saves the recurrence and generates its occurrences, or only previews them if the Preview button was pressed.
+// The tasks of occurrences already generated are edited to match, or removed if they are no longer occurrences.
+func (s *Server) recurrenceEditPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	rec, err := parseRecurrence(r)
+	rec.ID = id
+	if err != nil || r.PostForm.Has("Preview") {
+		s.renderRecurrence(w, r, rec, err)
+		return
+	}
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		err := st.RecurrenceEdit(rec, r.Context())
+		if err != nil {
+			return err
+		}
+		return s.reconcileRecurrence(rec, st, r.Context())
+	})
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/recurrence/%d", rec.ID), 302)
+}
+
+func (s *Server) recurrenceDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = s.st.RecurrenceDelete(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/recurrences", 302)
+}
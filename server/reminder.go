@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nyiyui.ca/jks/reminder"
+	"nyiyui.ca/jks/storage"
+)
+
+// SetupReminders makes e remind every user (see owners) through the notifiers in their settings, in their time zone.
+// The main user's reminders go to the notifiers given to e (e.g. from the command line), in e.Location, unless they have some in their settings.
+// It must be called before serving.
+func (s *Server) SetupReminders(e *reminder.Engine) {
+	s.reminders = true
+	e.Owners = s.owners
+	e.Recipient = s.reminderRecipient
+}
+
+func (s *Server) reminderRecipient(ctx context.Context) ([]reminder.Notifier, *time.Location, bool, error) {
+	owner := storage.Owner(ctx)
+	u, ok, err := s.account(s.nameOf(owner), ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !ok || len(u.Notify) == 0 {
+		// other users without notifiers get no reminders
+		return nil, nil, owner != "", nil
+	}
+	ns := make([]reminder.Notifier, len(u.Notify))
+	for i, n := range u.Notify {
+		ns[i], err = reminder.ParseNotifier(n)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("notifier %d: %w", i, err)
+		}
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("invalid timezone: %s", u.Timezone)
+	}
+	return ns, loc, true, nil
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+
+	"nyiyui.ca/jks/sparql"
+	"nyiyui.ca/jks/storage"
+)
+
+// graphIndex caches the SPARQL index of the graph produced by buildGraph, for each owner.
+type graphIndex struct {
+	lock    sync.Mutex
+	indexes map[string]generationIndex
+}
+
+type generationIndex struct {
+	index      *sparql.Index
+	generation int64
+}
+
+// getGraphIndex returns the SPARQL index of the owner of ctx, rebuilding it if a change has been published since it was last built.
+func (s *Server) getGraphIndex(ctx context.Context) (*sparql.Index, error) {
+	s.graphIndex.lock.Lock()
+	defer s.graphIndex.lock.Unlock()
+	owner := storage.Owner(ctx)
+	generation := s.feed.Seq()
+	if gi, ok := s.graphIndex.indexes[owner]; ok && gi.generation == generation {
+		return gi.index, nil
+	}
+	g, err := s.buildGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.graphIndex.indexes == nil {
+		s.graphIndex.indexes = map[string]generationIndex{}
+	}
+	gi := generationIndex{index: sparql.NewIndex(g), generation: generation}
+	s.graphIndex.indexes[owner] = gi
+	log.Printf("sparql: rebuilt index with %d triples", gi.index.Len())
+	return gi.index, nil
+}
+
+// sparqlQuery implements the query operation of the SPARQL 1.1 Protocol, for SELECT and ASK queries.
+func (s *Server) sparqlQuery(w http.ResponseWriter, r *http.Request) {
+	var query string
+	if r.Method == "POST" {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType == "application/sparql-query" {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, "reading body failed", 400)
+				return
+			}
+			query = string(body)
+		} else {
+			err := r.ParseForm()
+			if err != nil {
+				http.Error(w, "parsing form data failed", 400)
+				return
+			}
+			query = r.PostForm.Get("query")
+		}
+	} else {
+		query = r.URL.Query().Get("query")
+	}
+	if query == "" {
+		http.Error(w, "query is required", 400)
+		return
+	}
+	q, err := sparql.Parse(query, s.serializer.Prefixes())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query parse failed: %s", err), 400)
+		return
+	}
+	ix, err := s.getGraphIndex(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=utf-8", sparql.ResultsJSONType))
+	err = ix.Execute(q).WriteJSON(w)
+	if err != nil {
+		log.Printf("sparql: write results: %s", err)
+		return
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/rdf"
+	"nyiyui.ca/jks/sparql"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestBuildGraphFuturePlan(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	id, err := st.TaskAdd(storage.Task{QuickTitle: "next week"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Second)
+	_, err = st.PlanAdd(storage.Plan{TaskID: id, TimeAtAfter: start, TimeBefore: start.Add(time.Hour)}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{st: st, serializer: rdf.NewSerializer("https://jks.example/")}
+	g, err := s.buildGraph(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := sparql.Parse(`SELECT ?title WHERE { ?p a jks:Plan ; jks:forTask ?t ; jks:timeStart ?start . ?t jks:quickTitle ?title }`, s.serializer.Prefixes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := sparql.NewIndex(g).Execute(q)
+	if len(r.Bindings) != 1 || r.Bindings[0]["title"].RawValue() != "next week" {
+		t.Fatalf("bindings %v", r.Bindings)
+	}
+}
@@ -0,0 +1,63 @@
+// Keeps a page up to date by reloading its main element when a relevant change arrives on the change feed (/events).
+// The page opts in with an element like <div id="live" data-entities="activity plan task" data-from="unix" data-to="unix">.
+// data-from and data-to are optional, and limit activities and plans to those overlapping that range (or already shown).
+document.addEventListener('DOMContentLoaded', () => {
+  const live = document.getElementById('live');
+  if (!live) {
+    return;
+  }
+  const entities = live.dataset.entities.split(' ');
+  const from = live.dataset.from ? new Date(Number(live.dataset.from) * 1000) : null;
+  const to = live.dataset.to ? new Date(Number(live.dataset.to) * 1000) : null;
+
+  const overlaps = (value) => {
+    const start = new Date(value.TimeStart || value.TimeAtAfter);
+    const end = new Date(value.TimeEnd || value.TimeBefore);
+    if (isNaN(start) || isNaN(end)) {
+      return true;
+    }
+    return start < to && end >= from;
+  };
+  const relevant = (change) => {
+    if (!entities.includes(change.entity)) {
+      return false;
+    }
+    if (from === null || to === null || change.entity === 'task' || !change.value) {
+      return true;
+    }
+    const shown = document.querySelector(`main [href="/${change.entity}/${change.id}"]`);
+    return shown !== null || overlaps(change.value);
+  };
+
+  let timer = null;
+  const reload = () => {
+    clearTimeout(timer);
+    timer = setTimeout(async () => {
+      const main = document.querySelector('main');
+      const active = document.activeElement;
+      if (active && main.contains(active) && active.matches('input, textarea, select')) {
+        // don't throw away what is being typed; try again later
+        reload();
+        return;
+      }
+      const resp = await fetch(location.href);
+      if (!resp.ok) {
+        return;
+      }
+      const doc = new DOMParser().parseFromString(await resp.text(), 'text/html');
+      const newMain = doc.querySelector('main');
+      if (newMain) {
+        main.innerHTML = newMain.innerHTML;
+        document.title = doc.title;
+      }
+    }, 300);
+  };
+
+  const source = new EventSource('/events');
+  source.addEventListener('change', (event) => {
+    if (relevant(JSON.parse(event.data))) {
+      reload();
+    }
+  });
+  source.addEventListener('reset', reload);
+});
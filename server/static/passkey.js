@@ -0,0 +1,81 @@
+// Passkey login and registration; see server/passkey.go.
+
+function b64urlDecode(s) {
+  s = s.replace(/-/g, '+').replace(/_/g, '/');
+  while (s.length % 4) s += '=';
+  return Uint8Array.from(atob(s), c => c.charCodeAt(0));
+}
+
+function b64urlEncode(buf) {
+  const bytes = new Uint8Array(buf);
+  let s = '';
+  for (const b of bytes) s += String.fromCharCode(b);
+  return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+async function passkeyPost(url, body) {
+  const resp = await fetch(url, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  if (!resp.ok) throw new Error(await resp.text());
+  return resp;
+}
+
+async function passkeyLogin() {
+  const { publicKey } = await (await passkeyPost('/login/passkey/begin')).json();
+  publicKey.challenge = b64urlDecode(publicKey.challenge);
+  for (const c of publicKey.allowCredentials || []) c.id = b64urlDecode(c.id);
+  const cred = await navigator.credentials.get({ publicKey });
+  await passkeyPost('/login/passkey/finish', {
+    id: cred.id,
+    rawId: b64urlEncode(cred.rawId),
+    type: cred.type,
+    response: {
+      clientDataJSON: b64urlEncode(cred.response.clientDataJSON),
+      authenticatorData: b64urlEncode(cred.response.authenticatorData),
+      signature: b64urlEncode(cred.response.signature),
+      userHandle: cred.response.userHandle && b64urlEncode(cred.response.userHandle),
+    },
+  });
+  location.href = '/';
+}
+
+async function passkeyRegister(name) {
+  const { publicKey } = await (await passkeyPost('/login/settings/passkeys/begin')).json();
+  publicKey.challenge = b64urlDecode(publicKey.challenge);
+  publicKey.user.id = b64urlDecode(publicKey.user.id);
+  for (const c of publicKey.excludeCredentials || []) c.id = b64urlDecode(c.id);
+  const cred = await navigator.credentials.create({ publicKey });
+  await passkeyPost('/login/settings/passkeys/finish?name=' + encodeURIComponent(name), {
+    id: cred.id,
+    rawId: b64urlEncode(cred.rawId),
+    type: cred.type,
+    response: {
+      clientDataJSON: b64urlEncode(cred.response.clientDataJSON),
+      attestationObject: b64urlEncode(cred.response.attestationObject),
+      transports: cred.response.getTransports ? cred.response.getTransports() : [],
+    },
+  });
+  location.reload();
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+  const error = document.getElementById('passkey-error');
+  const fail = err => {
+    error.textContent = err.message;
+    error.style.display = 'block';
+  };
+  const login = document.getElementById('passkey-login');
+  if (login) {
+    login.addEventListener('click', () => passkeyLogin().catch(fail));
+  }
+  const register = document.getElementById('passkey-register');
+  if (register) {
+    register.addEventListener('submit', e => {
+      e.preventDefault();
+      passkeyRegister(register.elements.name.value).catch(fail);
+    });
+  }
+});
@@ -18,6 +18,7 @@ import (
 	"github.com/google/safehtml/uncheckedconversions"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
+	"nyiyui.ca/jks/auth"
 	"nyiyui.ca/jks/layout"
 	"nyiyui.ca/jks/storage"
 	seekbackStorage "nyiyui.ca/seekback-server/storage"
@@ -54,16 +55,20 @@ func (s *Server) renderTemplate(path stringConstant, w http.ResponseWriter, r *h
 	if data == nil {
 		data = map[string]interface{}{}
 	}
-	data["login"], _ = r.Context().Value(LoginUserDataKey).(githubUserData)
+	data["login"], _ = r.Context().Value(LoginUserDataKey).(auth.User)
 	data["tzloc"] = getTimeLocation(r)
+	data["account"], _ = r.Context().Value(accountKey{}).(storage.User)
+	if e, ok := s.currentUndo(r); ok {
+		data["undo"] = e
+		data["undoNext"] = r.URL.RequestURI()
+	}
 	t = t.Funcs(template.FuncMap{
 		"timezone": func() string {
-			loginSession, err := s.store.Get(r, "login")
-			if err != nil {
+			loc, ok := r.Context().Value(TimeLocationKey).(*time.Location)
+			if !ok {
 				return ""
 			}
-			tzName, _ := loginSession.Values["timezone"].(string)
-			return tzName
+			return loc.String()
 		},
 	})
 	err = t.Execute(w, data)
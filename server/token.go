@@ -0,0 +1,69 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// tokenList shows the API tokens, and the token just made by tokenNewPost (which is not shown again).
+func (s *Server) tokenList(w http.ResponseWriter, r *http.Request) {
+	s.renderTokens(w, r, "")
+}
+
+func (s *Server) renderTokens(w http.ResponseWriter, r *http.Request, newToken string) {
+	ts, err := s.st.Tokens(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTemplate("tokens.html", w, r, map[string]interface{}{
+		"tokens":   ts,
+		"newToken": newToken,
+	})
+}
+
+func (s *Server) tokenNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	name := r.PostForm.Get("Name")
+	if name == "" {
+		http.Error(w, "name is required", 422)
+		return
+	}
+	token, hash, err := storage.NewToken()
+	if err != nil {
+		log.Printf("token: %s", err)
+		http.Error(w, "token generation failed", 500)
+		return
+	}
+	_, err = s.st.TokenAdd(storage.Token{Name: name, Hash: hash, Created: time.Now()}, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTokens(w, r, token)
+}
+
+func (s *Server) tokenDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = s.st.TokenDelete(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/tokens", 302)
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+// undoWindow is how long after a change it can still be undone.
+const undoWindow = 10 * time.Minute
+
+// undoDepth is the number of changes remembered per session.
+const undoDepth = 20
+
+// undoEntry reverses one change, using only the storage.Storage interface.
+// Edits are undone with the version they produced, so that an undo fails with storage.ErrConflict if the row was changed again since.
+type undoEntry struct {
+	ID          string
+	Description string
+	Time        time.Time
+	undo        func(ctx context.Context) error
+}
+
+// undoStacks holds the undo stack of each login session, keyed by the session's "undoKey" value.
+// Stacks are kept in memory only, so restarting the server forgets them.
+type undoStacks struct {
+	lock   sync.Mutex
+	stacks map[string][]undoEntry
+}
+
+func (u *undoStacks) push(key string, e undoEntry) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.stacks == nil {
+		u.stacks = map[string][]undoEntry{}
+	}
+	// Sweep every stack, so those of abandoned sessions do not hold on to their entries.
+	for k := range u.stacks {
+		u.live(k)
+	}
+	stack := append(u.live(key), e)
+	if len(stack) > undoDepth {
+		stack = stack[len(stack)-undoDepth:]
+	}
+	u.stacks[key] = stack
+}
+
+// top returns the most recent change that can still be undone.
+func (u *undoStacks) top(key string) (undoEntry, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	stack := u.live(key)
+	if len(stack) == 0 {
+		return undoEntry{}, false
+	}
+	return stack[len(stack)-1], true
+}
+
+// pop removes and returns the most recent change if its ID is id.
+func (u *undoStacks) pop(key, id string) (undoEntry, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	stack := u.live(key)
+	if len(stack) == 0 || stack[len(stack)-1].ID != id {
+		return undoEntry{}, false
+	}
+	e := stack[len(stack)-1]
+	u.stacks[key] = stack[:len(stack)-1]
+	return e, true
+}
+
+// live drops entries older than undoWindow and returns the rest.
+// u.lock must be held.
+func (u *undoStacks) live(key string) []undoEntry {
+	stack := u.stacks[key]
+	i := 0
+	for i < len(stack) && time.Since(stack[i].Time) > undoWindow {
+		i++
+	}
+	if i > 0 {
+		// Copy, so that the dropped entries are not kept alive by the backing array.
+		stack = slices.Clone(stack[i:])
+	}
+	if len(stack) == 0 {
+		delete(u.stacks, key)
+	} else {
+		u.stacks[key] = stack
+	}
+	return stack
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// undoKey returns the key of the undo stack of the login session, or "" if it has none.
+// If create is true, a key is made and saved to the session; this must happen before the response is written.
+func (s *Server) undoKey(w http.ResponseWriter, r *http.Request, create bool) (string, error) {
+	loginSession, err := s.store.Get(r, "login")
+	if err != nil {
+		return "", err
+	}
+	key, _ := loginSession.Values["undoKey"].(string)
+	if key != "" || !create {
+		return key, nil
+	}
+	key, err = randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	loginSession.Values["undoKey"] = key
+	err = loginSession.Save(r, w)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// pushUndo remembers how to undo a change that was just made.
+// Failing to do so is logged but does not fail the request, as the change itself has been made.
+func (s *Server) pushUndo(w http.ResponseWriter, r *http.Request, description string, undo func(ctx context.Context) error) {
+	key, err := s.undoKey(w, r, true)
+	if err != nil {
+		log.Printf("undo: session: %s", err)
+		return
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		log.Printf("undo: %s", err)
+		return
+	}
+	s.undo.push(key, undoEntry{
+		ID:          id,
+		Description: description,
+		Time:        time.Now(),
+		undo:        undo,
+	})
+}
+
+// currentUndo returns the change the Undo banner should offer, if any.
+func (s *Server) currentUndo(r *http.Request) (undoEntry, bool) {
+	key, err := s.undoKey(nil, r, false)
+	if err != nil || key == "" {
+		return undoEntry{}, false
+	}
+	return s.undo.top(key)
+}
+
+func (s *Server) undoPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	key, err := s.undoKey(w, r, false)
+	if err != nil {
+		log.Printf("undo: session: %s", err)
+		http.Error(w, "session failure", 400)
+		return
+	}
+	e, ok := s.undo.pop(key, r.PostForm.Get("id"))
+	if !ok {
+		http.Error(w, "nothing to undo (the change may be too old, or already undone)", 409)
+		return
+	}
+	err = e.undo(r.Context())
+	if errors.Is(err, storage.ErrConflict) {
+		http.Error(w, "cannot undo: it was changed again since", 409)
+		return
+	}
+	if err != nil {
+		log.Printf("undo %q: %s", e.Description, err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	next := r.PostForm.Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/activity/latest"
+	}
+	http.Redirect(w, r, next, 302)
+}
+
+func (s *Server) activityDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	var a storage.Activity
+	var fulfilled []int64
+	err = s.st.WithTx(r.Context(), func(st storage.Storage) error {
+		var err error
+		a, err = st.ActivityGet(id, r.Context())
+		if err != nil {
+			return fmt.Errorf("get activity: %w", err)
+		}
+		ps, err := st.TaskGetPlans(a.TaskID, 100, 0, r.Context())
+		if err != nil {
+			return fmt.Errorf("get plans: %w", err)
+		}
+		for _, p := range ps {
+			if p.ActivityID == id {
+				fulfilled = append(fulfilled, p.ID)
+			}
+		}
+		return st.ActivityDelete(id, r.Context())
+	})
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.pushUndo(w, r, fmt.Sprintf("Deleted activity %d.", id), func(ctx context.Context) error {
+		return s.st.WithTx(ctx, func(st storage.Storage) error {
+			err := st.ActivityRestore(a, ctx)
+			if err != nil {
+				return err
+			}
+			for _, planID := range fulfilled {
+				p, err := st.PlanGet(planID, ctx)
+				if err != nil {
+					return err
+				}
+				p.ActivityID = id
+				err = st.PlanEdit(p, ctx)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	http.Redirect(w, r, fmt.Sprintf("/task/%d", a.TaskID), 302)
+}
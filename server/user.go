@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"nyiyui.ca/jks/auth"
+	"nyiyui.ca/jks/storage"
+)
+
+type accountKey struct{}
+
+// ownerOf returns the owner (see storage.WithOwner) of the user's rows.
+// The main user owns the rows owned by "", which were there before there were other users.
+func (s *Server) ownerOf(name string) string {
+	if name == s.mainUser {
+		return ""
+	}
+	return name
+}
+
+// nameOf is the inverse of ownerOf.
+func (s *Server) nameOf(owner string) string {
+	if owner == "" {
+		return s.mainUser
+	}
+	return owner
+}
+
+// account returns the user's account; ok is false if they have none.
+// The main user always has an approved admin account, even if it is not stored.
+func (s *Server) account(name string, ctx context.Context) (u storage.User, ok bool, err error) {
+	u, ok, err = s.st.UserGet(name, ctx)
+	if err != nil {
+		return storage.User{}, false, err
+	}
+	if name == s.mainUser {
+		if !ok {
+			u = storage.User{Name: name}
+		}
+		u.Approved = true
+		u.Admin = true
+		ok = true
+	}
+	return u, ok, nil
+}
+
+// owners returns the owners of the approved users, for background work done for each user.
+func (s *Server) owners(ctx context.Context) ([]string, error) {
+	us, err := s.st.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owners := []string{""}
+	for _, u := range us {
+		if u.Approved && u.Name != s.mainUser {
+			owners = append(owners, u.Name)
+		}
+	}
+	return owners, nil
+}
+
+func (s *Server) adminLogin(next http.Handler) http.Handler {
+	return s.requireUser("", s.requireAccount(true, next))
+}
+
+// requireAccount requires the user set by requireUser to have an approved account, which is an admin's if admin is set.
+// Users without an account are added as a registration for an admin to approve.
+// Storage is scoped to the user's rows, and times are shown in their time zone.
+func (s *Server) requireAccount(admin bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(LoginUserDataKey).(auth.User)
+		u, ok, err := s.account(user.Name(), r.Context())
+		if err != nil {
+			log.Printf("storage: %s", err)
+			http.Error(w, "storage error", 500)
+			return
+		}
+		if !ok {
+			err = s.st.UserAdd(storage.User{Name: user.Name(), Created: time.Now()}, r.Context())
+			if err != nil {
+				log.Printf("storage: %s", err)
+				http.Error(w, "storage error", 500)
+				return
+			}
+		}
+		if !u.Approved {
+			http.Error(w, fmt.Sprintf("%s is waiting for an admin to approve their registration", user.Name()), 403)
+			return
+		}
+		if admin && !u.Admin {
+			http.Error(w, "only admins can do this", 403)
+			return
+		}
+		ctx, err := s.withAccount(u, r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withAccount returns ctx with the account u, scoped to u's rows, and with u's time zone (if set).
+func (s *Server) withAccount(u storage.User, ctx context.Context) (context.Context, error) {
+	if u.Timezone != "" {
+		loc, err := time.LoadLocation(u.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %s", u.Timezone)
+		}
+		ctx = context.WithValue(ctx, TimeLocationKey, loc)
+	}
+	ctx = context.WithValue(ctx, accountKey{}, u)
+	return storage.WithOwner(ctx, s.ownerOf(u.Name)), nil
+}
+
+// userList shows the users, with the registrations waiting to be approved first.
+func (s *Server) userList(w http.ResponseWriter, r *http.Request) {
+	us, err := s.st.Users(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	var registrations, users []storage.User
+	for _, u := range us {
+		if u.Approved {
+			users = append(users, u)
+		} else {
+			registrations = append(registrations, u)
+		}
+	}
+	s.renderTemplate("users.html", w, r, map[string]interface{}{
+		"registrations": registrations,
+		"users":         users,
+		"mainUser":      s.mainUser,
+	})
+}
+
+// userNewPost adds an approved user, so that they can log in.
+func (s *Server) userNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	name := r.PostForm.Get("Name")
+	if name == "" {
+		http.Error(w, "name is required", 422)
+		return
+	}
+	u, ok, err := s.st.UserGet(name, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	u.Approved = true
+	u.Admin = r.PostForm.Get("Admin") == "on"
+	if ok {
+		err = s.st.UserEdit(u, r.Context())
+	} else {
+		u.Name = name
+		u.Created = time.Now()
+		err = s.st.UserAdd(u, r.Context())
+	}
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/admin/users", 302)
+}
+
+// userEditPost approves the user, and sets whether they are an admin.
+func (s *Server) userEditPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	u, ok, err := s.st.UserGet(r.PathValue("name"), r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	if !ok {
+		http.Error(w, "no such user", 404)
+		return
+	}
+	u.Approved = true
+	u.Admin = r.PostForm.Get("Admin") == "on"
+	err = s.st.UserEdit(u, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/admin/users", 302)
+}
+
+// userDeletePost deletes the user or rejects their registration; the rows they own are kept.
+func (s *Server) userDeletePost(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == s.mainUser {
+		http.Error(w, "the main user cannot be deleted", 422)
+		return
+	}
+	err := s.st.UserDelete(name, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/admin/users", 302)
+}
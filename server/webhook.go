@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+	"nyiyui.ca/jks/webhook"
+)
+
+// RunWebhooks sends the webhook events of every user until ctx is done.
+// Deadline events are sent deadlineLead before each deadline.
+func (s *Server) RunWebhooks(ctx context.Context, deadlineLead time.Duration) {
+	w := webhook.NewWatcher(s.st, s.feed, s.webhooks)
+	w.DeadlineLead = deadlineLead
+	w.Owners = s.owners
+	w.Run(ctx)
+}
+
+// parseEvents parses a comma- or space-separated list of event types.
+func parseEvents(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+func (s *Server) webhookList(w http.ResponseWriter, r *http.Request) {
+	hs, err := s.st.Webhooks(r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTemplate("webhooks.html", w, r, map[string]interface{}{
+		"webhooks": hs,
+		"types":    webhook.Types,
+	})
+}
+
+func (s *Server) webhookNewPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		log.Printf("webhook secret: %s", err)
+		http.Error(w, "secret generation failed", 500)
+		return
+	}
+	h := storage.Webhook{
+		URL:    r.PostForm.Get("URL"),
+		Secret: secret,
+		Events: parseEvents(r.PostForm.Get("Events")),
+		Active: true,
+	}
+	if !strings.HasPrefix(h.URL, "http://") && !strings.HasPrefix(h.URL, "https://") {
+		http.Error(w, "URL must be http or https", 422)
+		return
+	}
+	id, err := s.st.WebhookAdd(h, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/webhook/%d", id), 302)
+}
+
+func (s *Server) webhookView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	h, err := s.st.WebhookGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	ds, err := s.st.Deliveries(id, storage.MaxDeliveries, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	s.renderTemplate("webhook.html", w, r, map[string]interface{}{
+		"webhook":    h,
+		"events":     strings.Join(h.Events, " "),
+		"deliveries": ds,
+		"types":      webhook.Types,
+	})
+}
+
+func (s *Server) webhookEditPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "parsing form data failed", 400)
+		return
+	}
+	h, err := s.st.WebhookGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	h.URL = r.PostForm.Get("URL")
+	h.Events = parseEvents(r.PostForm.Get("Events"))
+	h.Active = r.PostForm.Get("Active") == "on"
+	if !strings.HasPrefix(h.URL, "http://") && !strings.HasPrefix(h.URL, "https://") {
+		http.Error(w, "URL must be http or https", 422)
+		return
+	}
+	err = s.st.WebhookEdit(h, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/webhook/%d", id), 302)
+}
+
+func (s *Server) webhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	err = s.st.WebhookDelete(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, "/webhooks", 302)
+}
+
+// webhookTestPost sends a ping to the webhook, regardless of its filters and whether it is active.
+func (s *Server) webhookTestPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be int", 422)
+		return
+	}
+	h, err := s.st.WebhookGet(id, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	_, err = s.webhooks.EmitTo(h, webhook.Payload{Type: webhook.EventPing, Time: time.Now()}, r.Context())
+	if err != nil {
+		log.Printf("storage: %s", err)
+		http.Error(w, "storage error", 500)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/webhook/%d", id), 302)
+}
@@ -0,0 +1,444 @@
+package sparql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deiu/rdf2go"
+)
+
+// Binding maps variable names to terms.
+type Binding map[string]rdf2go.Term
+
+var errUnbound = errors.New("unbound variable")
+
+// Expr is a FILTER or ORDER BY expression.
+type Expr interface {
+	Eval(b Binding) (rdf2go.Term, error)
+}
+
+type varExpr string
+
+func (e varExpr) Eval(b Binding) (rdf2go.Term, error) {
+	t, ok := b[string(e)]
+	if !ok {
+		return nil, errUnbound
+	}
+	return t, nil
+}
+
+type constExpr struct {
+	term rdf2go.Term
+}
+
+func (e constExpr) Eval(b Binding) (rdf2go.Term, error) {
+	return e.term, nil
+}
+
+type unaryExpr struct {
+	op string
+	e  Expr
+}
+
+func (e *unaryExpr) Eval(b Binding) (rdf2go.Term, error) {
+	v, err := e.e.Eval(b)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "!":
+		ebv, err := effectiveBoolean(v)
+		if err != nil {
+			return nil, err
+		}
+		return boolTerm(!ebv), nil
+	case "-":
+		f, ok := numeric(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %s", v)
+		}
+		return numberTerm(-f), nil
+	}
+	panic("unknown unary operator " + e.op)
+}
+
+type binaryExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e *binaryExpr) Eval(b Binding) (rdf2go.Term, error) {
+	switch e.op {
+	case "||", "&&":
+		// errors are handled as in SPARQL: true || error is true, false && error is false
+		l, lErr := evalBoolean(e.left, b)
+		r, rErr := evalBoolean(e.right, b)
+		if e.op == "||" {
+			if (lErr == nil && l) || (rErr == nil && r) {
+				return boolTerm(true), nil
+			}
+		} else {
+			if (lErr == nil && !l) || (rErr == nil && !r) {
+				return boolTerm(false), nil
+			}
+		}
+		if lErr != nil {
+			return nil, lErr
+		}
+		if rErr != nil {
+			return nil, rErr
+		}
+		return boolTerm(e.op == "&&"), nil
+	}
+	l, err := e.left.Eval(b)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.right.Eval(b)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "+", "-":
+		lf, lok := numeric(l)
+		rf, rok := numeric(r)
+		if !lok || !rok {
+			return nil, fmt.Errorf("%s %s %s: not numeric", l, e.op, r)
+		}
+		if e.op == "+" {
+			return numberTerm(lf + rf), nil
+		}
+		return numberTerm(lf - rf), nil
+	case "=":
+		return boolTerm(compare(l, r) == 0), nil
+	case "!=":
+		return boolTerm(compare(l, r) != 0), nil
+	case "<":
+		return boolTerm(compare(l, r) < 0), nil
+	case ">":
+		return boolTerm(compare(l, r) > 0), nil
+	case "<=":
+		return boolTerm(compare(l, r) <= 0), nil
+	case ">=":
+		return boolTerm(compare(l, r) >= 0), nil
+	}
+	panic("unknown binary operator " + e.op)
+}
+
+type function struct {
+	minArgs, maxArgs int
+	// fn receives unevaluated arguments so that bound() can inspect variables.
+	fn func(b Binding, args []Expr) (rdf2go.Term, error)
+}
+
+type callExpr struct {
+	name string
+	fn   function
+	args []Expr
+}
+
+func (e *callExpr) Eval(b Binding) (rdf2go.Term, error) {
+	return e.fn.fn(b, e.args)
+}
+
+func stringFunction(f func(s string) rdf2go.Term) function {
+	return function{1, 1, func(b Binding, args []Expr) (rdf2go.Term, error) {
+		v, err := args[0].Eval(b)
+		if err != nil {
+			return nil, err
+		}
+		return f(v.RawValue()), nil
+	}}
+}
+
+func stringPairFunction(f func(a, b string) bool) function {
+	return function{2, 2, func(b Binding, args []Expr) (rdf2go.Term, error) {
+		x, err := args[0].Eval(b)
+		if err != nil {
+			return nil, err
+		}
+		y, err := args[1].Eval(b)
+		if err != nil {
+			return nil, err
+		}
+		return boolTerm(f(x.RawValue(), y.RawValue())), nil
+	}}
+}
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"bound": {1, 1, func(b Binding, args []Expr) (rdf2go.Term, error) {
+			v, ok := args[0].(varExpr)
+			if !ok {
+				return nil, errors.New("bound takes a variable")
+			}
+			_, bound := b[string(v)]
+			return boolTerm(bound), nil
+		}},
+		"str": stringFunction(func(s string) rdf2go.Term {
+			return rdf2go.NewLiteral(s)
+		}),
+		"lcase": stringFunction(func(s string) rdf2go.Term {
+			return rdf2go.NewLiteral(strings.ToLower(s))
+		}),
+		"ucase": stringFunction(func(s string) rdf2go.Term {
+			return rdf2go.NewLiteral(strings.ToUpper(s))
+		}),
+		"strlen": stringFunction(func(s string) rdf2go.Term {
+			return numberTerm(float64(len([]rune(s))))
+		}),
+		"contains":  stringPairFunction(strings.Contains),
+		"strstarts": stringPairFunction(strings.HasPrefix),
+		"strends":   stringPairFunction(strings.HasSuffix),
+		"isiri": {1, 1, func(b Binding, args []Expr) (rdf2go.Term, error) {
+			v, err := args[0].Eval(b)
+			if err != nil {
+				return nil, err
+			}
+			_, ok := v.(*rdf2go.Resource)
+			return boolTerm(ok), nil
+		}},
+		"isliteral": {1, 1, func(b Binding, args []Expr) (rdf2go.Term, error) {
+			v, err := args[0].Eval(b)
+			if err != nil {
+				return nil, err
+			}
+			_, ok := v.(*rdf2go.Literal)
+			return boolTerm(ok), nil
+		}},
+		"regex": {2, 3, func(b Binding, args []Expr) (rdf2go.Term, error) {
+			v, err := args[0].Eval(b)
+			if err != nil {
+				return nil, err
+			}
+			pattern, err := args[1].Eval(b)
+			if err != nil {
+				return nil, err
+			}
+			expr := pattern.RawValue()
+			if len(args) == 3 {
+				flags, err := args[2].Eval(b)
+				if err != nil {
+					return nil, err
+				}
+				if flags.RawValue() != "" {
+					expr = "(?" + flags.RawValue() + ")" + expr
+				}
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, err
+			}
+			return boolTerm(re.MatchString(v.RawValue())), nil
+		}},
+	}
+}
+
+func boolTerm(b bool) rdf2go.Term {
+	return rdf2go.NewLiteralWithDatatype(strconv.FormatBool(b), rdf2go.NewResource(xsdBooleanURI))
+}
+
+func numberTerm(f float64) rdf2go.Term {
+	if f == float64(int64(f)) {
+		return rdf2go.NewLiteralWithDatatype(strconv.FormatInt(int64(f), 10), rdf2go.NewResource(xsdIntegerURI))
+	}
+	return rdf2go.NewLiteralWithDatatype(strconv.FormatFloat(f, 'f', -1, 64), rdf2go.NewResource(xsdDecimalURI))
+}
+
+func datatype(t rdf2go.Term) string {
+	l, ok := t.(*rdf2go.Literal)
+	if !ok || l.Datatype == nil {
+		return ""
+	}
+	return l.Datatype.RawValue()
+}
+
+func numeric(t rdf2go.Term) (float64, bool) {
+	switch datatype(t) {
+	case xsdIntegerURI, xsdDecimalURI, xsdDoubleURI:
+		f, err := strconv.ParseFloat(t.RawValue(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func effectiveBoolean(t rdf2go.Term) (bool, error) {
+	if datatype(t) == xsdBooleanURI {
+		return t.RawValue() == "true", nil
+	}
+	if f, ok := numeric(t); ok {
+		return f != 0, nil
+	}
+	if _, ok := t.(*rdf2go.Literal); ok {
+		return t.RawValue() != "", nil
+	}
+	return false, fmt.Errorf("%s has no boolean value", t)
+}
+
+func evalBoolean(e Expr, b Binding) (bool, error) {
+	v, err := e.Eval(b)
+	if err != nil {
+		return false, err
+	}
+	return effectiveBoolean(v)
+}
+
+// compare orders terms: numbers numerically, dateTimes chronologically and everything else by lexical form.
+// Unbound (nil) terms sort first.
+func compare(a, b rdf2go.Term) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if af, ok := numeric(a); ok {
+		if bf, ok := numeric(b); ok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	if datatype(a) == xsdDateTime && datatype(b) == xsdDateTime {
+		at, aErr := time.Parse(time.RFC3339, a.RawValue())
+		bt, bErr := time.Parse(time.RFC3339, b.RawValue())
+		if aErr == nil && bErr == nil {
+			return at.Compare(bt)
+		}
+	}
+	return strings.Compare(a.RawValue(), b.RawValue())
+}
+
+// Result is the result of a query.
+// For SELECT, Variables and Bindings are set; for ASK, Boolean is.
+type Result struct {
+	Form      Form
+	Variables []string
+	Bindings  []Binding
+	Boolean   bool
+}
+
+// Execute runs q against the index.
+func (ix *Index) Execute(q *Query) Result {
+	bindings := []Binding{{}}
+	for _, p := range orderPatterns(q.Patterns) {
+		var next []Binding
+		for _, b := range bindings {
+			next = append(next, ix.match(p, b)...)
+		}
+		bindings = next
+		if len(bindings) == 0 {
+			break
+		}
+	}
+	filtered := bindings[:0]
+	for _, b := range bindings {
+		keep := true
+		for _, f := range q.Filters {
+			ok, err := evalBoolean(f, b)
+			if err != nil || !ok {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			filtered = append(filtered, b)
+		}
+	}
+	bindings = filtered
+
+	if q.Form == FormAsk {
+		return Result{Form: FormAsk, Boolean: len(bindings) > 0}
+	}
+
+	if len(q.OrderBy) != 0 {
+		sort.SliceStable(bindings, func(i, j int) bool {
+			for _, cond := range q.OrderBy {
+				a, _ := cond.Expr.Eval(bindings[i])
+				b, _ := cond.Expr.Eval(bindings[j])
+				c := compare(a, b)
+				if c == 0 {
+					continue
+				}
+				if cond.Descending {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	vars := q.Variables
+	if vars == nil {
+		vars = patternVariables(q.Patterns)
+	}
+	projected := make([]Binding, 0, len(bindings))
+	seen := map[string]bool{}
+	for _, b := range bindings {
+		p := Binding{}
+		var key strings.Builder
+		for _, v := range vars {
+			if t, ok := b[v]; ok {
+				p[v] = t
+				key.WriteString(t.String())
+			}
+			key.WriteByte(0)
+		}
+		if q.Distinct {
+			if seen[key.String()] {
+				continue
+			}
+			seen[key.String()] = true
+		}
+		projected = append(projected, p)
+	}
+	if q.Offset >= len(projected) {
+		projected = nil
+	} else {
+		projected = projected[q.Offset:]
+	}
+	if q.Limit >= 0 && q.Limit < len(projected) {
+		projected = projected[:q.Limit]
+	}
+	return Result{Form: FormSelect, Variables: vars, Bindings: projected}
+}
+
+// orderPatterns puts patterns with a constant predicate first, as the index can look those up directly.
+func orderPatterns(patterns []Pattern) []Pattern {
+	ordered := make([]Pattern, len(patterns))
+	copy(ordered, patterns)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].P.Term != nil && ordered[j].P.Term == nil
+	})
+	return ordered
+}
+
+func patternVariables(patterns []Pattern) []string {
+	var vars []string
+	seen := map[string]bool{}
+	for _, p := range patterns {
+		for _, n := range []Node{p.S, p.P, p.O} {
+			if n.Var != "" && !seen[n.Var] {
+				seen[n.Var] = true
+				vars = append(vars, n.Var)
+			}
+		}
+	}
+	return vars
+}
@@ -0,0 +1,88 @@
+package sparql
+
+import (
+	"github.com/deiu/rdf2go"
+)
+
+type triple struct {
+	s, p, o rdf2go.Term
+}
+
+// Index is an immutable in-memory triple store that queries are executed against.
+type Index struct {
+	triples     []triple
+	byPredicate map[string][]triple
+}
+
+// NewIndex copies the triples in g into a new index.
+func NewIndex(g *rdf2go.Graph) *Index {
+	ix := &Index{byPredicate: map[string][]triple{}}
+	for t := range g.IterTriples() {
+		p := t.Predicate
+		// rdf.Serializer writes rdf:type unexpanded
+		if p.RawValue() == "rdf:type" {
+			p = rdf2go.NewResource(rdfTypeURI)
+		}
+		tr := triple{t.Subject, p, t.Object}
+		ix.triples = append(ix.triples, tr)
+		ix.byPredicate[p.RawValue()] = append(ix.byPredicate[p.RawValue()], tr)
+	}
+	return ix
+}
+
+// Len returns the number of triples in the index.
+func (ix *Index) Len() int {
+	return len(ix.triples)
+}
+
+// resolve returns the term n refers to under b, or nil if n is an unbound variable.
+func resolve(n Node, b Binding) rdf2go.Term {
+	if n.Var == "" {
+		return n.Term
+	}
+	return b[n.Var]
+}
+
+// match returns b extended with each way p can match a triple in the index.
+func (ix *Index) match(p Pattern, b Binding) []Binding {
+	s := resolve(p.S, b)
+	pred := resolve(p.P, b)
+	o := resolve(p.O, b)
+	candidates := ix.triples
+	if pred != nil {
+		candidates = ix.byPredicate[pred.RawValue()]
+	}
+	var result []Binding
+	for _, t := range candidates {
+		if s != nil && !s.Equal(t.s) {
+			continue
+		}
+		if pred != nil && !pred.Equal(t.p) {
+			continue
+		}
+		if o != nil && !o.Equal(t.o) {
+			continue
+		}
+		nb := make(Binding, len(b)+3)
+		for k, v := range b {
+			nb[k] = v
+		}
+		if !bind(nb, p.S, t.s) || !bind(nb, p.P, t.p) || !bind(nb, p.O, t.o) {
+			continue
+		}
+		result = append(result, nb)
+	}
+	return result
+}
+
+// bind binds n to t if n is a variable; it returns false if the variable is already bound to a different term (e.g. ?x ?p ?x).
+func bind(b Binding, n Node, t rdf2go.Term) bool {
+	if n.Var == "" {
+		return true
+	}
+	if existing, ok := b[n.Var]; ok {
+		return existing.Equal(t)
+	}
+	b[n.Var] = t
+	return true
+}
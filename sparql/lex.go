@@ -0,0 +1,172 @@
+package sparql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIRI
+	tokenPName
+	tokenVar
+	tokenString
+	tokenNumber
+	tokenIdent
+	tokenLang
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q at %d", t.value, t.pos)
+}
+
+// punctuation is ordered so that longer operators are matched first.
+var punctuation = []string{"^^", "&&", "||", "!=", "<=", ">=", "{", "}", "(", ")", ".", ";", ",", "*", "=", "<", ">", "!", "+", "-", "/"}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '<' && isIRIStart(src[i:]):
+			end := strings.IndexByte(src[i:], '>')
+			tokens = append(tokens, token{tokenIRI, src[i+1 : i+end], i})
+			i += end + 1
+		case c == '?' || c == '$':
+			j := i + 1
+			for j < len(src) && isNameChar(rune(src[j])) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("empty variable name at %d", i)
+			}
+			tokens = append(tokens, token{tokenVar, src[i+1 : j], i})
+			i = j
+		case c == '"' || c == '\'':
+			value, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("string at %d: %w", i, err)
+			}
+			tokens = append(tokens, token{tokenString, value, i})
+			i += n
+		case c == '@':
+			j := i + 1
+			for j < len(src) && (isNameChar(rune(src[j])) || src[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, token{tokenLang, src[i+1 : j], i})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.' && j+1 < len(src) && unicode.IsDigit(rune(src[j+1]))) {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:j], i})
+			i = j
+		case isNameStart(c):
+			j := i
+			for j < len(src) && (isNameChar(rune(src[j])) || src[j] == '-') {
+				j++
+			}
+			if j < len(src) && src[j] == ':' {
+				j++
+				for j < len(src) && (isNameChar(rune(src[j])) || src[j] == '-' || src[j] == '.' && j+1 < len(src) && isNameChar(rune(src[j+1]))) {
+					j++
+				}
+				tokens = append(tokens, token{tokenPName, src[i:j], i})
+			} else {
+				tokens = append(tokens, token{tokenIdent, src[i:j], i})
+			}
+			i = j
+		case c == ':':
+			// prefixed name with the empty prefix
+			j := i + 1
+			for j < len(src) && (isNameChar(rune(src[j])) || src[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, token{tokenPName, src[i:j], i})
+			i = j
+		default:
+			matched := false
+			for _, p := range punctuation {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, token{tokenPunct, p, i})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(src)})
+	return tokens, nil
+}
+
+// isIRIStart reports whether s (starting with '<') is an IRI reference rather than a less-than operator.
+func isIRIStart(s string) bool {
+	end := strings.IndexByte(s, '>')
+	if end == -1 {
+		return false
+	}
+	return !strings.ContainsAny(s[1:end], " \t\n\"{}|^`\\")
+}
+
+func isNameStart(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
+}
+
+func isNameChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
+
+func lexString(src string) (value string, n int, err error) {
+	quote := src[0]
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(src) {
+				return "", 0, fmt.Errorf("unterminated escape")
+			}
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(src[i])
+			}
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated")
+}
@@ -0,0 +1,509 @@
+package sparql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/deiu/rdf2go"
+)
+
+const (
+	rdfTypeURI    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+	xsdNS         = "http://www.w3.org/2001/XMLSchema#"
+	xsdBooleanURI = xsdNS + "boolean"
+	xsdIntegerURI = xsdNS + "integer"
+	xsdDecimalURI = xsdNS + "decimal"
+	xsdDoubleURI  = xsdNS + "double"
+	xsdStringURI  = xsdNS + "string"
+	xsdDateTime   = xsdNS + "dateTime"
+)
+
+type Form int
+
+const (
+	FormSelect Form = iota
+	FormAsk
+)
+
+// Query is a parsed SELECT or ASK query.
+// Only basic graph patterns, FILTER, ORDER BY, LIMIT and OFFSET are supported.
+type Query struct {
+	Form     Form
+	Distinct bool
+	// Variables is nil for SELECT *.
+	Variables []string
+	Patterns  []Pattern
+	Filters   []Expr
+	OrderBy   []OrderCondition
+	// Limit is negative if there is no limit.
+	Limit  int
+	Offset int
+}
+
+// Node is either a variable or a constant term in a triple pattern.
+type Node struct {
+	// Var is the variable name without the leading ? or $, or "" if Term is set.
+	Var  string
+	Term rdf2go.Term
+}
+
+type Pattern struct {
+	S, P, O Node
+}
+
+type OrderCondition struct {
+	Expr       Expr
+	Descending bool
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	prefixes map[string]string
+}
+
+var defaultPrefixes = map[string]string{
+	"rdf": "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+	"xsd": xsdNS,
+}
+
+// Parse parses a SPARQL query.
+// The prefixes rdf: and xsd: are predeclared, as well as any in prefixes (e.g. jks:).
+func Parse(src string, prefixes map[string]string) (*Query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, prefixes: map[string]string{}}
+	for k, v := range defaultPrefixes {
+		p.prefixes[k] = v
+	}
+	for k, v := range prefixes {
+		p.prefixes[k] = v
+	}
+	return p.query()
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.value, keyword)
+}
+
+func (p *parser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.value == punct
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.isKeyword(keyword) {
+		return fmt.Errorf("expected %s, got %s", keyword, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.isPunct(punct) {
+		return fmt.Errorf("expected %q, got %s", punct, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) query() (*Query, error) {
+	for p.isKeyword("PREFIX") {
+		p.next()
+		name := p.next()
+		if name.kind != tokenPName || !strings.HasSuffix(name.value, ":") {
+			return nil, fmt.Errorf("expected prefix name, got %s", name)
+		}
+		iri := p.next()
+		if iri.kind != tokenIRI {
+			return nil, fmt.Errorf("expected IRI, got %s", iri)
+		}
+		p.prefixes[strings.TrimSuffix(name.value, ":")] = iri.value
+	}
+	q := &Query{Limit: -1}
+	switch {
+	case p.isKeyword("SELECT"):
+		p.next()
+		q.Form = FormSelect
+		if p.isKeyword("DISTINCT") {
+			p.next()
+			q.Distinct = true
+		}
+		if p.isPunct("*") {
+			p.next()
+		} else {
+			for p.peek().kind == tokenVar {
+				q.Variables = append(q.Variables, p.next().value)
+			}
+			if len(q.Variables) == 0 {
+				return nil, fmt.Errorf("expected variables or *, got %s", p.peek())
+			}
+		}
+		if p.isKeyword("WHERE") {
+			p.next()
+		}
+	case p.isKeyword("ASK"):
+		p.next()
+		q.Form = FormAsk
+		if p.isKeyword("WHERE") {
+			p.next()
+		}
+	default:
+		return nil, fmt.Errorf("expected SELECT or ASK, got %s", p.peek())
+	}
+	err := p.groupGraphPattern(q)
+	if err != nil {
+		return nil, err
+	}
+	if p.isKeyword("ORDER") {
+		p.next()
+		err = p.expectKeyword("BY")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			var cond OrderCondition
+			switch {
+			case p.isKeyword("ASC") || p.isKeyword("DESC"):
+				cond.Descending = p.isKeyword("DESC")
+				p.next()
+				err = p.expectPunct("(")
+				if err != nil {
+					return nil, err
+				}
+				cond.Expr, err = p.expr()
+				if err != nil {
+					return nil, err
+				}
+				err = p.expectPunct(")")
+				if err != nil {
+					return nil, err
+				}
+			case p.peek().kind == tokenVar:
+				cond.Expr = varExpr(p.next().value)
+			case p.isPunct("("):
+				cond.Expr, err = p.primary()
+				if err != nil {
+					return nil, err
+				}
+			default:
+				if len(q.OrderBy) == 0 {
+					return nil, fmt.Errorf("expected order condition, got %s", p.peek())
+				}
+			}
+			if cond.Expr == nil {
+				break
+			}
+			q.OrderBy = append(q.OrderBy, cond)
+		}
+	}
+	for p.isKeyword("LIMIT") || p.isKeyword("OFFSET") {
+		isLimit := p.isKeyword("LIMIT")
+		p.next()
+		t := p.next()
+		n, err := strconv.Atoi(t.value)
+		if t.kind != tokenNumber || err != nil {
+			return nil, fmt.Errorf("expected integer, got %s", t)
+		}
+		if isLimit {
+			q.Limit = n
+		} else {
+			q.Offset = n
+		}
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s", p.peek())
+	}
+	return q, nil
+}
+
+func (p *parser) groupGraphPattern(q *Query) error {
+	err := p.expectPunct("{")
+	if err != nil {
+		return err
+	}
+	for !p.isPunct("}") {
+		if p.isKeyword("FILTER") {
+			p.next()
+			var e Expr
+			if p.isPunct("(") {
+				e, err = p.primary()
+			} else {
+				e, err = p.call()
+			}
+			if err != nil {
+				return err
+			}
+			q.Filters = append(q.Filters, e)
+			if p.isPunct(".") {
+				p.next()
+			}
+			continue
+		}
+		err = p.triplesSameSubject(q)
+		if err != nil {
+			return err
+		}
+		if p.isPunct(".") {
+			p.next()
+		} else if !p.isPunct("}") && !p.isKeyword("FILTER") {
+			return fmt.Errorf("expected \".\" or \"}\", got %s", p.peek())
+		}
+	}
+	p.next()
+	return nil
+}
+
+// triplesSameSubject parses a subject followed by predicate-object lists separated by ";" and ",".
+func (p *parser) triplesSameSubject(q *Query) error {
+	s, err := p.node()
+	if err != nil {
+		return err
+	}
+	for {
+		var pred Node
+		if p.isKeyword("a") {
+			p.next()
+			pred = Node{Term: rdf2go.NewResource(rdfTypeURI)}
+		} else {
+			pred, err = p.node()
+			if err != nil {
+				return err
+			}
+		}
+		for {
+			o, err := p.node()
+			if err != nil {
+				return err
+			}
+			q.Patterns = append(q.Patterns, Pattern{s, pred, o})
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		if !p.isPunct(";") {
+			return nil
+		}
+		p.next()
+		if p.isPunct(".") || p.isPunct("}") {
+			return nil
+		}
+	}
+}
+
+func (p *parser) node() (Node, error) {
+	t := p.peek()
+	if t.kind == tokenVar {
+		p.next()
+		return Node{Var: t.value}, nil
+	}
+	term, err := p.term()
+	if err != nil {
+		return Node{}, err
+	}
+	return Node{Term: term}, nil
+}
+
+func (p *parser) term() (rdf2go.Term, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenIRI:
+		return rdf2go.NewResource(t.value), nil
+	case tokenPName:
+		iri, err := p.expand(t.value)
+		if err != nil {
+			return nil, err
+		}
+		return rdf2go.NewResource(iri), nil
+	case tokenString:
+		switch {
+		case p.peek().kind == tokenLang:
+			return rdf2go.NewLiteralWithLanguage(t.value, p.next().value), nil
+		case p.isPunct("^^"):
+			p.next()
+			dt, err := p.term()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := dt.(*rdf2go.Resource); !ok {
+				return nil, fmt.Errorf("datatype must be an IRI")
+			}
+			return rdf2go.NewLiteralWithDatatype(t.value, dt), nil
+		default:
+			return rdf2go.NewLiteral(t.value), nil
+		}
+	case tokenNumber:
+		if strings.Contains(t.value, ".") {
+			return rdf2go.NewLiteralWithDatatype(t.value, rdf2go.NewResource(xsdDecimalURI)), nil
+		}
+		return rdf2go.NewLiteralWithDatatype(t.value, rdf2go.NewResource(xsdIntegerURI)), nil
+	case tokenIdent:
+		if t.value == "true" || t.value == "false" {
+			return rdf2go.NewLiteralWithDatatype(t.value, rdf2go.NewResource(xsdBooleanURI)), nil
+		}
+	}
+	return nil, fmt.Errorf("expected term, got %s", t)
+}
+
+func (p *parser) expand(pname string) (string, error) {
+	prefix, local, _ := strings.Cut(pname, ":")
+	ns, ok := p.prefixes[prefix]
+	if !ok {
+		return "", fmt.Errorf("undeclared prefix %q", prefix)
+	}
+	return ns + local, nil
+}
+
+// expr parses an expression with the usual precedence: || < && < comparison < additive < unary.
+func (p *parser) expr() (Expr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("||") {
+		p.next()
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) andExpr() (Expr, error) {
+	left, err := p.relExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("&&") {
+		p.next()
+		right, err := p.relExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) relExpr() (Expr, error) {
+	left, err := p.addExpr()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "!=", "<", ">", "<=", ">="} {
+		if p.isPunct(op) {
+			p.next()
+			right, err := p.addExpr()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) addExpr() (Expr, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("+") || p.isPunct("-") {
+		op := p.next().value
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unaryExpr() (Expr, error) {
+	if p.isPunct("!") || p.isPunct("-") {
+		op := p.next().value
+		e, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op, e}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenPunct && t.value == "(":
+		p.next()
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectPunct(")")
+	case t.kind == tokenVar:
+		p.next()
+		return varExpr(t.value), nil
+	case t.kind == tokenIdent && t.value != "true" && t.value != "false":
+		return p.call()
+	default:
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		return constExpr{term}, nil
+	}
+}
+
+func (p *parser) call() (Expr, error) {
+	name := p.next()
+	if name.kind != tokenIdent {
+		return nil, fmt.Errorf("expected function name, got %s", name)
+	}
+	fn, ok := functions[strings.ToLower(name.value)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	err := p.expectPunct("(")
+	if err != nil {
+		return nil, err
+	}
+	var args []Expr
+	for !p.isPunct(")") {
+		if len(args) != 0 {
+			err = p.expectPunct(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) < fn.minArgs || len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("%s takes %d to %d arguments, got %d", name.value, fn.minArgs, fn.maxArgs, len(args))
+	}
+	return &callExpr{strings.ToLower(name.value), fn, args}, nil
+}
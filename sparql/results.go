@@ -0,0 +1,66 @@
+package sparql
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/deiu/rdf2go"
+)
+
+// ResultsJSONType is the MIME type written by WriteJSON.
+const ResultsJSONType = "application/sparql-results+json"
+
+type jsonTerm struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Datatype string `json:"datatype,omitempty"`
+	Lang     string `json:"xml:lang,omitempty"`
+}
+
+type jsonResults struct {
+	Head struct {
+		Vars []string `json:"vars,omitempty"`
+	} `json:"head"`
+	Results *struct {
+		Bindings []map[string]jsonTerm `json:"bindings"`
+	} `json:"results,omitempty"`
+	Boolean *bool `json:"boolean,omitempty"`
+}
+
+func toJSONTerm(t rdf2go.Term) jsonTerm {
+	switch t := t.(type) {
+	case *rdf2go.Resource:
+		return jsonTerm{Type: "uri", Value: t.URI}
+	case *rdf2go.BlankNode:
+		return jsonTerm{Type: "bnode", Value: t.ID}
+	case *rdf2go.Literal:
+		jt := jsonTerm{Type: "literal", Value: t.Value, Lang: t.Language}
+		if t.Datatype != nil {
+			jt.Datatype = t.Datatype.RawValue()
+		}
+		return jt
+	}
+	return jsonTerm{Type: "literal", Value: t.RawValue()}
+}
+
+// WriteJSON writes r in the SPARQL 1.1 Query Results JSON Format.
+func (r Result) WriteJSON(w io.Writer) error {
+	var jr jsonResults
+	if r.Form == FormAsk {
+		b := r.Boolean
+		jr.Boolean = &b
+	} else {
+		jr.Head.Vars = r.Variables
+		jr.Results = &struct {
+			Bindings []map[string]jsonTerm `json:"bindings"`
+		}{Bindings: make([]map[string]jsonTerm, len(r.Bindings))}
+		for i, b := range r.Bindings {
+			jb := map[string]jsonTerm{}
+			for k, t := range b {
+				jb[k] = toJSONTerm(t)
+			}
+			jr.Results.Bindings[i] = jb
+		}
+	}
+	return json.NewEncoder(w).Encode(jr)
+}
@@ -0,0 +1,115 @@
+package sparql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/deiu/rdf2go"
+)
+
+const ex = "https://example.com/"
+
+func testIndex() *Index {
+	g := rdf2go.NewGraph(ex)
+	dt := rdf2go.NewResource(xsdDateTime)
+	for _, t := range []struct {
+		id, title, due string
+	}{
+		{"1", "hw1", "2025-01-01T00:00:00Z"},
+		{"2", "hw2", "2025-02-01T00:00:00Z"},
+		{"3", "reading", "2025-01-15T00:00:00-05:00"},
+	} {
+		s := rdf2go.NewResource(ex + "tasks/" + t.id)
+		g.AddTriple(s, rdf2go.NewResource("rdf:type"), rdf2go.NewResource(ex+"Task"))
+		g.AddTriple(s, rdf2go.NewResource(ex+"quickTitle"), rdf2go.NewLiteral(t.title))
+		g.AddTriple(s, rdf2go.NewResource(ex+"due"), rdf2go.NewLiteralWithDatatype(t.due, dt))
+	}
+	a := rdf2go.NewResource(ex + "activities/1")
+	g.AddTriple(a, rdf2go.NewResource("rdf:type"), rdf2go.NewResource(ex+"Activity"))
+	g.AddTriple(a, rdf2go.NewResource(ex+"forTask"), rdf2go.NewResource(ex+"tasks/2"))
+	return NewIndex(g)
+}
+
+func run(t *testing.T, src string) Result {
+	t.Helper()
+	q, err := Parse(src, map[string]string{"ex": ex})
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	return testIndex().Execute(q)
+}
+
+func titles(r Result) string {
+	var s []string
+	for _, b := range r.Bindings {
+		s = append(s, b["title"].RawValue())
+	}
+	return strings.Join(s, ",")
+}
+
+func TestSelectOrderBy(t *testing.T) {
+	r := run(t, `SELECT ?title WHERE { ?t a ex:Task ; ex:quickTitle ?title ; ex:due ?due } ORDER BY DESC(?due)`)
+	if got := titles(r); got != "hw2,reading,hw1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	r := run(t, `
+PREFIX x: <https://example.com/>
+SELECT ?title WHERE {
+  ?t x:quickTitle ?title .
+  ?t x:due ?due .
+  FILTER (regex(?title, "^HW", "i") && ?due < "2025-01-20T00:00:00Z"^^xsd:dateTime)
+}`)
+	if got := titles(r); got != "hw1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	r := run(t, `SELECT ?title { ?a a ex:Activity . ?a ex:forTask ?t . ?t ex:quickTitle ?title }`)
+	if got := titles(r); got != "hw2" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestAsk(t *testing.T) {
+	r := run(t, `ASK { ?t ex:quickTitle "reading" }`)
+	if !r.Boolean {
+		t.Fatal("expected true")
+	}
+	r = run(t, `ASK { ?t ex:quickTitle "writing" }`)
+	if r.Boolean {
+		t.Fatal("expected false")
+	}
+}
+
+func TestLimitOffsetJSON(t *testing.T) {
+	r := run(t, `SELECT ?title { ?t ex:quickTitle ?title } ORDER BY ?title LIMIT 1 OFFSET 1`)
+	var buf bytes.Buffer
+	err := r.WriteJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"head":{"vars":["title"]},"results":{"bindings":[{"title":{"type":"literal","value":"hw2"}}]}}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("got %s", buf.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		`SELECT WHERE { ?s ?p ?o }`,
+		`SELECT ?s { ?s unknown:p ?o }`,
+		`SELECT ?s { ?s ?p ?o `,
+		`DELETE { ?s ?p ?o }`,
+		`SELECT ?s { ?s ?p ?o FILTER(nosuchfn(?s)) }`,
+	} {
+		_, err := Parse(src, nil)
+		if err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+import "time"
+
+// Calendar is a named set of date ranges (e.g. a semester's breaks) on which recurrences that refer to it have no occurrences.
+type Calendar struct {
+	ID     int64
+	Name   string
+	Ranges []DateRange
+}
+
+// DateRange is the days from Start to End, inclusive.
+// Only the dates of Start and End are used.
+type DateRange struct {
+	Start   time.Time
+	End     time.Time
+	Summary string
+}
+
+// Contains returns whether the date of t, in its own time zone, is in the range.
+func (r DateRange) Contains(t time.Time) bool {
+	day := t.Format(time.DateOnly)
+	return r.Start.Format(time.DateOnly) <= day && day <= r.End.Format(time.DateOnly)
+}
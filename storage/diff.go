@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ChangedFields returns the names of the fields that differ between a and b.
+// T must be a struct type. Times are compared using time.Time.Equal, so the same instant in different locations is not a change.
+// Version fields are bookkeeping for ErrConflict, and are never reported.
+func ChangedFields[T any](a, b T) []string {
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	var fields []string
+	for i := 0; i < va.NumField(); i++ {
+		if !va.Type().Field(i).IsExported() || va.Type().Field(i).Name == "Version" {
+			continue
+		}
+		if !fieldEqual(va.Field(i), vb.Field(i)) {
+			fields = append(fields, va.Type().Field(i).Name)
+		}
+	}
+	return fields
+}
+
+func fieldEqual(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Pointer {
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return fieldEqual(a.Elem(), b.Elem())
+	}
+	if a.Type() == timeType {
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
@@ -0,0 +1,40 @@
+package storage
+
+import "time"
+
+// Access is what a Grant lets its grantee do.
+type Access string
+
+const (
+	// AccessRead lets the grantee see the tasks and their activities.
+	AccessRead Access = "read"
+	// AccessLog also lets the grantee log activities on the tasks.
+	AccessLog Access = "log"
+)
+
+// Allows returns whether a is at least as much access as b.
+func (a Access) Allows(b Access) bool {
+	switch b {
+	case AccessRead:
+		return a == AccessRead || a == AccessLog
+	case AccessLog:
+		return a == AccessLog
+	default:
+		return false
+	}
+}
+
+// Grant shares some of its owner's tasks with another user.
+type Grant struct {
+	ID int64
+	// Owner is the owner (see WithOwner) of the shared tasks.
+	Owner string
+	// Grantee is the name of the user the tasks are shared with (see User.Name).
+	Grantee string
+	// TaskID is the shared task, or 0 if Tag is set.
+	TaskID int64
+	// Tag shares every task with the tag, or is "" if TaskID is set.
+	Tag     string
+	Access  Access
+	Created time.Time
+}
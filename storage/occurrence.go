@@ -0,0 +1,13 @@
+package storage
+
+import "time"
+
+// Occurrence records the task generated for an occurrence of a recurrence rule.
+// Rule and Time together are the occurrence key, so generating the same occurrence again updates its task instead of adding another.
+type Occurrence struct {
+	Rule   string
+	Time   time.Time
+	TaskID int64
+	// PlanID is zero if no plan was added for the occurrence.
+	PlanID int64
+}
@@ -0,0 +1,19 @@
+package storage
+
+import "time"
+
+// Passkey is a WebAuthn credential, which logs in as the user who registered it.
+type Passkey struct {
+	ID   int64
+	Name string
+	// Provider and Login are those of the user who registered the passkey.
+	Provider string
+	Login    string
+	// UserHandle is the WebAuthn user handle of the user, which is the same for all of the user's passkeys.
+	UserHandle   []byte
+	CredentialID []byte
+	// Credential is the credential's public key and authenticator data, encoded by the auth package.
+	Credential []byte
+	Created    time.Time
+	LastUsed   *time.Time
+}
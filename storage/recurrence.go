@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recurrence is a task to add for each occurrence of a recurrence set, ahead of time.
+type Recurrence struct {
+	ID   int64
+	Name string
+	// Set is a recurrence set of DTSTART, RRULE, RDATE and EXDATE lines, as in RFC 5545.
+	Set string
+	// ExDays are days without occurrences; only their dates are used.
+	ExDays []time.Time
+	// CalendarIDs are the calendars whose ranges have no occurrences.
+	CalendarIDs []int64
+	// Task is the template of each occurrence's task. Only QuickTitle and Description are stored.
+	Task Task
+	// Plan is the template of a plan to add for each occurrence, or nil to add none.
+	Plan *PlanTemplate
+	// Active is false if no more occurrences should be generated.
+	Active bool
+}
+
+// OccurrenceRule is the Occurrence.Rule of the recurrence's occurrences.
+func (r Recurrence) OccurrenceRule() string {
+	return fmt.Sprintf("recurrence-%d", r.ID)
+}
+
+// PlanTemplate is a plan relative to the time of an occurrence of a recurrence.
+type PlanTemplate struct {
+	Location string
+	// TimeAtAfterOffset and TimeBeforeOffset are the plan's window, relative to the occurrence's time.
+	// For example, a lecture at 09:30 that should be attended from 09:30 to 10:45 has the offsets 0 and 75m.
+	TimeAtAfterOffset time.Duration
+	TimeBeforeOffset  time.Duration
+	DurationGe        time.Duration
+	DurationLt        time.Duration
+}
+
+// Plan returns the plan for the occurrence of the task at t.
+func (p PlanTemplate) Plan(taskID int64, t time.Time) Plan {
+	return Plan{
+		TaskID:      taskID,
+		Location:    p.Location,
+		TimeAtAfter: t.Add(p.TimeAtAfterOffset),
+		TimeBefore:  t.Add(p.TimeBeforeOffset),
+		DurationGe:  p.DurationGe,
+		DurationLt:  p.DurationLt,
+	}
+}
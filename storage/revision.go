@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const (
+	EntityTask     = "task"
+	EntityActivity = "activity"
+	EntityPlan     = "plan"
+)
+
+// Revision records one change to a task, activity or plan.
+// Revisions are append-only; reverting a change adds a new revision.
+type Revision struct {
+	ID       int64
+	Entity   string
+	EntityID int64
+	Time     time.Time
+	// Author is the user that made the change, as given by WithAuthor.
+	Author string
+	// Fields lists the fields that changed. For the revisions that added or deleted the row, it lists all fields except ID and Version.
+	Fields []string
+	// Before and After are JSON encodings of the Task, Activity or Plan.
+	// Before is empty for the revision that added the row, and After is empty for the one that deleted it.
+	Before []byte
+	After  []byte
+}
+
+// FieldChange is one changed field of a Revision, formatted for display.
+type FieldChange struct {
+	Name   string
+	Before string
+	After  string
+}
+
+// NewRevision makes a revision of entity from before to after, which must both be a Task, Activity or Plan.
+// before is nil for additions, and after is nil for deletions.
+// ID, Time and Author are left for the storage to fill in.
+func NewRevision[T any](entity string, id int64, before, after *T) (Revision, error) {
+	r := Revision{Entity: entity, EntityID: id}
+	var err error
+	if before != nil && after != nil {
+		r.Fields = ChangedFields(*before, *after)
+	} else {
+		t := reflect.TypeFor[T]()
+		for i := 0; i < t.NumField(); i++ {
+			if name := t.Field(i).Name; t.Field(i).IsExported() && name != "ID" && name != "Version" {
+				r.Fields = append(r.Fields, name)
+			}
+		}
+	}
+	if before != nil {
+		r.Before, err = json.Marshal(before)
+		if err != nil {
+			return Revision{}, err
+		}
+	}
+	if after != nil {
+		r.After, err = json.Marshal(after)
+		if err != nil {
+			return Revision{}, err
+		}
+	}
+	return r, nil
+}
+
+func (r Revision) value(raw []byte) (reflect.Value, error) {
+	var v any
+	switch r.Entity {
+	case EntityTask:
+		v = new(Task)
+	case EntityActivity:
+		v = new(Activity)
+	case EntityPlan:
+		v = new(Plan)
+	default:
+		return reflect.Value{}, fmt.Errorf("unknown entity %q", r.Entity)
+	}
+	if len(raw) != 0 {
+		err := json.Unmarshal(raw, v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return reflect.ValueOf(v).Elem(), nil
+}
+
+// AfterTask decodes After; Entity must be EntityTask.
+func (r Revision) AfterTask() (Task, error) {
+	var t Task
+	return t, json.Unmarshal(r.After, &t)
+}
+
+// AfterActivity decodes After; Entity must be EntityActivity.
+func (r Revision) AfterActivity() (Activity, error) {
+	var a Activity
+	return a, json.Unmarshal(r.After, &a)
+}
+
+// AfterPlan decodes After; Entity must be EntityPlan.
+func (r Revision) AfterPlan() (Plan, error) {
+	var p Plan
+	return p, json.Unmarshal(r.After, &p)
+}
+
+// Changes returns the old and new values of each field in Fields.
+func (r Revision) Changes() ([]FieldChange, error) {
+	before, err := r.value(r.Before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	after, err := r.value(r.After)
+	if err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+	changes := make([]FieldChange, 0, len(r.Fields))
+	for _, name := range r.Fields {
+		change := FieldChange{Name: name}
+		if len(r.Before) != 0 {
+			change.Before = formatField(before.FieldByName(name))
+		}
+		if len(r.After) != 0 {
+			change.After = formatField(after.FieldByName(name))
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func formatField(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "(none)"
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+type authorKey struct{}
+
+// WithAuthor returns a context that attributes changes made with it to author.
+func WithAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorKey{}, author)
+}
+
+// Author returns the author set by WithAuthor, or "" if there is none.
+func Author(ctx context.Context) string {
+	author, _ := ctx.Value(authorKey{}).(string)
+	return author
+}
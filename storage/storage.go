@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"net/url"
 	"time"
 
@@ -19,6 +20,8 @@ type Task struct {
 	// In the future, this may become a reference to another task, such that once that task is started, this task is useless to complete..
 	Deadline *time.Time
 	Due      *time.Time
+	// Version is incremented by every edit. See ErrConflict.
+	Version int64
 }
 
 type Activity struct {
@@ -29,6 +32,8 @@ type Activity struct {
 	TimeEnd   time.Time
 	Done      bool
 	Note      string
+	// Version is incremented by every edit. See ErrConflict.
+	Version int64
 }
 
 func (a Activity) Layout() (top int, height int) {
@@ -47,6 +52,8 @@ type Plan struct {
 	TimeBefore  time.Time
 	DurationGe  time.Duration
 	DurationLt  time.Duration
+	// Version is incremented by every edit. See ErrConflict.
+	Version int64
 }
 
 func (p Plan) Layout() (top int, height int) {
@@ -55,12 +62,25 @@ func (p Plan) Layout() (top int, height int) {
 	return int(start), int(end - start)
 }
 
+// ErrConflict is returned by TaskEdit, ActivityEdit and PlanEdit when the Version passed is not the current version of the row, i.e. the row was edited after it was read.
+// A Version of zero skips this check, and overwrites the row regardless.
+var ErrConflict = errors.New("edit conflict: row was changed since it was read")
+
+// ErrHasActivities is returned by TaskDelete when the task has activities, which would be lost.
+var ErrHasActivities = errors.New("task has activities")
+
+// Storage stores the rows of each owner separately: only the rows owned by the owner of the context passed (see WithOwner) are seen, edited or deleted, and rows added are owned by it.
 type Storage interface {
+	// ActivityAdd adds a new activity; a.ID is ignored.
 	ActivityAdd(a Activity, ctx context.Context) (id int64, err error)
+	// ActivityRestore adds a deleted activity back with its ID a.ID, e.g. to undo ActivityDelete.
+	ActivityRestore(a Activity, ctx context.Context) error
 	ActivityLatestN(ctx context.Context, n int) ([]Activity, error)
 	ActivityGet(id int64, ctx context.Context) (Activity, error)
 	ActivityRange(a, b time.Time, ctx context.Context) (Window[Activity], error)
 	ActivityEdit(a Activity, ctx context.Context) error
+	// ActivityDelete deletes the activity. Plans fulfilled by it are kept, but no longer refer to it.
+	ActivityDelete(id int64, ctx context.Context) error
 
 	PlanAdd(p Plan, ctx context.Context) (id int64, err error)
 	PlanGet(id int64, ctx context.Context) (Plan, error)
@@ -68,11 +88,24 @@ type Storage interface {
 	PlanEdit(p Plan, ctx context.Context) error
 
 	TaskGet(id int64, ctx context.Context) (Task, error)
+	// TaskByTitle returns the oldest task whose QuickTitle is title, ignoring case.
+	// ok is false if there is none.
+	TaskByTitle(title string, ctx context.Context) (t Task, ok bool, err error)
 	TaskGetActivities(id int64, ctx context.Context) ([]Activity, error)
 	TaskGetPlans(id int64, limit, offset int, ctx context.Context) ([]Plan, error)
 	TaskSearch(query string, undoneAt time.Time, ctx context.Context) (Window[Task], error)
+	// Tasks returns every task, done or not, oldest first.
+	Tasks(ctx context.Context) ([]Task, error)
 	TaskAdd(t Task, ctx context.Context) (id int64, err error)
 	TaskEdit(t Task, ctx context.Context) error
+	// TaskDelete deletes the task with its plans, tags and grants, or returns ErrHasActivities.
+	TaskDelete(id int64, ctx context.Context) error
+	// TaskTags returns the task's tags, sorted.
+	TaskTags(id int64, ctx context.Context) ([]string, error)
+	// TaskSetTags replaces the task's tags.
+	TaskSetTags(id int64, tags []string, ctx context.Context) error
+	// TagTasks returns the tasks with the tag, newest first.
+	TagTasks(tag string, ctx context.Context) ([]Task, error)
 
 	// Range returns activities and plans returned by PlanRange and ActivityRange.
 	// Tasks are the tasks referred to by each activity and plan.
@@ -81,6 +114,90 @@ type Storage interface {
 	ReplaceLinks(source *url.URL, links []linkdata.Link, ctx context.Context) error
 	GetLinks(source *url.URL, ctx context.Context) ([]linkdata.Link, error)
 	GetBacklinks(destination *url.URL, ctx context.Context) ([]linkdata.Backlink, error)
+
+	// MappingGet returns the local ID of the row of the given kind that was imported from foreign (e.g. a subject URI from another jks instance).
+	// ok is false if foreign was never imported.
+	MappingGet(kind, foreign string, ctx context.Context) (id int64, ok bool, err error)
+	MappingSet(kind, foreign string, id int64, ctx context.Context) error
+
+	// OccurrenceGet returns the occurrence of the rule at t; ok is false if it was never generated.
+	OccurrenceGet(rule string, t time.Time, ctx context.Context) (o Occurrence, ok bool, err error)
+	// OccurrenceSet records the task generated for the occurrence, replacing any recorded before.
+	OccurrenceSet(o Occurrence, ctx context.Context) error
+	// OccurrenceRange returns the occurrences of the rule between a and b (inclusive), ordered by time.
+	OccurrenceRange(rule string, a, b time.Time, ctx context.Context) ([]Occurrence, error)
+
+	Recurrences(ctx context.Context) ([]Recurrence, error)
+	RecurrenceGet(id int64, ctx context.Context) (Recurrence, error)
+	RecurrenceAdd(r Recurrence, ctx context.Context) (id int64, err error)
+	RecurrenceEdit(r Recurrence, ctx context.Context) error
+	// RecurrenceDelete deletes the recurrence. The tasks generated for it are kept, but are no longer its occurrences.
+	RecurrenceDelete(id int64, ctx context.Context) error
+
+	Calendars(ctx context.Context) ([]Calendar, error)
+	CalendarGet(id int64, ctx context.Context) (Calendar, error)
+	CalendarAdd(c Calendar, ctx context.Context) (id int64, err error)
+	// CalendarEdit replaces the calendar's name and ranges.
+	CalendarEdit(c Calendar, ctx context.Context) error
+	// CalendarDelete deletes the calendar, and removes it from the recurrences that refer to it.
+	CalendarDelete(id int64, ctx context.Context) error
+
+	// WithTx runs fn with a Storage whose changes are made atomically: all of them if fn returns nil, and none otherwise.
+	// Backends without transactions can emulate this, e.g. by undoing the changes made so far when fn fails.
+	WithTx(ctx context.Context, fn func(st Storage) error) error
+
+	Webhooks(ctx context.Context) ([]Webhook, error)
+	WebhookGet(id int64, ctx context.Context) (Webhook, error)
+	WebhookAdd(h Webhook, ctx context.Context) (id int64, err error)
+	WebhookEdit(h Webhook, ctx context.Context) error
+	// WebhookDelete deletes the webhook and its deliveries.
+	WebhookDelete(id int64, ctx context.Context) error
+
+	// DeliveryAdd adds the delivery, and deletes the webhook's deliveries older than the newest MaxDeliveries, unless they are still to be attempted.
+	DeliveryAdd(d Delivery, ctx context.Context) (id int64, err error)
+	DeliveryEdit(d Delivery, ctx context.Context) error
+	// Deliveries returns the latest deliveries to the webhook, newest first.
+	Deliveries(webhookID int64, limit int, ctx context.Context) ([]Delivery, error)
+	// DeliveriesDue returns the deliveries whose NextAttempt is at or before t.
+	DeliveriesDue(t time.Time, ctx context.Context) ([]Delivery, error)
+
+	Tokens(ctx context.Context) ([]Token, error)
+	// TokenByHash returns the token with the given hash, whoever its owner is; ok is false if there is none.
+	TokenByHash(hash string, ctx context.Context) (t Token, ok bool, err error)
+	TokenAdd(t Token, ctx context.Context) (id int64, err error)
+	// TokenUsed records that the token was used at t.
+	TokenUsed(id int64, t time.Time, ctx context.Context) error
+	TokenDelete(id int64, ctx context.Context) error
+
+	// Passkeys returns the passkeys of the user with the given provider and login, or of all users if both are empty.
+	Passkeys(provider, login string, ctx context.Context) ([]Passkey, error)
+	// PasskeyByCredentialID returns the passkey with the given WebAuthn credential ID; ok is false if there is none.
+	PasskeyByCredentialID(credentialID []byte, ctx context.Context) (p Passkey, ok bool, err error)
+	PasskeyAdd(p Passkey, ctx context.Context) (id int64, err error)
+	// PasskeyUsed records that the passkey was used at t, and replaces its Credential (e.g. with an updated signature counter).
+	PasskeyUsed(id int64, credential []byte, t time.Time, ctx context.Context) error
+	PasskeyDelete(id int64, ctx context.Context) error
+
+	// Users returns the users, sorted by name.
+	Users(ctx context.Context) ([]User, error)
+	// UserGet returns the user with the given name; ok is false if there is none.
+	UserGet(name string, ctx context.Context) (u User, ok bool, err error)
+	UserAdd(u User, ctx context.Context) error
+	UserEdit(u User, ctx context.Context) error
+	// UserDelete deletes the user, so they can no longer log in. The rows they own are kept.
+	UserDelete(name string, ctx context.Context) error
+
+	// Grants returns the grants of the owner's tasks, oldest first.
+	Grants(ctx context.Context) ([]Grant, error)
+	// GrantsTo returns the grants to the user, whoever their owners are, oldest first.
+	GrantsTo(grantee string, ctx context.Context) ([]Grant, error)
+	GrantAdd(g Grant, ctx context.Context) (id int64, err error)
+	GrantDelete(id int64, ctx context.Context) error
+
+	// Revisions returns the revisions of the entity (one of EntityTask, EntityActivity or EntityPlan) with the given ID, newest first.
+	// Adding, editing or deleting a task, activity or plan records a revision.
+	Revisions(entity string, id int64, ctx context.Context) ([]Revision, error)
+	RevisionGet(id int64, ctx context.Context) (Revision, error)
 }
 
 type Window[T any] interface {
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Token is an API token, for clients that cannot log in with a browser.
+// Only a hash of the token is stored.
+type Token struct {
+	ID   int64
+	Name string
+	// Hash is HashToken of the token.
+	Hash     string
+	Created  time.Time
+	LastUsed *time.Time
+	// Owner is the owner (see WithOwner) whose rows the token can access.
+	Owner string
+}
+
+// tokenPrefix makes tokens recognizable, e.g. by secret scanners.
+const tokenPrefix = "jks_"
+
+// NewToken returns a random token and its hash.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
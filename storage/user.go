@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// User is an account that may log in, with its settings.
+type User struct {
+	// Name is the user's name as given by auth.User.Name, e.g. "alice" or "dex:alice".
+	Name string
+	// Approved is whether the user may log in.
+	// Users who log in without an account are added unapproved, as a registration for an admin to approve.
+	Approved bool
+	// Admin users manage the other users.
+	Admin bool
+	// Timezone is the IANA name of the time zone times are shown in, or "" for UTC.
+	Timezone string
+	// Notify lists where the user's reminders are sent, e.g. ntfy+https://ntfy.sh/topic (see reminder.ParseNotifier).
+	Notify  []string
+	Created time.Time
+}
+
+type ownerKey struct{}
+
+// WithOwner returns a context that only sees the rows owned by owner, and adds rows owned by owner.
+// Users, passkeys, TokenByHash and GrantsTo are not owned, and are not affected.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// Owner returns the owner set by WithOwner, or "" if there is none.
+// Rows owned by "" are those of the main user, which were there before there were other users.
+func Owner(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
@@ -0,0 +1,35 @@
+package storage
+
+import "time"
+
+// Webhook is a subscription to events, which are POSTed to URL as signed JSON.
+type Webhook struct {
+	ID  int64
+	URL string
+	// Secret is the key for the HMAC-SHA256 signature of each payload.
+	Secret string
+	// Events lists the event types to deliver. A type ending in ".*" matches all types with that prefix (e.g. "activity.*"), and an empty list matches all events.
+	Events []string
+	Active bool
+}
+
+// MaxDeliveries is how many deliveries to each webhook are kept (see Storage.DeliveryAdd).
+const MaxDeliveries = 100
+
+// Delivery is one event to be delivered to a Webhook, and the outcome of the last attempt.
+type Delivery struct {
+	ID        int64
+	WebhookID int64
+	EventType string
+	Payload   []byte
+	Created   time.Time
+	Attempts  int
+	// LastAttempt, StatusCode and Error describe the last attempt.
+	// StatusCode is 0 if no response was received.
+	LastAttempt *time.Time
+	StatusCode  int
+	Error       string
+	// NextAttempt is when to try again, or nil if the delivery succeeded or was given up on.
+	NextAttempt *time.Time
+	Delivered   bool
+}
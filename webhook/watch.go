@@ -0,0 +1,235 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"nyiyui.ca/jks/changefeed"
+	"nyiyui.ca/jks/storage"
+)
+
+// Watcher turns changes on the change feed, and the passing of time, into events for a Dispatcher.
+type Watcher struct {
+	st  storage.Storage
+	bus *changefeed.Bus
+	d   *Dispatcher
+	// DeadlineLead is how long before a deadline EventTaskDeadline is sent.
+	DeadlineLead time.Duration
+	// Interval is how often to check the time-based events and retry failed deliveries.
+	Interval time.Duration
+	// Owners returns the owners (see storage.WithOwner) whose time-based events are checked and deliveries made.
+	// If it is nil, only those of the owner of the context passed to Run are.
+	Owners func(ctx context.Context) ([]string, error)
+	// last is when the time-based events were last checked.
+	last time.Time
+	// wake is signalled when deliveries are recorded, for deliver to make them.
+	wake chan struct{}
+}
+
+func NewWatcher(st storage.Storage, bus *changefeed.Bus, d *Dispatcher) *Watcher {
+	return &Watcher{
+		st:           st,
+		bus:          bus,
+		d:            d,
+		DeadlineLead: time.Hour,
+		Interval:     time.Minute,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Run emits events until ctx is done.
+// Time-based events are only sent for times passing while Run is running.
+func (w *Watcher) Run(ctx context.Context) {
+	go w.deliver(ctx)
+	w.last = time.Now()
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		_, _, ch, cancel := w.bus.Subscribe(-1)
+		err := w.watch(ctx, ch, ticker.C)
+		cancel()
+		if err != nil {
+			return
+		}
+		// dropped by the bus for falling behind; some changes were missed
+		log.Printf("webhook: change feed subscription dropped; resubscribing")
+	}
+}
+
+// watch returns ctx.Err() once ctx is done, or nil if ch is closed.
+func (w *Watcher) watch(ctx context.Context, ch <-chan changefeed.Event, tick <-chan time.Time) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			ctx := storage.WithOwner(ctx, e.Owner)
+			for _, p := range w.fromChange(e, ctx) {
+				w.emit(p, ctx)
+			}
+		case now := <-tick:
+			owners, err := w.owners(ctx)
+			if err != nil {
+				log.Printf("webhook: owners: %s", err)
+			}
+			for _, owner := range owners {
+				w.tick(w.last, now, storage.WithOwner(ctx, owner))
+			}
+			w.last = now
+		}
+	}
+}
+
+func (w *Watcher) owners(ctx context.Context) ([]string, error) {
+	if w.Owners == nil {
+		return []string{storage.Owner(ctx)}, nil
+	}
+	return w.Owners(ctx)
+}
+
+// tick emits the time-based events in (from, now] of the owner of ctx.
+func (w *Watcher) tick(from, now time.Time, ctx context.Context) {
+	ps, err := w.fromTime(from, now, ctx)
+	if err != nil {
+		log.Printf("webhook: %s", err)
+	}
+	for _, p := range ps {
+		w.emit(p, ctx)
+	}
+}
+
+// emit records the deliveries of p and wakes deliver to make them.
+func (w *Watcher) emit(p Payload, ctx context.Context) {
+	err := w.d.Emit(p, ctx)
+	if err != nil {
+		log.Printf("webhook: %s: %s", p.Type, err)
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver makes the due deliveries of every owner when woken by emit, and every Interval to retry failed ones, until ctx is done.
+// It runs apart from watch, so that a slow webhook does not make watch fall behind the change feed.
+func (w *Watcher) deliver(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+		owners, err := w.owners(ctx)
+		if err != nil {
+			log.Printf("webhook: owners: %s", err)
+		}
+		for _, owner := range owners {
+			err = w.d.RetryDue(storage.WithOwner(ctx, owner))
+			if err != nil {
+				log.Printf("webhook: retry: %s", err)
+			}
+		}
+	}
+}
+
+// fromChange returns the payloads for a change: one mirroring it (e.g. "activity.add"), and any of EventTaskDone, EventActivityStarted and EventActivityEnded it implies.
+// Activities logged as having started or ended before the last time check are treated as starting or ending now.
+func (w *Watcher) fromChange(e changefeed.Event, ctx context.Context) []Payload {
+	p := Payload{Type: fmt.Sprintf("%s.%s", e.Entity, e.Op), Time: e.Time}
+	var after, before *storage.Activity
+	switch v := e.Value.(type) {
+	case storage.Task:
+		p.Task = &v
+	case storage.Activity:
+		p.Activity = &v
+		after = &v
+	case storage.Plan:
+		p.Plan = &v
+	}
+	if v, ok := e.Before.(storage.Activity); ok {
+		before = &v
+		if p.Activity == nil {
+			p.Activity = before
+		}
+	}
+	ps := []Payload{p}
+	if after == nil {
+		return ps
+	}
+	derived := Payload{Time: e.Time, Activity: after}
+	if t, err := w.st.TaskGet(after.TaskID, ctx); err == nil {
+		derived.Task = &t
+	}
+	if after.Done && (before == nil || !before.Done) {
+		derived.Type = EventTaskDone
+		ps = append(ps, derived)
+	}
+	if e.Op == changefeed.OpAdd && !after.TimeStart.After(w.last) && after.TimeEnd.After(w.last) {
+		derived.Type = EventActivityStarted
+		ps = append(ps, derived)
+	}
+	if before != nil && before.TimeEnd.After(w.last) && !after.TimeEnd.After(w.last) {
+		derived.Type = EventActivityEnded
+		ps = append(ps, derived)
+	}
+	return ps
+}
+
+// latestActivities is the number of activities (ending last) checked for starting or ending.
+const latestActivities = 50
+
+// fromTime returns the payloads for activities starting or ending, and deadlines approaching, in (from, to].
+func (w *Watcher) fromTime(from, to time.Time, ctx context.Context) ([]Payload, error) {
+	var ps []Payload
+	in := func(t time.Time) bool { return t.After(from) && !t.After(to) }
+	as, err := w.st.ActivityLatestN(ctx, latestActivities)
+	if err != nil {
+		return nil, fmt.Errorf("latest activities: %w", err)
+	}
+	for _, a := range as {
+		a := a
+		p := Payload{Time: to, Activity: &a}
+		if t, err := w.st.TaskGet(a.TaskID, ctx); err == nil {
+			p.Task = &t
+		}
+		if in(a.TimeStart) {
+			p.Type = EventActivityStarted
+			ps = append(ps, p)
+		}
+		if in(a.TimeEnd) {
+			p.Type = EventActivityEnded
+			ps = append(ps, p)
+		}
+	}
+
+	tsw, err := w.st.TaskSearch("", to, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("undone tasks: %w", err)
+	}
+	defer tsw.Close()
+	const page = 100
+	for offset := 0; ; offset += page {
+		ts, err := tsw.Get(page, offset)
+		if err != nil {
+			return nil, fmt.Errorf("undone tasks: %w", err)
+		}
+		for _, t := range ts {
+			t := t
+			if t.Deadline != nil && in(t.Deadline.Add(-w.DeadlineLead)) {
+				ps = append(ps, Payload{Type: EventTaskDeadline, Time: to, Task: &t})
+			}
+		}
+		if len(ts) < page {
+			break
+		}
+	}
+	return ps, nil
+}
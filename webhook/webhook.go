@@ -0,0 +1,229 @@
+// Package webhook delivers events about tasks and activities to storage.Webhook subscriptions.
+//
+// Each delivery is an HTTP POST of a JSON Payload.
+// The X-Jks-Signature header is "sha256=" followed by the hex HMAC-SHA256 of the body, keyed with the webhook's secret.
+// X-Jks-Event is the event type and X-Jks-Delivery is the delivery ID, which is the same across retries.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"nyiyui.ca/jks/storage"
+)
+
+const (
+	EventActivityStarted = "activity.started"
+	EventActivityEnded   = "activity.ended"
+	// EventTaskDone is sent when an activity marking its task done is added, or an activity is edited to do so.
+	EventTaskDone = "task.done"
+	// EventTaskDeadline is sent a while (Watcher.DeadlineLead) before the deadline of a task that is not done.
+	EventTaskDeadline = "task.deadline"
+	// EventPing is only sent when testing a webhook from the UI.
+	EventPing = "ping"
+)
+
+// Types lists the event types, apart from the ones mirroring the change feed.
+// Those are "<entity>.<op>", e.g. "task.add", "activity.edit" or "plan.delete".
+var Types = []string{EventActivityStarted, EventActivityEnded, EventTaskDone, EventTaskDeadline, EventPing}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Task     *storage.Task     `json:"task,omitempty"`
+	Activity *storage.Activity `json:"activity,omitempty"`
+	Plan     *storage.Plan     `json:"plan,omitempty"`
+}
+
+// Matches reports whether h wants events of type eventType.
+func Matches(h storage.Webhook, eventType string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, pattern := range h.Events {
+		if pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the X-Jks-Signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DefaultBackoff is the delay before each retry of a failed delivery; after the last one, the delivery is given up on.
+var DefaultBackoff = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+// Dispatcher records deliveries in storage and makes them.
+type Dispatcher struct {
+	st      storage.Storage
+	Client  *http.Client
+	Backoff []time.Duration
+}
+
+func NewDispatcher(st storage.Storage) *Dispatcher {
+	return &Dispatcher{
+		st:      st,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		Backoff: DefaultBackoff,
+	}
+}
+
+// Emit records a delivery of p, due now, to each active webhook that matches it.
+// The deliveries are made by RetryDue, so that a slow webhook does not hold up the caller; only storage errors are returned.
+func (d *Dispatcher) Emit(p Payload, ctx context.Context) error {
+	hs, err := d.st.Webhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+	now := time.Now()
+	for _, h := range hs {
+		if !h.Active || !Matches(h, p.Type) {
+			continue
+		}
+		_, err = d.record(h, p, &now, ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmitTo records a delivery of p to h regardless of its filters, and attempts it right away.
+func (d *Dispatcher) EmitTo(h storage.Webhook, p Payload, ctx context.Context) (storage.Delivery, error) {
+	// not due until the attempt fails, so that RetryDue does not make it concurrently
+	del, err := d.record(h, p, nil, ctx)
+	if err != nil {
+		return storage.Delivery{}, err
+	}
+	return del, d.attempt(h, &del, ctx)
+}
+
+// record adds a delivery of p to h, to be attempted at next (or not, if nil).
+func (d *Dispatcher) record(h storage.Webhook, p Payload, next *time.Time, ctx context.Context) (storage.Delivery, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return storage.Delivery{}, fmt.Errorf("marshal: %w", err)
+	}
+	del := storage.Delivery{
+		WebhookID:   h.ID,
+		EventType:   p.Type,
+		Payload:     body,
+		Created:     time.Now(),
+		NextAttempt: next,
+	}
+	del.ID, err = d.st.DeliveryAdd(del, ctx)
+	if err != nil {
+		return storage.Delivery{}, fmt.Errorf("add delivery: %w", err)
+	}
+	return del, nil
+}
+
+// RetryDue attempts the deliveries whose next attempt is due: new ones from Emit, and failed ones being retried.
+// Those to inactive webhooks are given up on.
+func (d *Dispatcher) RetryDue(ctx context.Context) error {
+	dels, err := d.st.DeliveriesDue(time.Now(), ctx)
+	if err != nil {
+		return fmt.Errorf("deliveries due: %w", err)
+	}
+	hooks := map[int64]storage.Webhook{}
+	for _, del := range dels {
+		h, ok := hooks[del.WebhookID]
+		if !ok {
+			h, err = d.st.WebhookGet(del.WebhookID, ctx)
+			if err != nil {
+				return fmt.Errorf("webhook %d: %w", del.WebhookID, err)
+			}
+			hooks[del.WebhookID] = h
+		}
+		if !h.Active {
+			del.NextAttempt = nil
+			del.Error = "webhook is inactive"
+			err = d.st.DeliveryEdit(del, ctx)
+			if err != nil {
+				return fmt.Errorf("edit delivery: %w", err)
+			}
+			continue
+		}
+		err = d.attempt(h, &del, ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt POSTs del to h and records the outcome in storage.
+func (d *Dispatcher) attempt(h storage.Webhook, del *storage.Delivery, ctx context.Context) error {
+	now := time.Now()
+	del.Attempts++
+	del.LastAttempt = &now
+	del.StatusCode = 0
+	del.Error = ""
+	err := d.post(h, del)
+	if err == nil {
+		del.Delivered = true
+		del.NextAttempt = nil
+	} else {
+		del.Error = err.Error()
+		if del.Attempts <= len(d.Backoff) {
+			next := now.Add(d.Backoff[del.Attempts-1])
+			del.NextAttempt = &next
+		} else {
+			del.NextAttempt = nil
+			log.Printf("webhook %d: giving up on delivery %d after %d attempts: %s", h.ID, del.ID, del.Attempts, err)
+		}
+	}
+	err = d.st.DeliveryEdit(*del, ctx)
+	if err != nil {
+		return fmt.Errorf("edit delivery: %w", err)
+	}
+	return nil
+}
+
+func (d *Dispatcher) post(h storage.Webhook, del *storage.Delivery) error {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "jks-webhook")
+	req.Header.Set("X-Jks-Event", del.EventType)
+	req.Header.Set("X-Jks-Delivery", fmt.Sprint(del.ID))
+	req.Header.Set("X-Jks-Signature", Sign(h.Secret, del.Payload))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	del.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"nyiyui.ca/jks/changefeed"
+	"nyiyui.ca/jks/database/dbtest"
+	"nyiyui.ca/jks/storage"
+)
+
+func TestMatches(t *testing.T) {
+	h := storage.Webhook{Events: []string{"activity.*", "task.done"}}
+	for typ, want := range map[string]bool{
+		EventActivityStarted: true,
+		"activity.add":       true,
+		EventTaskDone:        true,
+		EventTaskDeadline:    false,
+	} {
+		if got := Matches(h, typ); got != want {
+			t.Errorf("%s: got %t", typ, got)
+		}
+	}
+	if !Matches(storage.Webhook{}, EventTaskDeadline) {
+		t.Error("a webhook without filters should match everything")
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	got := make(chan Payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Jks-Signature") != Sign("secret", body) {
+			t.Errorf("bad signature %q", r.Header.Get("X-Jks-Signature"))
+		}
+		var p Payload
+		err := json.Unmarshal(body, &p)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- p
+	}))
+	defer srv.Close()
+	_, err := st.WebhookAdd(storage.Webhook{URL: srv.URL, Secret: "secret", Events: []string{"task.*"}, Active: true}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(st)
+	err = d.Emit(Payload{Type: EventActivityStarted}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Emit(Payload{Type: EventTaskDone, Task: &storage.Task{QuickTitle: "done"}}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatal("Emit made a delivery")
+	}
+	err = d.RetryDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := <-got
+	if p.Type != EventTaskDone || p.Task == nil || p.Task.QuickTitle != "done" {
+		t.Fatalf("got %#v", p)
+	}
+	if len(got) != 0 {
+		t.Fatal("filtered event was delivered")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	h := storage.Webhook{URL: srv.URL, Secret: "secret", Active: true}
+	var err error
+	h.ID, err = st.WebhookAdd(h, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(st)
+	d.Backoff = []time.Duration{0, 0}
+	del, err := d.EmitTo(h, Payload{Type: EventPing}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Delivered || del.StatusCode != 500 || del.NextAttempt == nil {
+		t.Fatalf("after a failed attempt: %#v", del)
+	}
+
+	err = d.RetryDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = http.StatusNoContent
+	err = d.RetryDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dels, err := st.Deliveries(h.ID, 10, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dels) != 1 || !dels[0].Delivered || dels[0].Attempts != 3 || dels[0].NextAttempt != nil {
+		t.Fatalf("after retries: %#v", dels)
+	}
+
+	status = http.StatusInternalServerError
+	del, err = d.EmitTo(h, Payload{Type: EventPing}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		err = d.RetryDue(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dels, err = st.Deliveries(h.ID, 10, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range dels {
+		if got.ID == del.ID && (got.Attempts != 3 || got.NextAttempt != nil || got.Delivered) {
+			t.Fatalf("should give up after the backoff runs out: %#v", got)
+		}
+	}
+}
+
+func TestInactive(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	h := storage.Webhook{URL: srv.URL, Secret: "secret", Active: true}
+	var err error
+	h.ID, err = st.WebhookAdd(h, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(st)
+	err = d.Emit(Payload{Type: EventTaskDone}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Active = false
+	err = st.WebhookEdit(h, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.RetryDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dels, err := st.Deliveries(h.ID, 10, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 0 || len(dels) != 1 || dels[0].NextAttempt != nil || dels[0].Delivered {
+		t.Fatalf("delivered to an inactive webhook: %d requests, %#v", requests, dels)
+	}
+}
+
+func TestPruneDeliveries(t *testing.T) {
+	ctx := context.Background()
+	st := dbtest.Open(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	h := storage.Webhook{URL: srv.URL, Secret: "secret", Active: true}
+	var err error
+	h.ID, err = st.WebhookAdd(h, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(st)
+	for range storage.MaxDeliveries + 10 {
+		err = d.Emit(Payload{Type: EventTaskDone}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dels, err := st.Deliveries(h.ID, 1000, ctx)
+	if err != nil || len(dels) != storage.MaxDeliveries+10 {
+		t.Fatalf("pending deliveries were pruned: %d %v", len(dels), err)
+	}
+	err = d.RetryDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Emit(Payload{Type: EventTaskDone}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dels, err = st.Deliveries(h.ID, 1000, ctx)
+	if err != nil || len(dels) != storage.MaxDeliveries || dels[0].NextAttempt == nil {
+		t.Fatalf("after pruning: %d %v", len(dels), err)
+	}
+}
+
+func TestSlowWebhook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := changefeed.NewBus(0)
+	st := changefeed.Wrap(dbtest.Open(t), bus)
+	release := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// hang on the first delivery until every change has been made
+		once.Do(func() { <-release })
+	}))
+	defer srv.Close()
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+	h := storage.Webhook{URL: srv.URL, Secret: "secret", Events: []string{"task.add"}, Active: true}
+	var err error
+	h.ID, err = st.WebhookAdd(h, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(st, bus, NewDispatcher(st))
+	go w.Run(ctx)
+	time.Sleep(50 * time.Millisecond) // let Run subscribe
+
+	waitFor := func(ok func([]storage.Delivery) bool) []storage.Delivery {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			dels, err := st.Deliveries(h.ID, 100, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok(dels) || time.Now().After(deadline) {
+				return dels
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// each change is recorded while the first delivery hangs
+	const n = 10
+	for i := range n {
+		_, err = st.TaskAdd(storage.Task{QuickTitle: fmt.Sprint(i)}, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dels := waitFor(func(dels []storage.Delivery) bool { return len(dels) == i+1 })
+		if len(dels) != i+1 {
+			t.Fatalf("recorded %d deliveries while a webhook hung, want %d", len(dels), i+1)
+		}
+	}
+	releaseOnce.Do(func() { close(release) })
+	dels := waitFor(func(dels []storage.Delivery) bool {
+		for _, del := range dels {
+			if !del.Delivered {
+				return false
+			}
+		}
+		return true
+	})
+	for _, del := range dels {
+		if !del.Delivered {
+			t.Fatalf("not delivered: %#v", del)
+		}
+	}
+}